@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// buildInfoEntry is the name of the entry of the build metadata in the dat file
+const buildInfoEntry = "BUILD-INFO"
+
+// BuildInfo traces the generated files back to the generator and the data
+// directories they were generated from.
+type BuildInfo struct {
+	// Version and Revision are the module version and the VCS revision of the generator
+	Version  string `json:"version"`
+	Revision string `json:"revision,omitempty"`
+	// Commits are the git commits of the data directories in git repositories, by path
+	Commits map[string]string `json:"commits,omitempty"`
+	// SourceSHA256 is the hash of the paths and the contents of all data files
+	SourceSHA256 string `json:"source_sha256"`
+}
+
+// newBuildInfo returns the build metadata of a generation from the data directories
+func newBuildInfo(sources []ruleset.DataSource) (*BuildInfo, error) {
+	info := &BuildInfo{Version: "unknown"}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Version = build.Main.Version
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Revision = setting.Value
+			}
+		}
+	}
+	hash := sha256.New()
+	for _, source := range sources {
+		if commit, err := exec.Command("git", "-C", source.Path, "rev-parse", "HEAD").Output(); err == nil {
+			if info.Commits == nil {
+				info.Commits = make(map[string]string)
+			}
+			info.Commits[source.Path] = strings.TrimSpace(string(commit))
+		}
+		var paths []string
+		if err := filepath.WalkDir(source.Path, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case d.IsDir() && d.Name() == ".git":
+				return filepath.SkipDir
+			case !d.IsDir():
+				paths = append(paths, path)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			name, err := filepath.Rel(source.Path, path)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(hash, "%s:%s\n", source.Namespace, filepath.ToSlash(name))
+			if err := hashFile(hash, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	info.SourceSHA256 = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+// hashFile writes the content of the file to the hash
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// String returns the build metadata in a line, with the revision of the
+// development builds, eg: `v1.2.0, data ./data@5f6a7b8, source sha256:9c0d...`
+func (b *BuildInfo) String() string {
+	parts := []string{b.Version}
+	if b.Version == "(devel)" && b.Revision != "" {
+		parts[0] += " " + b.Revision
+	}
+	paths := make([]string, 0, len(b.Commits))
+	for path := range b.Commits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		parts = append(parts, "data "+path+"@"+b.Commits[path])
+	}
+	return strings.Join(append(parts, "source sha256:"+b.SourceSHA256), ", ")
+}
+
+// datEntry returns the entry of the build metadata in the dat file, a rule of
+// the reserved domain `build-info.invalid` with the metadata in attributes
+// like `@commit=5f6a7b8`.
+func (b *BuildInfo) datEntry() *router.GeoSite {
+	rule := &router.Domain{Type: router.Domain_Full, Value: "build-info.invalid"}
+	addAttribute := func(key, value string) {
+		rule.Attribute = append(rule.Attribute, &router.Domain_Attribute{
+			Key:        key + "=" + strings.ReplaceAll(value, " ", "-"),
+			TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true},
+		})
+	}
+	addAttribute("version", b.Version)
+	if b.Revision != "" {
+		addAttribute("revision", b.Revision)
+	}
+	paths := make([]string, 0, len(b.Commits))
+	for path := range b.Commits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		addAttribute("commit", b.Commits[path])
+	}
+	addAttribute("source", b.SourceSHA256)
+	return &router.GeoSite{CountryCode: buildInfoEntry, Domain: []*router.Domain{rule}}
+}
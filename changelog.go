@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ruleHashes maps the lowercase names of lists to the hashes of their rules
+type ruleHashes map[string][]string
+
+// newRuleHashes returns the hashes of the rules of the lists in the dat file.
+// Only short hashes are kept, which are enough to count the changed rules.
+func newRuleHashes(geositeList *router.GeoSiteList) ruleHashes {
+	hashes := make(ruleHashes, len(geositeList.GetEntry()))
+	for _, geosite := range geositeList.GetEntry() {
+		name := strings.ToLower(geosite.GetCountryCode())
+		hashes[name] = make([]string, 0, len(geosite.GetDomain()))
+		for _, domain := range geosite.GetDomain() {
+			sum := sha256.Sum256([]byte(ruleset.RuleString(domain)))
+			hashes[name] = append(hashes[name], hex.EncodeToString(sum[:8]))
+		}
+		sort.Strings(hashes[name])
+	}
+	return hashes
+}
+
+// GenerateChangelog writes the lists changed since the build recorded in the
+// state file, and by how many rules, into the changelog file in Markdown, then
+// records the current build in the state file.
+func GenerateChangelog(geositeList *router.GeoSiteList, changelogPath, statePath string) error {
+	current := newRuleHashes(geositeList)
+	previous := make(ruleHashes)
+	content, err := os.ReadFile(statePath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &previous); err != nil {
+			return fmt.Errorf("invalid changelog state %s: %w", statePath, err)
+		}
+	}
+
+	var sb strings.Builder
+	if ruleset.TimeNow != nil {
+		fmt.Fprintf(&sb, "## %s\n\n", ruleset.TimeNow().UTC().Format("2006-01-02"))
+	}
+	diffs := DiffDatRules(previous, current)
+	if len(content) == 0 {
+		fmt.Fprintf(&sb, "- First build with %d lists.\n", len(current))
+	} else {
+		if len(diffs) == 0 {
+			sb.WriteString("- No lists changed.\n")
+		}
+		for _, diff := range diffs {
+			switch diff.Status {
+			case "added":
+				fmt.Fprintf(&sb, "- `%s`: new list with %d rules\n", diff.List, len(diff.Added))
+			case "removed":
+				fmt.Fprintf(&sb, "- `%s`: removed\n", diff.List)
+			default:
+				fmt.Fprintf(&sb, "- `%s`: +%d -%d rules, %d in total\n", diff.List, len(diff.Added), len(diff.Removed), len(current[diff.List]))
+			}
+		}
+	}
+	if err := ruleset.WriteFile(changelogPath, []byte(sb.String())); err != nil {
+		return err
+	}
+
+	stateBytes, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err := ruleset.WriteFile(statePath, stateBytes); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "Changelog of %d changed lists has been generated successfully in '%s'.", len(diffs), changelogPath)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+const checksumFileName = "sha256sum.txt"
+
+// isVerificationFile reports whether the file is sha256sum.txt, a per-file
+// `.sha256` checksum file or a detached signature, which describe the other
+// files in the publish directory.
+func isVerificationFile(name string) bool {
+	return name == checksumFileName || strings.HasSuffix(name, ".sha256") ||
+		strings.HasSuffix(name, ".minisig") || strings.HasSuffix(name, ".asc")
+}
+
+// GenerateChecksums writes sha256sum.txt covering all files in the output
+// directory, in the format of `sha256sum -c`, and a `.sha256` file for each
+// file if perFile is set.
+func GenerateChecksums(outputDir string, perFile bool) error {
+	files, err := outputFiles(outputDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, name := range files {
+		if !isVerificationFile(name) {
+			names = append(names, name)
+		}
+	}
+
+	var sb strings.Builder
+	for _, name := range names {
+		hash, err := fileHash(filepath.Join(outputDir, name))
+		if err != nil {
+			return err
+		}
+		line := hash + "  " + name + "\n"
+		sb.WriteString(line)
+		if perFile {
+			if err := ruleset.WriteFile(filepath.Join(outputDir, name+".sha256"), []byte(line)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := ruleset.WriteFile(filepath.Join(outputDir, checksumFileName), []byte(sb.String())); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", checksumFileName, outputDir)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// chunkFileName returns the name of the files of a chunk of an exported list
+// without the extension, eg: `geolocation-!cn.part1`, or the name of the list
+// if it is not split.
+func chunkFileName(filename string, chunk *ruleset.ListInfo) string {
+	if chunk.Chunk == 0 {
+		return filename
+	}
+	return fmt.Sprintf("%s.part%d", filename, chunk.Chunk)
+}
+
+// removeStaleChunks removes the chunks of a format of an exported list left
+// by an earlier run, numbered beyond the chunks of this run, or all of them
+// if the list is no longer split into more than one. The chunks of a run are
+// numbered from one without gaps, so the first missing one is the last.
+func removeStaleChunks(outputDir, filename string, format ruleset.Exporter, chunks int) error {
+	if chunks == 1 {
+		chunks = 0
+	}
+	for number := chunks + 1; ; number++ {
+		name := exportedFileName(fmt.Sprintf("%s.part%d", filename, number), format)
+		err := os.Remove(filepath.Join(outputDir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// exportChunks returns the chunks of the files of the list in each format, by
+// the name of the format. The files of the formats have the same chunks, or
+// the whole list if it fits, except the formats overriding -excludeattrs,
+// split from their own rules.
+func exportChunks(listinfo *ruleset.ListInfo, formats []ruleset.Exporter, excludeAttrs, includeAttrs map[ruleset.FileName]map[ruleset.Attribute]bool) (map[string][]*ruleset.ListInfo, error) {
+	chunksOfFormat := make(map[string][]*ruleset.ListInfo, len(formats))
+	var defaultFormats []ruleset.Exporter
+	for _, format := range formats {
+		if _, ok := formatExcludeAttrs[format.Name()]; !ok {
+			defaultFormats = append(defaultFormats, format)
+			continue
+		}
+		view := listinfo.WithExcludeAttrs(formatExcludeAttrs.For(format.Name(), excludeAttrs), includeAttrs)
+		chunks, err := ruleset.SplitChunks(view, []ruleset.Exporter{format}, *chunkRules, *chunkBytes)
+		if err != nil {
+			return nil, err
+		}
+		chunksOfFormat[format.Name()] = chunks
+	}
+	chunks, err := ruleset.SplitChunks(listinfo, defaultFormats, *chunkRules, *chunkBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, format := range defaultFormats {
+		chunksOfFormat[format.Name()] = chunks
+	}
+	return chunksOfFormat, nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Command is a subcommand of the program, with its own flags.
+type Command struct {
+	Name  string
+	Usage string
+	Flags *flag.FlagSet
+	Run   func() error
+}
+
+// defaultCommand is run when no subcommand is given, so that
+// `rule-set -datapath ./data` keeps working as `rule-set generate -datapath ./data`.
+const defaultCommand = "generate"
+
+// commands is the registry of subcommands, in the order shown in help.
+var commands []*Command
+
+var (
+	completionFlags = flag.NewFlagSet("completion", flag.ExitOnError)
+	helpFlags       = flag.NewFlagSet("help", flag.ExitOnError)
+)
+
+func init() {
+	commands = []*Command{
+		{
+			Name:  "generate",
+			Usage: "Generate geosite.dat, rule sets of all formats and IP sets",
+			Flags: flag.CommandLine,
+			Run:   runGenerateCommand,
+		},
+		{
+			Name:  "sync",
+			Usage: "Download the upstream domain-list-community data, then generate with the local data overlaying it",
+			Flags: syncFlags,
+			Run:   runSync,
+		},
+		{
+			Name:  "serve",
+			Usage: "Serve generated files and compare proposed data changes over HTTP",
+			Flags: serveFlags,
+			Run:   runServe,
+		},
+		{
+			Name:  "lint",
+			Usage: "Check the data directory for duplicate, shadowed and unused rules and lists without writing any files",
+			Flags: lintFlags,
+			Run:   runLint,
+		},
+		{
+			Name:  "prune",
+			Usage: "Resolve the full and domain rules of lists and report the dead domains consistently answered with NXDOMAIN, or remove them with -write",
+			Flags: pruneFlags,
+			Run:   runPrune,
+		},
+		{
+			Name:  "verify",
+			Usage: "Check that the generated dat file and the files of the exported lists contain exactly the rules of the data directories, besides the documented drops",
+			Flags: verifyFlags,
+			Run:   runVerify,
+		},
+		{
+			Name:  "convert",
+			Usage: "Convert a rule file of a client into the format of another, usage: convert -from surge -to singbox input.list",
+			Flags: convertFlags,
+			Run:   runConvert,
+		},
+		{
+			Name:  "diff",
+			Usage: "Print the rules added and removed in each list between two dat files or publish directories, usage: diff <before> <after>",
+			Flags: diffFlags,
+			Run:   runDiff,
+		},
+		{
+			Name:  "merge",
+			Usage: "Merge the lists of dat files or publish directories into one dat file, usage: merge <dat> <dat>...",
+			Flags: mergeFlags,
+			Run:   runMerge,
+		},
+		{
+			Name:  "package",
+			Usage: "Archive the publish directory into release bundles, optionally one per client",
+			Flags: packageFlags,
+			Run:   runPackage,
+		},
+		{
+			Name:  "publish",
+			Usage: "Upload the publish directory to S3, S3-compatible storages like R2, or a GitHub release",
+			Flags: uploadFlags,
+			Run:   runUpload,
+		},
+		{
+			Name:  "demo",
+			Usage: "Generate all formats from the end-to-end fixtures and compare them with the golden outputs",
+			Flags: demoFlags,
+			Run:   runDemo,
+		},
+		{
+			Name:  "completion",
+			Usage: "Print the shell completion script, usage: completion bash|zsh|fish",
+			Flags: completionFlags,
+			Run:   runCompletion,
+		},
+		{
+			Name:  "help",
+			Usage: "Show the usage of all commands or a command, usage: help [command]",
+			Flags: helpFlags,
+			Run:   runHelp,
+		},
+	}
+	for _, cmd := range commands {
+		cmd := cmd
+		addLogFlags(cmd.Flags)
+		addProfileFlags(cmd.Flags)
+		if cmd.Flags != flag.CommandLine {
+			cmd.Flags.Usage = func() { printCommandUsage(cmd) }
+		}
+	}
+	flag.Usage = func() {
+		printUsage()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags of the %s command:\n", defaultCommand)
+		flag.PrintDefaults()
+	}
+}
+
+// findCommand returns the registered command of the name, or nil if not found.
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// runCommand parses the flags of the subcommand in args and runs it.
+func runCommand(args []string) error {
+	cmd := findCommand(defaultCommand)
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if cmd = findCommand(args[0]); cmd == nil {
+			printUsage()
+			return errors.New("unknown command: " + args[0])
+		}
+		args = args[1:]
+	}
+	if err := cmd.Flags.Parse(args); err != nil {
+		return err
+	}
+	if err := setFlagsFromEnv(cmd.Flags); err != nil {
+		return err
+	}
+	if err := setupLogger(); err != nil {
+		return err
+	}
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		return err
+	}
+	err = cmd.Run()
+	if stopErr := stopProfiling(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// flagEnvPrefix is the prefix of the environment variables of the flags
+const flagEnvPrefix = "RULESET_"
+
+// flagEnvName returns the environment variable of a flag, eg: RULESET_DATAPATH
+func flagEnvName(name string) string {
+	return flagEnvPrefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// setFlagsFromEnv sets the flags not given on the command line from their
+// environment variables, so that deployments can be configured without long
+// command lines.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, flagEnvName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", programName())
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.Name, cmd.Usage)
+	}
+	fmt.Fprintf(out, "\nThe %s command is run if no command is given.\n", defaultCommand)
+	fmt.Fprintf(out, "Run '%s help <command>' for the flags of a command.\n", programName())
+	fmt.Fprintf(out, "Flags not given are read from the %s<FLAG> environment variables, eg: %s.\n", flagEnvPrefix, flagEnvName("datapath"))
+}
+
+func printCommandUsage(cmd *Command) {
+	out := cmd.Flags.Output()
+	fmt.Fprintf(out, "Usage: %s %s [flags]\n\n%s\n\nFlags:\n", programName(), cmd.Name, cmd.Usage)
+	cmd.Flags.PrintDefaults()
+}
+
+func runHelp() error {
+	if helpFlags.NArg() == 0 {
+		printUsage()
+		return nil
+	}
+	cmd := findCommand(helpFlags.Arg(0))
+	if cmd == nil {
+		return errors.New("unknown command: " + helpFlags.Arg(0))
+	}
+	printCommandUsage(cmd)
+	return nil
+}
+
+// commandFlagNames returns the sorted flag names of a command
+func commandFlagNames(cmd *Command) []string {
+	var names []string
+	cmd.Flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+func runCompletion() error {
+	if completionFlags.NArg() != 1 {
+		return errors.New("completion: shell is required, one of bash, zsh, fish")
+	}
+
+	var script string
+	switch shell := completionFlags.Arg(0); shell {
+	case "bash":
+		script = bashCompletion(programName())
+	case "zsh":
+		script = zshCompletion(programName())
+	case "fish":
+		script = fishCompletion(programName())
+	default:
+		return errors.New("completion: unsupported shell: " + shell)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+func bashCompletion(prog string) string {
+	var sb strings.Builder
+	funcName := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog) + "_completion"
+	fmt.Fprintf(&sb, "# bash completion for %s\n", prog)
+	fmt.Fprintf(&sb, "%s() {\n", funcName)
+	sb.WriteString("\tlocal cur cmd words\n")
+	sb.WriteString("\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&sb, "\tcmd=%s\n", defaultCommand)
+	sb.WriteString("\tif [[ ${COMP_CWORD} -gt 1 && \"${COMP_WORDS[1]}\" != -* ]]; then\n\t\tcmd=\"${COMP_WORDS[1]}\"\n\tfi\n")
+	sb.WriteString("\tcase \"${cmd}\" in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "\t%s) words=\"%s\" ;;\n", cmd.Name, strings.Join(commandFlagNames(cmd), " "))
+	}
+	sb.WriteString("\tesac\n")
+	fmt.Fprintf(&sb, "\tif [[ ${COMP_CWORD} -eq 1 && \"${cur}\" != -* ]]; then\n\t\twords=\"%s\"\n\tfi\n", strings.Join(commandNames(), " "))
+	sb.WriteString("\tCOMPREPLY=($(compgen -W \"${words}\" -- \"${cur}\"))\n")
+	sb.WriteString("}\n")
+	fmt.Fprintf(&sb, "complete -o default -F %s %s\n", funcName, prog)
+	return sb.String()
+}
+
+func zshCompletion(prog string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#compdef %s\n\n", prog)
+	funcName := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	fmt.Fprintf(&sb, "%s() {\n", funcName)
+	fmt.Fprintf(&sb, "\tlocal cmd=%s\n", defaultCommand)
+	sb.WriteString("\tif (( CURRENT > 2 )) && [[ ${words[2]} != -* ]]; then\n\t\tcmd=${words[2]}\n\tfi\n")
+	sb.WriteString("\tif (( CURRENT == 2 )) && [[ ${PREFIX} != -* ]]; then\n")
+	fmt.Fprintf(&sb, "\t\tcompadd -- %s\n\t\treturn\n\tfi\n", strings.Join(commandNames(), " "))
+	sb.WriteString("\tcase ${cmd} in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "\t%s) compadd -- %s ;;\n", cmd.Name, strings.Join(commandFlagNames(cmd), " "))
+	}
+	sb.WriteString("\tesac\n")
+	sb.WriteString("\t_files\n")
+	sb.WriteString("}\n\n")
+	fmt.Fprintf(&sb, "compdef %s %s\n", funcName, prog)
+	return sb.String()
+}
+
+func fishCompletion(prog string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# fish completion for %s\n", prog)
+	names := strings.Join(commandNames(), " ")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "complete -c %s -n \"not __fish_seen_subcommand_from %s\" -a %s -d %q\n", prog, names, cmd.Name, cmd.Usage)
+	}
+	for _, cmd := range commands {
+		condition := fmt.Sprintf("__fish_seen_subcommand_from %s", cmd.Name)
+		if cmd.Name == defaultCommand {
+			condition = fmt.Sprintf("not __fish_seen_subcommand_from %s", names)
+		}
+		cmd.Flags.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&sb, "complete -c %s -n %q -o %s -d %q\n", prog, condition, f.Name, f.Usage)
+		})
+	}
+	return sb.String()
+}
@@ -3,14 +3,15 @@ package main
 import (
 	"fmt"
 	"go/build"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-)
-
-type fileName string
 
-type attribute string
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
 
 // GetDataDir returns the path to the "data" directory used to generate lists.
 // Usage order:
@@ -19,13 +20,13 @@ type attribute string
 // 3. The path to the data directory of project `v2fly/domain-list-community` in GOPATH mode
 func GetDataDir() string {
 	if *dataPath != "" { // Use dataPath option if set by user
-		fmt.Printf("Use domain list files in '%s' directory.\n", *dataPath)
+		ruleset.Logf(slog.LevelInfo, "Use domain list files in '%s' directory.", *dataPath)
 		return *dataPath
 	}
 
 	defaultDataDir := filepath.Join("./", "data")
 	if _, err := os.Stat(defaultDataDir); !os.IsNotExist(err) { // Use "./data" directory if exists
-		fmt.Printf("Use domain list files in '%s' directory.\n", defaultDataDir)
+		ruleset.Logf(slog.LevelInfo, "Use domain list files in '%s' directory.", defaultDataDir)
 		return defaultDataDir
 	}
 
@@ -98,16 +99,53 @@ func GetGOPATH() string {
 	return GOPATH
 }
 
-// isEmpty checks if the rule that has been trimmed out spaces is empty
-func isEmpty(s string) bool {
-	return len(strings.TrimSpace(s)) == 0
+// NewHTTPClient returns the HTTP client used to download remote sources.
+// The proxy option takes precedence over the environment variables.
+// Otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected as usual,
+// with ALL_PROXY as the fallback. Supported schemes are http, https and socks5.
+func NewHTTPClient(proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		proxyURL, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+		return &http.Client{Transport: transport}, nil
+	}
+
+	allProxy := os.Getenv("ALL_PROXY")
+	if allProxy == "" {
+		allProxy = os.Getenv("all_proxy")
+	}
+	if allProxy != "" {
+		allProxyURL, err := parseProxyURL(allProxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := http.ProxyFromEnvironment(req)
+			if err != nil || proxyURL != nil {
+				return proxyURL, err
+			}
+			return allProxyURL, nil
+		}
+	}
+
+	return &http.Client{Transport: transport}, nil
 }
 
-// removeComment removes comments in the rule
-func removeComment(line string) string {
-	idx := strings.Index(line, "#")
-	if idx == -1 {
-		return line
+// parseProxyURL parses a proxy address and checks that its scheme is supported
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxy)
 	}
-	return strings.TrimSpace(line[:idx])
+	return proxyURL, nil
 }
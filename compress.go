@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressors maps the extensions of compressed output variants to the
+// writers compressing into them.
+var compressors = map[string]func(io.Writer) (io.WriteCloser, error){
+	"gz": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	},
+	"zst": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	},
+}
+
+// parseCompressFormats parses the -compress option, eg: `gz,zst`
+func parseCompressFormats(compress string) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(compress, ",") {
+		format = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(format)), ".")
+		if format == "" {
+			continue
+		}
+		if format == "gzip" {
+			format = "gz"
+		}
+		if format == "zstd" {
+			format = "zst"
+		}
+		if compressors[format] == nil {
+			return nil, fmt.Errorf("unknown compression format: %s", format)
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// isCompressedFile reports whether the file is a compressed output variant
+func isCompressedFile(name string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	return compressors[ext] != nil
+}
+
+// CompressFiles writes compressed copies, eg: `geosite.dat.gz`, of the files in
+// the output directory no smaller than minSize bytes, in each of the formats.
+func CompressFiles(outputDir string, formats []string, minSize int64) error {
+	if len(formats) == 0 {
+		return nil
+	}
+	files, err := outputFiles(outputDir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, name := range files {
+		if isCompressedFile(name) || isVerificationFile(name) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(outputDir, name))
+		if err != nil {
+			return err
+		}
+		if info.Size() >= minSize {
+			names = append(names, name)
+		}
+	}
+
+	for _, format := range formats {
+		for _, name := range names {
+			content, err := os.ReadFile(filepath.Join(outputDir, name))
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			writer, err := compressors[format](&buf)
+			if err != nil {
+				return err
+			}
+			if _, err := writer.Write(content); err != nil {
+				return err
+			}
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			if err := ruleset.WriteFile(filepath.Join(outputDir, name+"."+format), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		ruleset.Logf(slog.LevelInfo, "%d files have been compressed successfully into .%s in '%s'.", len(names), format, outputDir)
+	}
+	return nil
+}
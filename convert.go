@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+var (
+	convertFlags          = flag.NewFlagSet("convert", flag.ExitOnError)
+	convertFrom           = convertFlags.String("from", "", "Format of the input rule file, detected from its extension if empty, eg: surge for .list")
+	convertTo             = convertFlags.String("to", "", "Format to convert the rules into, eg: singbox")
+	convertOutput         = convertFlags.String("output", "", "Path to write the converted rule file to, leave empty for the standard output")
+	convertName           = convertFlags.String("name", "", "Name of the rule set in the formats naming it, like Stash, the name of the input file if empty")
+	convertMihomoBehavior = convertFlags.String("mihomobehavior", "", "Behavior of the Mihomo rule provider written, domain or classical")
+)
+
+// runConvert converts a rule file of a client into the format of another
+func runConvert() error {
+	if convertFlags.NArg() != 1 {
+		return errors.New("convert: an input rule file is required, usage: convert -from surge -to singbox input.list")
+	}
+	input := convertFlags.Arg(0)
+
+	from := *convertFrom
+	if from == "" {
+		if from = formatOfFile(input); from == "" {
+			return fmt.Errorf("convert: unknown format of %s, set -from", input)
+		}
+	}
+	from = strings.ToLower(from)
+	to := ruleset.FindExporter(*convertTo)
+	if to == nil {
+		return fmt.Errorf("convert: unknown output format %q", *convertTo)
+	}
+
+	content, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	rules, skipped, err := ruleset.ParseRuleFile(from, content)
+	if err != nil {
+		return fmt.Errorf("convert %s: %w", input, err)
+	}
+	if skipped > 0 {
+		ruleset.Logf(ruleset.LevelNotice, "%s: %d rules that are not domain rules are skipped.", input, skipped)
+	}
+
+	name := *convertName
+	if name == "" {
+		name = filepath.Base(input)
+		if exporter := ruleset.FindExporter(from); exporter != nil && strings.HasSuffix(name, "."+exporter.Extension()) {
+			name = strings.TrimSuffix(name, "."+exporter.Extension())
+		} else {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+	}
+	list := ruleset.NewListInfo()
+	list.Name = ruleset.FileName(strings.ToUpper(name))
+	list.GeoSite = &router.GeoSite{CountryCode: string(list.Name), Domain: rules}
+	switch behavior := ruleset.MihomoBehavior(*convertMihomoBehavior); behavior {
+	case "", ruleset.MihomoDomain, ruleset.MihomoClassical:
+		list.MihomoBehavior = behavior
+	default:
+		return fmt.Errorf("convert: invalid Mihomo behavior %q, want domain or classical", behavior)
+	}
+
+	if *convertOutput == "" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := to.Write(w, list); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	_, err = writeOutputFile(*convertOutput, true, func(w io.Writer) error {
+		return to.Write(w, list)
+	})
+	return err
+}
+
+// formatOfFile returns the built-in format of the extension of a rule file,
+// the longest one matching, eg: mihomotext for `cn.mihomo.txt`, or empty if
+// none matches.
+func formatOfFile(path string) string {
+	var format, extension string
+	for _, exporter := range ruleset.Exporters() {
+		if strings.HasSuffix(path, "."+exporter.Extension()) && len(exporter.Extension()) > len(extension) && ruleset.CanVerify(exporter.Name()) {
+			format, extension = exporter.Name(), exporter.Extension()
+		}
+	}
+	return format
+}
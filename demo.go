@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	demoFlags  = flag.NewFlagSet("demo", flag.ExitOnError)
+	demoPath   = demoFlags.String("path", filepath.Join("./", "testdata", "e2e"), "Path to the end-to-end fixture directory")
+	demoUpdate = demoFlags.Bool("update", false, "Overwrite the golden outputs with the generated ones")
+)
+
+// demoTime is the fixed Last Modified time of the outputs generated by the demo command
+var demoTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// runDemo runs the generate and verify commands against the end-to-end fixture
+// directory and compares the outputs byte by byte with the golden ones.
+//
+// The fixture directory contains:
+//   - data: the data directory
+//   - upstream: the data directory of the `upstream` namespace, sharing list names with data
+//   - snapshots: the snapshots of remote sources, as the demo runs offline
+//   - templates: the templates of custom output formats
+//   - flags: extra flags of the generate command, one per line
+//   - golden: the expected outputs
+func runDemo() error {
+	outputDir, err := os.MkdirTemp("", "rule-set-demo")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outputDir)
+
+	args, err := readFlagsFile(filepath.Join(*demoPath, "flags"))
+	if err != nil {
+		return err
+	}
+	args = append(args,
+		"-datapath", filepath.Join(*demoPath, "data"),
+		"-nsdatapath", "upstream="+filepath.Join(*demoPath, "upstream"),
+		"-snapshotpath", filepath.Join(*demoPath, "snapshots"),
+		"-templates", filepath.Join(*demoPath, "templates"),
+		"-outputpath", outputDir,
+		"-offline",
+	)
+	// The RULESET_ environment variables of the generate flags are not read,
+	// so that the outputs only depend on the fixture directory
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
+
+	ruleset.TimeNow = func() time.Time { return demoTime }
+	if err := runGenerate(); err != nil {
+		return err
+	}
+	if err := runVerify(); err != nil {
+		return err
+	}
+
+	goldenDir := filepath.Join(*demoPath, "golden")
+	if *demoUpdate {
+		if err := os.RemoveAll(goldenDir); err != nil {
+			return err
+		}
+		if err := copyDir(outputDir, goldenDir); err != nil {
+			return err
+		}
+		ruleset.Logf(slog.LevelInfo, "\nGolden outputs have been updated in '%s'.", goldenDir)
+		return nil
+	}
+
+	mismatches, err := compareDirs(goldenDir, outputDir)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	for _, mismatch := range mismatches {
+		fmt.Println("Mismatch:", mismatch)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("demo: %d outputs differ from the golden ones in '%s', run with -update if the changes are expected", len(mismatches), goldenDir)
+	}
+	ruleset.Logf(slog.LevelInfo, "All outputs match the golden ones in '%s'.", goldenDir)
+	return nil
+}
+
+// readFlagsFile reads flags from a file, one per line, skipping empty lines and comments
+func readFlagsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0]); line != "" {
+			args = append(args, line)
+		}
+	}
+	return args, scanner.Err()
+}
+
+// compareDirs returns the files that are missing, unexpected or different
+// in the generated directory compared with the golden directory.
+func compareDirs(goldenDir, generatedDir string) ([]string, error) {
+	goldenFiles, err := listFiles(goldenDir)
+	if err != nil {
+		return nil, err
+	}
+	generatedFiles, err := listFiles(generatedDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	for name := range goldenFiles {
+		if !generatedFiles[name] {
+			mismatches = append(mismatches, name+": not generated")
+		}
+	}
+	for name := range generatedFiles {
+		if !goldenFiles[name] {
+			mismatches = append(mismatches, name+": not in golden outputs")
+			continue
+		}
+		golden, err := os.ReadFile(filepath.Join(goldenDir, name))
+		if err != nil {
+			return nil, err
+		}
+		generated, err := os.ReadFile(filepath.Join(generatedDir, name))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(golden, generated) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: differs from line %d", name, firstDifferentLine(golden, generated)))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches, nil
+}
+
+// firstDifferentLine returns the 1-based number of the first different line
+func firstDifferentLine(a, b []byte) int {
+	aLines, bLines := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	for i := 0; i < len(aLines) && i < len(bLines); i++ {
+		if !bytes.Equal(aLines[i], bLines[i]) {
+			return i + 1
+		}
+	}
+	if len(aLines) < len(bLines) {
+		return len(aLines) + 1
+	}
+	return len(bLines) + 1
+}
+
+// listFiles returns the names of the regular files in a directory
+func listFiles(dir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	files := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[entry.Name()] = true
+		}
+	}
+	return files, nil
+}
+
+// copyDir copies the regular files of a directory into another one
+func copyDir(src, dst string) error {
+	files, err := listFiles(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for name := range files {
+		content, err := os.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dst, name), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestDemo generates the end-to-end fixtures and compares the outputs with
+// the golden ones, run `rule-set demo -update` if the changes are expected.
+func TestDemo(t *testing.T) {
+	*demoPath, *demoUpdate = filepath.Join("testdata", "e2e"), false
+	if err := runDemo(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+var (
+	diffFlags   = flag.NewFlagSet("diff", flag.ExitOnError)
+	diffDatName = diffFlags.String("datname", "geosite.dat", "Name of the dat file in the publish directories, same as the generate command")
+	diffJSON    = diffFlags.Bool("json", false, "Print the differences in JSON instead of the readable form")
+)
+
+// ListDiff is the difference of the rules of a list between two builds.
+type ListDiff struct {
+	List string `json:"list"`
+	// Status is "added" or "removed" for whole lists, or "changed"
+	Status  string   `json:"status"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// runDiff prints the rules added and removed in each list between two dat
+// files, or the dat files of two publish directories.
+func runDiff() error {
+	if diffFlags.NArg() != 2 {
+		return errors.New("diff: two dat files or publish directories are required, usage: diff <before> <after>")
+	}
+	before, err := loadDatRules(diffFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := loadDatRules(diffFlags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diffs := DiffDatRules(before, after)
+	if *diffJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	}
+	for _, diff := range diffs {
+		fmt.Printf("%s (%s): +%d -%d\n", diff.List, diff.Status, len(diff.Added), len(diff.Removed))
+		for _, rule := range diff.Added {
+			fmt.Println("  + " + rule)
+		}
+		for _, rule := range diff.Removed {
+			fmt.Println("  - " + rule)
+		}
+	}
+	fmt.Printf("%d lists changed.\n", len(diffs))
+	return nil
+}
+
+// loadDatRules loads a dat file, or the dat file of a publish directory,
+// into a map of the lowercase list names and their rules in the data syntax.
+func loadDatRules(path string) (map[string][]string, error) {
+	geositeList, err := loadDat(path, *diffDatName)
+	if err != nil {
+		return nil, err
+	}
+	return datRules(geositeList), nil
+}
+
+// datRules returns the lowercase list names and their rules in the data syntax of a dat file
+func datRules(geositeList *router.GeoSiteList) map[string][]string {
+	rules := make(map[string][]string, len(geositeList.GetEntry()))
+	for _, geosite := range geositeList.GetEntry() {
+		name := strings.ToLower(geosite.GetCountryCode())
+		rules[name] = make([]string, 0, len(geosite.GetDomain()))
+		for _, domain := range geosite.GetDomain() {
+			rules[name] = append(rules[name], ruleset.RuleString(domain))
+		}
+	}
+	return rules
+}
+
+// DiffDatRules returns the differences of the lists with changed rules, sorted by list name.
+func DiffDatRules(before, after map[string][]string) []ListDiff {
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	diffs := make([]ListDiff, 0)
+	for _, name := range sortedNames {
+		beforeRules, inBefore := before[name]
+		afterRules, inAfter := after[name]
+		diff := ListDiff{
+			List:    name,
+			Status:  "changed",
+			Added:   missingRules(afterRules, beforeRules),
+			Removed: missingRules(beforeRules, afterRules),
+		}
+		switch {
+		case !inBefore:
+			diff.Status = "added"
+		case !inAfter:
+			diff.Status = "removed"
+		case len(diff.Added) == 0 && len(diff.Removed) == 0:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// missingRules returns the sorted rules of rules that are not in others
+func missingRules(rules, others []string) []string {
+	inOthers := make(map[string]bool, len(others))
+	for _, rule := range others {
+		inOthers[rule] = true
+	}
+	missing := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if !inOthers[rule] && !seen[rule] {
+			seen[rule] = true
+			missing = append(missing, rule)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// publicDNSServers is the maintained list of well-known public DNS resolvers.
+// Plain DNS queries towards them bypass the local resolver and leak the
+// visited domains, so the anti-DNS-leak outputs redirect or block them.
+var publicDNSServers = []string{
+	// Google Public DNS
+	"8.8.8.8/32",
+	"8.8.4.4/32",
+	"2001:4860:4860::8888/128",
+	"2001:4860:4860::8844/128",
+	// Cloudflare
+	"1.1.1.1/32",
+	"1.0.0.1/32",
+	"2606:4700:4700::1111/128",
+	"2606:4700:4700::1001/128",
+	// Quad9
+	"9.9.9.9/32",
+	"149.112.112.112/32",
+	"2620:fe::fe/128",
+	"2620:fe::9/128",
+	// OpenDNS
+	"208.67.222.222/32",
+	"208.67.220.220/32",
+	"2620:119:35::35/128",
+	"2620:119:53::53/128",
+	// AdGuard DNS
+	"94.140.14.14/32",
+	"94.140.15.15/32",
+	"2a10:50c0::ad1:ff/128",
+	"2a10:50c0::ad2:ff/128",
+	// AliDNS
+	"223.5.5.5/32",
+	"223.6.6.6/32",
+	"2400:3200::1/128",
+	"2400:3200:baba::1/128",
+	// DNSPod
+	"119.29.29.29/32",
+	"2402:4e00::/128",
+	// 114DNS
+	"114.114.114.114/32",
+	"114.114.115.115/32",
+	// Baidu DNS
+	"180.76.76.76/32",
+	"2400:da00::6666/128",
+	// CNNIC SDNS
+	"1.2.4.8/32",
+	"210.2.4.8/32",
+}
+
+// DNSLeakHelper generates the anti-DNS-leak outputs: public DNS resolver IPs
+// and, optionally, the domains of DNS-over-HTTPS/TLS endpoints to be blocked.
+type DNSLeakHelper struct {
+	IPs     []string
+	List    *ruleset.ListInfo
+	BaseDir string
+}
+
+// NewDNSLeakHelper creates and returns a new DNSLeakHelper.
+func NewDNSLeakHelper(listinfo *ruleset.ListInfo, baseDir string) *DNSLeakHelper {
+	return &DNSLeakHelper{
+		IPs:     publicDNSServers,
+		List:    listinfo,
+		BaseDir: baseDir,
+	}
+}
+
+// domainRules returns the rules of the DNS-over-HTTPS/TLS endpoints list
+func (h *DNSLeakHelper) domainRules() []*router.Domain {
+	if h.List == nil || h.List.GeoSite == nil {
+		return nil
+	}
+	return h.List.GeoSite.Domain
+}
+
+// Generate writes all anti-DNS-leak output files.
+func (h *DNSLeakHelper) Generate() error {
+	outputs := map[string][]byte{
+		"dns-leak.sgmodule": h.ToSurgeModule(),
+		"dns-leak.json":     h.ToSingBoxRuleSet(),
+		"dns-leak.nft":      h.ToNftables(),
+	}
+	for filename, content := range outputs {
+		if err := ruleset.WriteFile(filepath.Join(h.BaseDir, filename), content); err != nil {
+			return fmt.Errorf("write %s: %w", filename, err)
+		}
+		ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", filename, h.BaseDir)
+	}
+	return nil
+}
+
+// ToSurgeModule converts to a Surge module which hijacks plain DNS towards
+// public resolvers and rejects the DNS-over-HTTPS/TLS endpoints.
+func (h *DNSLeakHelper) ToSurgeModule() []byte {
+	moduleBytes := make([]byte, 0, 1024*16)
+	moduleBytes = append(moduleBytes, []byte("#!name=Anti DNS Leak\n")...)
+	moduleBytes = append(moduleBytes, []byte("#!desc=Generated by https://github.com/caocaocc/rule-set\n")...)
+	moduleBytes = append(moduleBytes, []byte(ruleset.LastModifiedHeader("#", nil, time.RFC1123))...)
+	moduleBytes = append(moduleBytes, []byte(ruleset.SchemaHeader("#")+"\n")...)
+
+	hijacks := make([]string, 0, len(h.IPs))
+	for _, ip := range h.IPs {
+		addr := strings.Split(ip, "/")[0]
+		if strings.Contains(addr, ":") {
+			addr = "[" + addr + "]"
+		}
+		hijacks = append(hijacks, addr+":53")
+	}
+	moduleBytes = append(moduleBytes, []byte("[General]\n")...)
+	moduleBytes = append(moduleBytes, []byte("hijack-dns = %APPEND% "+strings.Join(hijacks, ", ")+"\n\n")...)
+
+	moduleBytes = append(moduleBytes, []byte("[Rule]\n")...)
+	for _, rule := range h.domainRules() {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+		switch rule.Type {
+		case router.Domain_Full:
+			moduleBytes = append(moduleBytes, []byte("DOMAIN,"+ruleVal+",REJECT\n")...)
+		case router.Domain_RootDomain:
+			moduleBytes = append(moduleBytes, []byte("DOMAIN-SUFFIX,"+ruleVal+",REJECT\n")...)
+		}
+	}
+	for _, ip := range h.IPs {
+		prefix := "IP-CIDR"
+		if strings.Contains(ip, ":") {
+			prefix = "IP-CIDR6"
+		}
+		moduleBytes = append(moduleBytes, []byte(prefix+","+ip+",REJECT,no-resolve\n")...)
+	}
+
+	return moduleBytes
+}
+
+// ToSingBoxRuleSet converts to a sing-box rule set matching DNS traffic
+// towards public resolvers and the DNS-over-HTTPS/TLS endpoints.
+func (h *DNSLeakHelper) ToSingBoxRuleSet() []byte {
+	type Rule struct {
+		Domain       []string `json:"domain,omitempty"`
+		DomainSuffix []string `json:"domain_suffix,omitempty"`
+		IPCIDR       []string `json:"ip_cidr,omitempty"`
+		Port         []int    `json:"port,omitempty"`
+	}
+
+	type SingBoxRuleSet struct {
+		Version int    `json:"version"`
+		Rules   []Rule `json:"rules"`
+	}
+
+	ruleSet := SingBoxRuleSet{
+		Version: ruleset.SingBoxVersion,
+		Rules: []Rule{
+			{
+				IPCIDR: h.IPs,
+				Port:   []int{53, 853},
+			},
+		},
+	}
+
+	var domainRule Rule
+	for _, rule := range h.domainRules() {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+		switch rule.Type {
+		case router.Domain_Full:
+			domainRule.Domain = append(domainRule.Domain, ruleVal)
+		case router.Domain_RootDomain:
+			suffix, inDomain := ruleset.SingBoxDomainSuffix(ruleVal)
+			if inDomain {
+				domainRule.Domain = append(domainRule.Domain, ruleVal)
+			}
+			domainRule.DomainSuffix = append(domainRule.DomainSuffix, suffix)
+		}
+	}
+	if len(domainRule.Domain) > 0 || len(domainRule.DomainSuffix) > 0 {
+		ruleSet.Rules = append(ruleSet.Rules, domainRule)
+	}
+
+	jsonBytes, err := json.MarshalIndent(ruleSet, "", "  ")
+	if err != nil {
+		return nil
+	}
+
+	return jsonBytes
+}
+
+// ToNftables converts to an nftables script which rejects plain DNS and
+// DNS-over-TLS traffic towards public resolvers.
+func (h *DNSLeakHelper) ToNftables() []byte {
+	var ipv4, ipv6 []string
+	for _, ip := range h.IPs {
+		if strings.Contains(ip, ":") {
+			ipv6 = append(ipv6, ip)
+		} else {
+			ipv4 = append(ipv4, ip)
+		}
+	}
+
+	nftBytes := make([]byte, 0, 1024*16)
+	nftBytes = append(nftBytes, []byte("#!/usr/sbin/nft -f\n")...)
+	nftBytes = append(nftBytes, []byte("# Generated by https://github.com/caocaocc/rule-set\n")...)
+	nftBytes = append(nftBytes, []byte(ruleset.LastModifiedHeader("#", nil, time.RFC1123))...)
+	nftBytes = append(nftBytes, []byte(ruleset.SchemaHeader("#")+"\n")...)
+	nftBytes = append(nftBytes, []byte("table inet dns_leak {\n")...)
+	nftBytes = append(nftBytes, []byte("\tset public_dns_v4 {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t\telements = { "+strings.Join(ipv4, ", ")+" }\n\t}\n\n")...)
+	nftBytes = append(nftBytes, []byte("\tset public_dns_v6 {\n\t\ttype ipv6_addr\n\t\tflags interval\n\t\telements = { "+strings.Join(ipv6, ", ")+" }\n\t}\n\n")...)
+	nftBytes = append(nftBytes, []byte("\tchain forward {\n\t\ttype filter hook forward priority filter; policy accept;\n")...)
+	nftBytes = append(nftBytes, []byte("\t\tip daddr @public_dns_v4 meta l4proto { tcp, udp } th dport { 53, 853 } reject\n")...)
+	nftBytes = append(nftBytes, []byte("\t\tip6 daddr @public_dns_v6 meta l4proto { tcp, udp } th dport { 53, 853 } reject\n")...)
+	nftBytes = append(nftBytes, []byte("\t}\n}\n")...)
+
+	return nftBytes
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+const (
+	// dryRunDiffContext is the number of unchanged lines around the changes in unified diffs
+	dryRunDiffContext = 3
+	// dryRunMaxEdits is the number of edits above which a text file is diffed as
+	// replaced as a whole, as the diff takes quadratic memory in the number of edits
+	dryRunMaxEdits = 2000
+)
+
+// DryRunFile is a generated file compared with the same file in the output path.
+type DryRunFile struct {
+	Name string
+	// Status is "create", "change" or "unchanged"
+	Status string
+	// Binary is true if either version is not text, so there are no line counts
+	Binary  bool
+	Added   int
+	Removed int
+	// before and after are the lines of text files, and edits the diff of them
+	before, after []string
+	edits         []diffEdit
+}
+
+// runDryRun generates all the files in a temporary directory, then prints
+// which files in the output path would be created or changed, and optionally
+// their unified diffs, without writing anything to the output path or the
+// state files of the remote sources, the resolved IPs and the changelog.
+func runDryRun() error {
+	outputDir := *outputPath
+	tmpDir, err := os.MkdirTemp("", "rule-set-dryrun")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Leave out the messages of generating the files in the temporary directory
+	logger := ruleset.Logger
+	if !verbose {
+		if ruleset.Logger, err = ruleset.NewLogger(os.Stdout, ruleset.LevelNotice, logFormat); err != nil {
+			return err
+		}
+	}
+	*outputPath = tmpDir
+	started := time.Now()
+	err = runGenerate()
+	*outputPath, ruleset.Logger = outputDir, logger
+	if err != nil {
+		return err
+	}
+	logTimings(time.Since(started))
+
+	files, err := CompareOutputs(tmpDir, outputDir)
+	if err != nil {
+		return err
+	}
+	printDryRun(os.Stdout, files, outputDir, *dryRunDiff)
+	return nil
+}
+
+// CompareOutputs compares the files generated in dir with the ones in outputDir.
+func CompareOutputs(dir, outputDir string) ([]*DryRunFile, error) {
+	var files []*DryRunFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		before, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		file := &DryRunFile{Name: filepath.ToSlash(name), Binary: !isText(after) || !isText(before)}
+		switch {
+		case os.IsNotExist(err):
+			file.Status = "create"
+		case bytes.Equal(before, after):
+			file.Status = "unchanged"
+		default:
+			file.Status = "change"
+		}
+		if file.Status != "unchanged" && !file.Binary {
+			file.before, file.after = splitLines(before), splitLines(after)
+			file.edits = diffLines(file.before, file.after)
+			for _, edit := range file.edits {
+				switch edit.op {
+				case '+':
+					file.Added++
+				case '-':
+					file.Removed++
+				}
+			}
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// printDryRun prints the summary of the compared files, and the unified diffs
+// of the text files that would be created or changed if showDiff is true.
+func printDryRun(w io.Writer, files []*DryRunFile, outputDir string, showDiff bool) {
+	counts := make(map[string]int)
+	fmt.Fprintf(w, "Dry run, nothing has been written to '%s':\n", outputDir)
+	for _, file := range files {
+		counts[file.Status]++
+		switch {
+		case file.Status == "unchanged":
+			fmt.Fprintf(w, "  unchanged     %s\n", file.Name)
+		case file.Binary:
+			fmt.Fprintf(w, "  would %-7s %s (binary)\n", file.Status, file.Name)
+		case file.Status == "create":
+			fmt.Fprintf(w, "  would create  %s: %d lines\n", file.Name, file.Added)
+		default:
+			fmt.Fprintf(w, "  would change  %s: +%d -%d lines\n", file.Name, file.Added, file.Removed)
+		}
+	}
+	fmt.Fprintf(w, "%d files would be created, %d changed, %d unchanged.\n", counts["create"], counts["change"], counts["unchanged"])
+
+	if !showDiff {
+		return
+	}
+	for _, file := range files {
+		if file.Status != "unchanged" && !file.Binary {
+			fmt.Fprintln(w)
+			writeUnifiedDiff(w, file)
+		}
+	}
+}
+
+// isText reports whether content is UTF-8 text without NUL bytes
+func isText(content []byte) bool {
+	return utf8.Valid(content) && bytes.IndexByte(content, 0) == -1
+}
+
+// splitLines splits content into lines without the line breaks
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// diffEdit is a line of a diff, with op ' ' for unchanged lines,
+// '-' for removed and '+' for added ones, and their indexes in each version.
+type diffEdit struct {
+	op   byte
+	a, b int
+}
+
+// diffLines returns the shortest edit script from a to b by the Myers algorithm,
+// after leaving out the common prefix and suffix.
+func diffLines(a, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, diffEdit{' ', i, i})
+	}
+	edits = append(edits, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, diffEdit{' ', len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return edits
+}
+
+// myersDiff returns the edit script from a to b, whose lines start at offset
+func myersDiff(a, b []string, offset int) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > dryRunMaxEdits {
+		max = dryRunMaxEdits
+	}
+
+	// v is the furthest x on each diagonal k at v[center+k], and trace[d]
+	// is a copy of the diagonals -d..d of it after d edits
+	center := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[center+k-1] < v[center+k+1]) {
+				x = v[center+k+1]
+			} else {
+				x = v[center+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[center+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[center-d:center+d+1]...))
+	}
+
+	if !found {
+		// Too many edits, diff as replaced as a whole
+		edits := make([]diffEdit, 0, n+m)
+		for i := range a {
+			edits = append(edits, diffEdit{'-', offset + i, offset})
+		}
+		for j := range b {
+			edits = append(edits, diffEdit{'+', offset + n, offset + j})
+		}
+		return edits
+	}
+
+	// Backtrack from the end, through the snakes and the edit of each step
+	var reversed []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			reversed = append(reversed, diffEdit{' ', offset + x, offset + y})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, diffEdit{'+', offset + x, offset + y})
+		} else {
+			x--
+			reversed = append(reversed, diffEdit{'-', offset + x, offset + y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		reversed = append(reversed, diffEdit{' ', offset + x, offset + y})
+	}
+
+	edits := make([]diffEdit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
+
+// writeUnifiedDiff writes the unified diff of a file that would be created or changed
+func writeUnifiedDiff(w io.Writer, file *DryRunFile) {
+	if file.Status == "create" {
+		fmt.Fprintf(w, "--- /dev/null\n+++ b/%s\n", file.Name)
+	} else {
+		fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", file.Name, file.Name)
+	}
+
+	edits := file.edits
+	for start := 0; start < len(edits); {
+		// Find the next change, and the end of the hunk with the changes
+		// separated by no more than twice the context
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for i := first; i < len(edits) && i-last <= 2*dryRunDiffContext; i++ {
+			if edits[i].op != ' ' {
+				last = i
+			}
+		}
+		from := first - dryRunDiffContext
+		if from < start {
+			from = start
+		}
+		to := last + dryRunDiffContext + 1
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		var lines strings.Builder
+		var aCount, bCount int
+		for _, edit := range edits[from:to] {
+			switch edit.op {
+			case ' ':
+				lines.WriteString(" " + file.before[edit.a] + "\n")
+				aCount, bCount = aCount+1, bCount+1
+			case '-':
+				lines.WriteString("-" + file.before[edit.a] + "\n")
+				aCount++
+			case '+':
+				lines.WriteString("+" + file.after[edit.b] + "\n")
+				bCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n%s", hunkRange(edits[from].a, aCount), hunkRange(edits[from].b, bCount), lines.String())
+		start = to
+	}
+}
+
+// hunkRange returns the range of a hunk in a unified diff, from the 0-based start line
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
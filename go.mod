@@ -5,7 +5,11 @@ go 1.21
 toolchain go1.21.10
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/klauspost/compress v1.17.11
 	github.com/v2fly/v2ray-core/v5 v5.16.1
+	golang.org/x/crypto v0.22.0
+	golang.org/x/net v0.24.0
 	google.golang.org/protobuf v1.34.2
 )
 
@@ -13,4 +17,5 @@ require (
 	github.com/adrg/xdg v0.4.0 // indirect
 	github.com/golang/protobuf v1.5.4 // indirect
 	golang.org/x/sys v0.19.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	"google.golang.org/protobuf/proto"
+)
+
+// IncrementalState persists the hashes of the inputs and the outputs of
+// exported lists between runs, so that the outputs of the lists unchanged
+// since the last run are not generated again.
+type IncrementalState struct {
+	Path  string
+	Lists map[string]ListHashes
+}
+
+// ListHashes are the hashes of an exported list in the incremental state.
+type ListHashes struct {
+	// Input is the hash of the flattened rules, the policy and the generator
+	Input string `json:"input"`
+	// Outputs maps the names of the generated files to their hashes
+	Outputs map[string]string `json:"outputs"`
+}
+
+// LoadIncrementalState loads the incremental state from a file,
+// starting with an empty state if the file does not exist.
+func LoadIncrementalState(path string) (*IncrementalState, error) {
+	state := &IncrementalState{Path: path, Lists: make(map[string]ListHashes)}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &state.Lists); err != nil {
+		return nil, fmt.Errorf("invalid incremental state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Unchanged reports whether the input of a list is the same as the last run,
+// and all of its generated files are still the same in the output directory.
+func (s *IncrementalState) Unchanged(name string, listinfo *ruleset.ListInfo, formats, outputDir string) bool {
+	last, ok := s.Lists[name]
+	if !ok || len(last.Outputs) == 0 || last.Input != inputHash(listinfo, formats) {
+		return false
+	}
+	for file, hash := range last.Outputs {
+		if actual, err := fileHash(filepath.Join(outputDir, file)); err != nil || actual != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// Update records the input of a list and the hashes of its generated files.
+func (s *IncrementalState) Update(name string, listinfo *ruleset.ListInfo, formats, outputDir string, files []string) error {
+	hashes := ListHashes{Input: inputHash(listinfo, formats), Outputs: make(map[string]string, len(files))}
+	for _, file := range files {
+		hash, err := fileHash(filepath.Join(outputDir, file))
+		if err != nil {
+			return err
+		}
+		hashes.Outputs[file] = hash
+	}
+	s.Lists[name] = hashes
+	return nil
+}
+
+// Save writes the incremental state to its file.
+func (s *IncrementalState) Save() error {
+	content, err := json.MarshalIndent(s.Lists, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ruleset.WriteFile(s.Path, content)
+}
+
+// inputHash returns the hash of everything the outputs of a list depend on:
+// the flattened rules with their transitive includes, the policy and the Mihomo behavior of the list,
+// the output formats and their excluded attributes, layout, file names, headers with their time zone and time layout, build metadata, the output schema version and the version of the generator itself.
+func inputHash(listinfo *ruleset.ListInfo, formats string) string {
+	hash := sha256.New()
+	if geositeBytes, err := (proto.MarshalOptions{Deterministic: true}).Marshal(listinfo.GeoSite); err == nil {
+		hash.Write(geositeBytes)
+	}
+
+	ruleTypes := make([]string, 0, len(listinfo.Policy))
+	for ruleType := range listinfo.Policy {
+		ruleTypes = append(ruleTypes, ruleType)
+	}
+	sort.Strings(ruleTypes)
+	for _, ruleType := range ruleTypes {
+		fmt.Fprintf(hash, "\npolicy %s=%s", ruleType, listinfo.Policy[ruleType])
+	}
+
+	if len(formatExcludeAttrs) > 0 {
+		fmt.Fprintf(hash, "\nformatexcludeattrs %s", formatExcludeAttrs)
+	}
+	if listinfo.MihomoBehavior != "" {
+		fmt.Fprintf(hash, "\nmihomo %s", listinfo.MihomoBehavior)
+	}
+	if *layout != layoutFlat {
+		fmt.Fprintf(hash, "\nlayout %s", *layout)
+	}
+	if ruleset.NoHeaders {
+		fmt.Fprintf(hash, "\nnoheader")
+	} else if ruleset.HeaderTemplate != nil {
+		fmt.Fprintf(hash, "\nheader %s", ruleset.HeaderTemplate.Root)
+	}
+	if ruleset.HeaderLocation != nil {
+		fmt.Fprintf(hash, "\ntimezone %s", ruleset.HeaderLocation)
+	}
+	if ruleset.HeaderTimeLayout != "" {
+		fmt.Fprintf(hash, "\ntimefmt %s", ruleset.HeaderTimeLayout)
+	}
+	if ruleset.BuildInfo != "" {
+		fmt.Fprintf(hash, "\nbuild %s", ruleset.BuildInfo)
+	}
+	if ruleset.SingBoxVersion != 2 {
+		fmt.Fprintf(hash, "\nsingboxversion %d", ruleset.SingBoxVersion)
+	}
+	if *fileNameTemplate != "{name}.{ext}" {
+		fmt.Fprintf(hash, "\nfilename %s", *fileNameTemplate)
+	}
+
+	fmt.Fprintf(hash, "\nformats %s\nschema %d\ngenerator %s", formats, *schemaVersion, generatorVersion())
+	if *chunkRules > 0 || *chunkBytes > 0 {
+		fmt.Fprintf(hash, "\nchunks %d %d", *chunkRules, *chunkBytes)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// generatorVersion returns the module version and VCS revision of the
+// running binary, so that outputs are generated again after upgrades.
+func generatorVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	version := []string{info.Main.Version}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.modified":
+			version = append(version, setting.Value)
+		}
+	}
+	return strings.Join(version, " ")
+}
+
+func fileHash(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
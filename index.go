@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+const (
+	indexFileName = "index.html"
+	// indexJSONFileName is the name of the index of the URLs of the files for programs
+	indexJSONFileName = "index.json"
+)
+
+// indexTemplate is the page summarizing the generated files of the publish directory
+var indexTemplate = template.Must(template.New(indexFileName).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>rule-set</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 72em; padding: 0 1em; color: #1f2328; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border-bottom: 1px solid #d0d7de; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+td.number { text-align: right; }
+code { font-size: 0.85em; }
+button { font-size: 0.75em; margin-left: 0.3em; cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>rule-set</h1>
+{{- if .GeneratedAt}}
+<p>Generated at {{.GeneratedAt}}.</p>
+{{- end}}
+<h2>Lists</h2>
+<table>
+<tr><th>List</th><th>Rules</th><th>Last Modified</th><th>Files</th></tr>
+{{- range .Lists}}
+<tr>
+<td>{{.Name}}</td>
+<td class="number">{{.Rules}}</td>
+<td>{{.ModifiedAt}}</td>
+<td>
+{{- range .Files}}
+<div><a href="{{.Name}}">{{.Name}}</a> <button data-url="{{.RawURL}}">Copy raw URL</button><button data-url="{{.CDNURL}}">Copy jsDelivr URL</button></div>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+<h2>Other files</h2>
+<table>
+<tr><th>File</th><th>Size</th><th>Last Modified</th><th>URLs</th></tr>
+{{- range .Others}}
+<tr>
+<td><a href="{{.Name}}">{{.Name}}</a></td>
+<td class="number">{{.Size}}</td>
+<td>{{.ModifiedAt}}</td>
+<td><button data-url="{{.RawURL}}">Copy raw URL</button><button data-url="{{.CDNURL}}">Copy jsDelivr URL</button></td>
+</tr>
+{{- end}}
+</table>
+<script>
+document.querySelectorAll("button[data-url]").forEach(function (button) {
+  button.addEventListener("click", function () {
+    navigator.clipboard.writeText(button.dataset.url);
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// indexPage is the data of indexTemplate
+type indexPage struct {
+	GeneratedAt string
+	Lists       []*indexList
+	Others      []indexFile
+}
+
+type indexList struct {
+	Name       string
+	Rules      int
+	ModifiedAt string
+	Files      []indexFile
+}
+
+type indexFile struct {
+	Name       string
+	Size       int64
+	ModifiedAt string
+	RawURL     string
+	CDNURL     string
+}
+
+// indexExport is the exported list and the format of a file of the list
+type indexExport struct {
+	List   string
+	Format string
+}
+
+// IndexJSON is the index of the URLs of the generated files, for the programs
+// generating client configs to find the files of the lists in each format.
+type IndexJSON struct {
+	SchemaVersion int        `json:"schema_version"`
+	GeneratedAt   *time.Time `json:"generated_at,omitempty"`
+	// Lists maps the exported lists to their files by format, more than one
+	// for the lists split into chunks
+	Lists map[string]map[string][]IndexJSONFile `json:"lists"`
+	// Files are the other files, eg: geosite.dat
+	Files []IndexJSONFile `json:"files"`
+}
+
+// IndexJSONFile is a file in index.json, with its URLs under -rawurl and
+// -cdnurl, left out if they are empty.
+type IndexJSONFile struct {
+	Name   string `json:"name"`
+	RawURL string `json:"raw_url,omitempty"`
+	CDNURL string `json:"cdn_url,omitempty"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// fileURL returns the URL of a file under the base URL, or empty if it is empty
+func fileURL(baseURL, name string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + name
+}
+
+// GenerateIndex writes index.html summarizing the generated files, with the
+// rule counts of the lists and the URLs of the files under the base URLs, and
+// index.json of the URLs of the files of the exported lists by format, where
+// exports maps the names of the files to their lists and formats.
+func GenerateIndex(outputDir string, stats *Stats, exports map[string]indexExport, rawURL, cdnURL string) error {
+	page := indexPage{GeneratedAt: formatIndexTime(stats.GeneratedAt)}
+	index := IndexJSON{
+		SchemaVersion: *schemaVersion,
+		GeneratedAt:   stats.GeneratedAt,
+		Lists:         make(map[string]map[string][]IndexJSONFile),
+		Files:         make([]IndexJSONFile, 0),
+	}
+	lists := make(map[string]*indexList)
+	for _, fileStats := range stats.Files {
+		file := indexFile{
+			Name:       fileStats.Name,
+			Size:       fileStats.Size,
+			ModifiedAt: formatIndexTime(fileStats.ModifiedAt),
+			RawURL:     fileURL(rawURL, fileStats.Name),
+			CDNURL:     fileURL(cdnURL, fileStats.Name),
+		}
+		jsonFile := IndexJSONFile{Name: file.Name, RawURL: file.RawURL, CDNURL: file.CDNURL, SHA256: fileStats.SHA256, Size: file.Size}
+		if export, ok := exports[fileStats.Name]; ok {
+			if index.Lists[export.List] == nil {
+				index.Lists[export.List] = make(map[string][]IndexJSONFile)
+			}
+			index.Lists[export.List][export.Format] = append(index.Lists[export.List][export.Format], jsonFile)
+		} else {
+			index.Files = append(index.Files, jsonFile)
+		}
+		// Files generated from more than one list, eg: geosite.dat, are not of a list
+		if len(fileStats.Lists) != 1 {
+			page.Others = append(page.Others, file)
+			continue
+		}
+
+		list := lists[fileStats.Lists[0]]
+		if list == nil {
+			list = &indexList{Name: fileStats.Lists[0]}
+			for _, count := range fileStats.Rules {
+				list.Rules += count
+			}
+			lists[list.Name] = list
+			page.Lists = append(page.Lists, list)
+		}
+		if file.ModifiedAt > list.ModifiedAt {
+			list.ModifiedAt = file.ModifiedAt
+		}
+		list.Files = append(list.Files, file)
+	}
+	sort.Slice(page.Lists, func(i, j int) bool { return page.Lists[i].Name < page.Lists[j].Name })
+
+	var buf bytes.Buffer
+	if err := indexTemplate.Execute(&buf, page); err != nil {
+		return err
+	}
+	if err := ruleset.WriteFile(filepath.Join(outputDir, indexFileName), buf.Bytes()); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", indexFileName, outputDir)
+
+	indexBytes, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ruleset.WriteFile(filepath.Join(outputDir, indexJSONFileName), indexBytes); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", indexJSONFileName, outputDir)
+	return nil
+}
+
+// formatIndexTime formats the time in a sortable layout, or returns empty if nil
+func formatIndexTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// Layouts of the files of the exported lists in the output directory
+const (
+	// layoutFlat puts the files of all formats in the output directory, eg: `cn.list`
+	layoutFlat = "flat"
+	// layoutFormat puts the files of each format in a directory named after
+	// the format, eg: `surge/cn.list`
+	layoutFormat = "format"
+)
+
+// checkLayout checks the -layout option
+func checkLayout(layout string) error {
+	switch layout {
+	case layoutFlat, layoutFormat:
+		return nil
+	}
+	return fmt.Errorf("unknown layout %q, want %s or %s", layout, layoutFlat, layoutFormat)
+}
+
+// formatDir returns the directory of the files of the format, relative to the
+// output directory, which is the output directory itself in flat layout.
+func formatDir(format ruleset.Exporter) string {
+	if *layout == layoutFormat {
+		return format.Name()
+	}
+	return ""
+}
+
+// checkFileNameTemplate checks the -filename option, which must have the name
+// of the list in either case and the extension of the format.
+func checkFileNameTemplate(template string) error {
+	if (!strings.Contains(template, "{name}") && !strings.Contains(template, "{NAME}")) || !strings.Contains(template, "{ext}") {
+		return fmt.Errorf("invalid file name template %q, want {name} or {NAME}, and {ext}", template)
+	}
+	return nil
+}
+
+// exportedFileName returns the slash separated path of the file of an exported
+// list or chunk in the format, relative to the output directory, named by the
+// -filename template, eg: `geosite-cn.json` of `geosite-{name}.{ext}`.
+func exportedFileName(name string, format ruleset.Exporter) string {
+	fileName := strings.NewReplacer(
+		"{name}", name,
+		"{NAME}", strings.ToUpper(name),
+		"{ext}", format.Extension(),
+		"{format}", format.Name(),
+	).Replace(*fileNameTemplate)
+	return path.Join(formatDir(format), fileName)
+}
+
+// outputFiles returns the sorted slash separated paths of the files in the
+// output directory and its directories, relative to it, eg: `surge/cn.list`.
+func outputFiles(outputDir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	lintFlags       = flag.NewFlagSet("lint", flag.ExitOnError)
+	lintDataPath    = lintFlags.String("datapath", "./data", "Path to the 'data' directory to be linted, separated by ',' comma for overlay directories, same as the generate command")
+	lintExportLists = lintFlags.String("exportlists", defaultExportLists, "Exported lists, which are referenced even if not included by any list, same as the generate command")
+	lintToGFWList   = lintFlags.String("togfwlist", "geolocation-!cn", "Lists exported in GFWList format, same as the generate command")
+)
+
+// runLint checks the data directory without writing any output files.
+func runLint() error {
+	listInfoMap, err := ruleset.Parse(ruleset.OverlayDataSources(*lintDataPath), ruleset.ConflictError)
+	if err != nil {
+		return &dataError{err}
+	}
+	if err := listInfoMap.CheckInclusions(); err != nil {
+		return &dataError{err}
+	}
+
+	var referenced []string
+	for _, list := range strings.Split(*lintExportLists+","+*lintToGFWList, ",") {
+		if list = strings.TrimSpace(list); list != "" {
+			referenced = append(referenced, list)
+		}
+	}
+
+	issues := listInfoMap.Lint(referenced)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("lint: %d issues found in '%s'", len(issues), *lintDataPath)
+	}
+	ruleset.Logf(slog.LevelInfo, "No issues found in '%s'.", *lintDataPath)
+	return nil
+}
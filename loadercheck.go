@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/v2fly/v2ray-core/v5/common/platform/filesystem"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/geodata"
+	_ "github.com/v2fly/v2ray-core/v5/infra/conf/geodata/memconservative"
+	_ "github.com/v2fly/v2ray-core/v5/infra/conf/geodata/standard"
+)
+
+// datLoaders are the geodata loaders of v2ray-core the dat file is checked
+// with: the standard one unmarshaling the whole file, and the memory
+// conservative one decoding only the entry of a list in place, like Xray.
+var datLoaders = []string{"standard", "memconservative"}
+
+// checkDatLoaders loads the lists from the dat file with the geodata loaders
+// of v2ray-core, as the `geosite:<list>` references of a config would, and
+// fails if the file cannot be read, a list is missing or the loaders disagree
+// on its rules.
+func checkDatLoaders(datPath string, lists []string) error {
+	// The loaders look up the file in the asset directories of V2Ray, which
+	// may have an installed one, so the checked file is opened instead
+	newFileReader, newFileSeeker := filesystem.NewFileReader, filesystem.NewFileSeeker
+	filesystem.NewFileReader = func(string) (io.ReadCloser, error) { return os.Open(datPath) }
+	filesystem.NewFileSeeker = func(string) (io.ReadSeekCloser, error) { return os.Open(datPath) }
+	defer func() { filesystem.NewFileReader, filesystem.NewFileSeeker = newFileReader, newFileSeeker }()
+
+	loaders := make([]geodata.Loader, 0, len(datLoaders))
+	for _, name := range datLoaders {
+		loader, err := geodata.GetGeoDataLoader(name)
+		if err != nil {
+			return err
+		}
+		loaders = append(loaders, loader)
+	}
+
+	var errs []error
+	for _, list := range lists {
+		rules := -1
+		for i, loader := range loaders {
+			domains, err := loader.LoadGeoSiteWithAttr(filepath.Base(datPath), list)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("geosite:%s: %s loader: %w", list, datLoaders[i], err))
+			case rules != -1 && len(domains) != rules:
+				errs = append(errs, fmt.Errorf("geosite:%s: %s loader: %d rules loaded, %d by the %s loader", list, datLoaders[i], len(domains), rules, datLoaders[0]))
+			default:
+				rules = len(domains)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s cannot be loaded by V2Ray: %w", filepath.Base(datPath), errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// The logging flags shared by all commands
+var (
+	verbose   bool
+	quiet     bool
+	logFormat string
+)
+
+// addLogFlags adds the logging flags to the flags of a command
+func addLogFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verbose, "v", false, "Verbose, also log debug messages like the rule counts and timing of each list")
+	fs.BoolVar(&quiet, "quiet", false, "Quiet, only log notices, warnings and errors, leaving out the messages of each generated file, but not the summary at the end")
+	fs.StringVar(&logFormat, "logformat", ruleset.LogFormatText, "Format of log messages: text, or json for a JSON object per line to be parsed by CI systems")
+}
+
+// setupLogger sets the logger of the program and the ruleset package by the logging flags
+func setupLogger() error {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = ruleset.LevelNotice
+	}
+	logger, err := ruleset.NewLogger(os.Stdout, level, logFormat)
+	if err != nil {
+		return err
+	}
+	ruleset.Logger = logger
+	return nil
+}
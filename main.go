@@ -1,203 +1,914 @@
 package main
 
 import (
+	"bufio"
 	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	defaultExportLists  = "cdn,cn,geolocation-cn,geolocation-!cn,private,apple,icloud,google,steam,bilibili,paypal,openai,netflix,tiktok,category-ai-chat-!cn,category-media"
+	defaultExcludeAttrs = "cn@!cn@ads,geolocation-cn@!cn@ads,geolocation-!cn@cn@ads"
+)
+
 var (
-	dataPath     = flag.String("datapath", filepath.Join("./", "data"), "Path to your custom 'data' directory")
-	datName      = flag.String("datname", "geosite.dat", "Name of the generated dat file")
-	outputPath   = flag.String("outputpath", "./publish", "Output path to the generated files")
-	exportLists  = flag.String("exportlists", "cdn,cn,geolocation-cn,geolocation-!cn,private,apple,icloud,google,steam,bilibili,paypal,openai,netflix,tiktok,category-ai-chat-!cn,category-media", "Lists to be exported in plaintext format, separated by ',' comma")
-	excludeAttrs = flag.String("excludeattrs", "cn@!cn@ads,geolocation-cn@!cn@ads,geolocation-!cn@cn@ads", "Exclude rules with certain attributes in certain lists, seperated by ',' comma, support multiple attributes in one list. Example: geolocation-!cn@cn@ads,geolocation-cn@!cn")
-	toGFWList    = flag.String("togfwlist", "geolocation-!cn", "List to be exported in GFWList format")
+	dataPath            = flag.String("datapath", filepath.Join("./", "data"), "Path to your custom 'data' directory, separated by ',' comma for multiple directories where later ones overlay earlier ones. Example: ./upstream/data,./patches")
+	nsDataPath          = flag.String("nsdatapath", "", "Namespaced data directories merged with the local one, in 'namespace=path' pairs separated by ',' comma. Example: upstream=./domain-list-community/data")
+	conflict            = flag.String("conflict", ruleset.ConflictError, "Policy for lists defined more than once: merge, prefer-local or error")
+	lenient             = flag.Bool("lenient", false, "Skip invalid regexp rules with a warning instead of failing")
+	keepGoing           = flag.Bool("keepgoing", false, "Skip the lists with errors, and the lists including them, generating the others, then fail with a report of all errors")
+	domainCheck         = flag.String("domaincheck", ruleset.DomainCheckOff, "Validate full and domain rules against the Public Suffix List and RFC 1035: off, report to warn, or strict to fail")
+	sortOrder           = flag.String("sort", ruleset.SortFullBeforeSuffix, "Order of the rules in the generated lists of all formats: full-before-suffix, source-order as in the data files, alphabetical, or label-count for the shortest domains first")
+	datName             = flag.String("datname", "geosite.dat", "Name of the generated dat file")
+	tldListURL          = flag.String("tldlisturl", ruleset.TLDListURL, "URL of the IANA list of top-level domains expanded by tld rules, downloaded once per run and cached as a snapshot")
+	geositeDBName       = flag.String("geositedb", "", "Name of the geosite.db file generated from the dat file for legacy sing-box versions, leave empty to skip. Example: geosite.db")
+	listDats            = flag.Bool("listdats", false, "Also export a dat file of the single entry of each exported list, like cn.dat, for clients loading one list, in the dat format of -export")
+	checkLoaders        = flag.Bool("checkloaders", false, "Check that the dat file can be read by the geodata loaders of V2Ray, and that the exported lists in it can be loaded as geosite:<list> references, failing otherwise")
+	outputPath          = flag.String("outputpath", "./publish", "Output path to the generated files")
+	exportLists         = flag.String("exportlists", defaultExportLists, "Lists to be exported in plaintext format, separated by ',' comma")
+	excludeAttrs        = flag.String("excludeattrs", defaultExcludeAttrs, "Exclude rules with certain attributes in certain lists, seperated by ',' comma, support multiple attributes in one list. Example: geolocation-!cn@cn@ads,geolocation-cn@!cn")
+	includeAttrs        = flag.String("includeattrs", "", "Keep only rules with certain attributes in certain lists, seperated by ',' comma, support multiple attributes in one list. Example: geolocation-cn@cn")
+	tranco              = flag.String("tranco", "", "URL or path of the Tranco list ranking domains by popularity, in rank,domain CSV format or a zip of it, for the ranks in stats.json and -litelists, leave empty to skip. Example: https://tranco-list.eu/top-1m.csv.zip")
+	liteLists           = flag.String("litelists", "", "Lists to also export as lite variants with only the rules of the top -literank domains of the -tranco list, like geolocation-!cn-lite, separated by ',' comma")
+	liteRank            = flag.Int("literank", 1000000, "Lowest rank in the -tranco list of the domains kept in the lite variants of lists")
+	chunkRules          = flag.Int("chunkrules", 0, "Split the files of the exported lists with more rules into numbered chunks, like geolocation-!cn.part1.yaml, the same in all formats, or 0 for no limit")
+	chunkBytes          = flag.Int64("chunkbytes", 0, "Split the files of the exported lists larger than this many bytes in any format into numbered chunks, or 0 for no limit")
+	exportAttrs         = flag.String("exportattrs", "", "Export sub-lists of lists with certain attributes, like cn@ads.txt, separated by ',' comma, support multiple attributes in one list, or all attributes if none. Example: cn@ads@!cn,geolocation-!cn")
+	mihomoBehavior      = flag.String("mihomobehavior", "", "Behaviors of the Mihomo rule providers of lists and IP sets, domain or classical for lists and ipcidr or classical for IP sets, separated by ',' comma. Example: cn=classical,telegram=classical")
+	listPolicy          = flag.String("listpolicy", "", "Policies of lists in Quantumult X, Surge, Stash and V2Ray outputs keyed by rule type, separated by ',' comma. Example: category-ads-all@full=reject-img@domain=reject-dict,cn@*=direct")
+	toGFWList           = flag.String("togfwlist", "geolocation-!cn", "Lists to be exported in GFWList format, separated by ',' comma, into gfwlist-<list>.txt each and merged into gfwlist.txt if several")
+	gfwlistExceptAttr   = flag.String("gfwlistexceptattr", "", "Attribute of the rules to be exported as exception rules in GFWList format, eg: whitelist")
+	gfwlistExceptList   = flag.String("gfwlistexceptlist", "", "List whose rules are exported as exception rules in GFWList format")
+	gfwlistUserRules    = flag.String("gfwlistuserrules", "", "Path to a file of rules in AutoProxy syntax appended verbatim to gfwlist.txt, like the user-rules.txt of GFWList clients, leave empty to skip")
+	sourceSHA256        = flag.String("sourcesha256", "", "Expected SHA-256 of remote sources, in 'url=sha256' pairs separated by ',' comma")
+	resolveLists        = flag.String("resolvelists", "", "Lists to be resolved by DNS into heuristic IP sets, separated by ',' comma")
+	resolvers           = flag.String("resolvers", "8.8.8.8,1.1.1.1,223.5.5.5", "DNS servers used to resolve lists, separated by ',' comma")
+	resolveState        = flag.String("resolvestate", "./resolve-state.json", "Path to the file persisting resolved IPs between runs")
+	resolveWindow       = flag.Duration("resolvewindow", 7*24*time.Hour, "How long a resolved IP is kept after it was last seen")
+	resolveWiden        = flag.Bool("resolvewiden", false, "Widen the resolved IPs to their /24 and /48 networks, which may include the addresses of other hosts, instead of the exact IPs")
+	simplifyRegexps     = flag.Bool("simplifyregexp", false, "Rewrite regexp rules that are effectively full or domain matches into full or domain rules, eg: ^.*\\.example\\.com$ into domain:example.com")
+	checksumFiles       = flag.Bool("sha256files", false, "Also generate a .sha256 checksum file for each generated file besides sha256sum.txt")
+	changelogPath       = flag.String("changelog", "", "Path to write the Markdown changelog of the lists changed since the last run to, leave empty to skip")
+	changelogState      = flag.String("changelogstate", filepath.Join("./", "changelog-state.json"), "Path to the hashes of the rules of the last run, for the changelog")
+	debugPath           = flag.String("debugpath", "", "Path to write the lists annotated with the data file, the line and the includes of each rule to, with sourcemap.json of them, leave empty to skip")
+	compress            = flag.String("compress", "", "Compression formats of the pre-compressed copies of large generated files, separated by ',' comma, gz or zst. Example: gz,zst")
+	compressMinSize     = flag.Int64("compressminsize", 64*1024, "Minimum size in bytes of the generated files to be compressed")
+	minisignKeyPath     = flag.String("minisignkey", "", "Path to the minisign secret key to sign the generated files with, or the key itself in the MINISIGN_SECRET_KEY env, with its password in the MINISIGN_PASSWORD env")
+	pgpKeyID            = flag.String("pgpkey", "", "ID of the key in the gpg keyring to sign the generated files with")
+	rawURL              = flag.String("rawurl", "https://raw.githubusercontent.com/caocaocc/rule-set/release/", "Base URL of the raw files of the publish directory, used in index.html, index.json and the sing-box route, leave empty for local rule sets in the route")
+	cdnURL              = flag.String("cdnurl", "https://cdn.jsdelivr.net/gh/caocaocc/rule-set@release/", "Base URL of the publish directory on jsDelivr CDN, used in index.html and index.json")
+	conflictLists       = flag.String("conflictlists", "cn:geolocation-!cn", "Pairs of lists that should not match the same domains, separated by ',' comma. Example: cn:geolocation-!cn,private:geolocation-!cn")
+	withBuildInfo       = flag.Bool("buildinfo", false, "Add the build metadata, which is the generator version, the git commits of the data directories and the hash of the data files, to the headers of the text files and manifest.json")
+	buildInfoDatEntry   = flag.Bool("buildinfoentry", false, "Also add the build metadata to the dat file as the BUILD-INFO entry, with -buildinfo")
+	headerPath          = flag.String("header", "", "Path to the template of the header comments of the generated text files, with the {{.Name}}, {{.LastModified}}, {{.SchemaVersion}}, {{.HomePage}} and {{.BuildInfo}} fields, leave empty for the default header")
+	timezone            = flag.String("timezone", "", "Time zone of the Last Modified time in the headers of all generated files, eg: UTC or Asia/Shanghai, leave empty for the default of each format")
+	timeFormat          = flag.String("timefmt", "", "Layout of the Last Modified time in the headers of all generated files, rfc1123, rfc1123z, rfc3339, datetime or a Go time layout, eg: \"2006-01-02 15:04 MST\", leave empty for the default of each format")
+	noHeader            = flag.Bool("noheader", false, "Leave out the header comments of the generated text files")
+	fileNameTemplate    = flag.String("filename", "{name}.{ext}", "Template of the names of the files of the exported lists, with the list {name} in lower case or {NAME} in upper case, the extension {ext} and the {format}, eg: geosite-{name}.{ext}")
+	layout              = flag.String("layout", layoutFlat, "Layout of the files of the exported lists in the output path: flat, or format for a directory of each format, eg: surge/cn.list")
+	runReportPath       = flag.String("runreport", "", "Path to write the JSON report of the generated lists and files, the skipped lists, the warnings and the errors of each run to, leave empty to skip")
+	overlapPath         = flag.String("overlappath", "", "Path to write the report of overlaps between conflicting lists and exported lists with different policies to, leave empty to skip")
+	dnsLeakList         = flag.String("dnsleaklist", "", "List of DNS-over-HTTPS/TLS endpoints to be blocked in the anti-DNS-leak outputs")
+	offline             = flag.Bool("offline", false, "Skip all network fetches and use the snapshots of remote sources instead")
+	snapshotPath        = flag.String("snapshotpath", "./snapshots", "Path to the last-known-good snapshots of remote sources")
+	schemaVersion       = flag.Int("schema", ruleset.CurrentSchemaVersion, "Output schema version, older versions are deprecated and print a warning")
+	ipSetExclude        = flag.String("ipsetexclude", "cn@private", "Subtract IP sets from other IP sets, separated by ',' comma, support multiple sets to subtract. Example: cn@private,telegram@private")
+	singBoxPath         = flag.String("singbox", "", "Path to the sing-box binary used to compile .srs rule sets, leave empty to skip")
+	singBoxVersion      = flag.Int("singboxversion", 2, "Version of the sing-box rule sets: 1 for sing-box before 1.10, 2, or 3 for 1.11 and later")
+	incrementalMode     = flag.Bool("incremental", false, "Skip generating the exported lists whose rules, includes and policy are unchanged since the last run")
+	incrementalState    = flag.String("incrementalstate", "./incremental-state.json", "Path to the file persisting the input and output hashes of exported lists between runs")
+	reproducible        = flag.Bool("reproducible", false, "Generate byte-identical outputs, with the Last Modified time from SOURCE_DATE_EPOCH or omitted if not set")
+	dryRun              = flag.Bool("dryrun", false, "Generate all files in a temporary directory and print which files in the output path would be created or changed, without writing anything")
+	dryRunDiff          = flag.Bool("dryrundiff", false, "Also print the unified diffs of the text files that would be created or changed in -dryrun mode")
+	watch               = flag.Bool("watch", false, "Keep watching the data directories after generating, and regenerate the lists affected by changed files")
+	templatesPath       = flag.String("templates", "", "Path to the directory of text/template files of custom output formats, named like openwrt.conf.tmpl for the openwrt format of .conf files")
+	scheduleSpec        = flag.String("schedule", "", "Keep running and regenerate on a cron schedule of minute, hour, day of month, month and day of week, in local time. Example: \"0 4 * * *\" for 04:00 every day")
+	notifyWebhook       = flag.String("notifywebhook", "", "URL to POST the JSON summary of each generation to, with the changed lists, rule counts and errors")
+	notifyTelegramChat  = flag.String("telegramchat", "", "ID of the Telegram chat to send the summary of each generation to")
+	notifyTelegramToken = flag.String("telegramtoken", "", "Token of the Telegram bot sending the summaries, or set the TELEGRAM_BOT_TOKEN env instead")
+	proxy               = flag.String("proxy", "", "Proxy for downloading remote sources, eg: socks5://127.0.0.1:1080. Defaults to HTTP_PROXY/HTTPS_PROXY/ALL_PROXY environment variables")
 )
 
+// exportFormats is the -export option, overriding -exportlists in certain formats
+var exportFormats = make(ruleset.ExportFlag)
+
+// formatExcludeAttrs is the -formatexcludeattrs option, overriding -excludeattrs in certain formats
+var formatExcludeAttrs = make(ruleset.ExcludeAttrsFlag)
+
+func init() {
+	flag.Var(exportFormats, "export", "Lists to be exported in a format instead of -exportlists, repeatable, in 'format=list1,list2' where format is text, surge, mihomo, mihomotext, singbox, quantumultx, stash, v2ray, egern, dat with -listdats or one of -templates, and 'all' exports all lists. Example: -export surge=cn,google -export singbox=all")
+	flag.Var(formatExcludeAttrs, "formatexcludeattrs", "Attributes excluded from the lists exported in a format instead of -excludeattrs, repeatable, in 'format=list@attr1@attr2,list2@attr1', where nothing after '=' keeps all rules. Example: -formatexcludeattrs adblock=")
+}
+
 func main() {
-	flag.Parse()
+	if err := runCommand(os.Args[1:]); err != nil {
+		ruleset.Logf(slog.LevelError, "%v", err)
+		os.Exit(exitCode(err))
+	}
+}
 
-	dir := GetDataDir()
-	listInfoMap := make(ListInfoMap)
+// runGenerateCommand runs the generate command, once or in watch or daemon mode.
+func runGenerateCommand() error {
+	switch {
+	case *watch && *scheduleSpec != "":
+		return errors.New("-watch and -schedule cannot be used together")
+	case *dryRun && (*watch || *scheduleSpec != ""):
+		return errors.New("-dryrun cannot be used with -watch or -schedule")
+	case *dryRun:
+		return runDryRun()
+	case *watch:
+		return runGenerateWatch()
+	case *scheduleSpec != "":
+		return runGenerateSchedule()
+	}
+	return runGenerate()
+}
 
-	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// generate generates all the files, it is the default command.
+func generate() error {
+	if err := ruleset.CheckSchemaVersion(*schemaVersion); err != nil {
+		return err
+	}
+	if err := ruleset.CheckDomainCheckMode(*domainCheck); err != nil {
+		return err
+	}
+	if err := ruleset.CheckSortOrder(*sortOrder); err != nil {
+		return err
+	}
+	if err := ruleset.CheckSingBoxVersion(*singBoxVersion); err != nil {
+		return err
+	}
+	setRulesetOptions()
+	if *templatesPath != "" {
+		if err := ruleset.RegisterTemplates(*templatesPath); err != nil {
+			return err
+		}
+	}
+	if *listDats {
+		ruleset.RegisterDatExporter()
+	}
+	if err := exportFormats.Check(); err != nil {
+		return err
+	}
+	if err := formatExcludeAttrs.Check(); err != nil {
+		return err
+	}
+	if err := checkLayout(*layout); err != nil {
+		return err
+	}
+	if err := checkFileNameTemplate(*fileNameTemplate); err != nil {
+		return err
+	}
+	compressFormats, err := parseCompressFormats(*compress)
+	if err != nil {
+		return err
+	}
+	ruleset.NoHeaders, ruleset.HeaderTemplate = *noHeader, nil
+	if *headerPath != "" {
+		headerBytes, err := os.ReadFile(*headerPath)
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
+		if ruleset.HeaderTemplate, err = ruleset.ParseHeaderTemplate(string(headerBytes)); err != nil {
+			return fmt.Errorf("header template: %w", err)
+		}
+	}
+	ruleset.HeaderLocation, ruleset.HeaderTimeLayout = nil, ruleset.ParseHeaderTimeLayout(*timeFormat)
+	if *timezone != "" {
+		if ruleset.HeaderLocation, err = time.LoadLocation(*timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
 		}
-		if err := listInfoMap.Marshal(path); err != nil {
+	}
+
+	if *reproducible {
+		if err := ruleset.SetReproducibleTime(os.Getenv("SOURCE_DATE_EPOCH")); err != nil {
 			return err
 		}
-		return nil
-	}); err != nil {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
 	}
 
-	if err := listInfoMap.FlattenAndGenUniqueDomainList(); err != nil {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
+	client, err := NewHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+	snapshots := ruleset.NewSnapshotStore(*snapshotPath, *offline)
+	snapshots.ReadOnly = *dryRun
+	ruleset.SetRemoteSources(client, snapshots)
+
+	sources, err := dataSources()
+	if err != nil {
+		return err
+	}
+	var buildInfo *BuildInfo
+	ruleset.BuildInfo = ""
+	if *withBuildInfo {
+		if buildInfo, err = newBuildInfo(sources); err != nil {
+			return err
+		}
+		ruleset.BuildInfo = buildInfo.String()
+	}
+	// The errors of the lists skipped in -keepgoing mode
+	var skippedErrors []error
+	listInfoMap, err := ruleset.LoadListInfoMap(sources, *conflict)
+	var skipped *ruleset.SkippedListsError
+	if errors.As(err, &skipped) {
+		skippedErrors = append(skippedErrors, skipped.Errors...)
+	} else if err != nil {
+		return &dataError{err}
 	}
 
 	// Process and split *excludeRules
-	excludeAttrsInFile := make(map[fileName]map[attribute]bool)
-	if *excludeAttrs != "" {
-		exFilenameAttrSlice := strings.Split(*excludeAttrs, ",")
-		for _, exFilenameAttr := range exFilenameAttrSlice {
-			exFilenameAttr = strings.TrimSpace(exFilenameAttr)
-			exFilenameAttrMap := strings.Split(exFilenameAttr, "@")
-			filename := fileName(strings.ToUpper(strings.TrimSpace(exFilenameAttrMap[0])))
-			excludeAttrsInFile[filename] = make(map[attribute]bool)
-			for _, attr := range exFilenameAttrMap[1:] {
-				attr = strings.TrimSpace(attr)
-				if len(attr) > 0 {
-					excludeAttrsInFile[filename][attribute(attr)] = true
-				}
-			}
+	excludeAttrsInFile := ruleset.ParseExcludeAttrs(*excludeAttrs)
+	includeAttrsInFile := ruleset.ParseExcludeAttrs(*includeAttrs)
+
+	// Process and split *listPolicy
+	for filename, policy := range ruleset.ParseListPolicies(*listPolicy) {
+		if listinfo := listInfoMap[filename]; listinfo != nil {
+			listinfo.Policy = policy
 		}
 	}
 
-	// Process and split *exportLists
-	var exportListsSlice []string
-	if *exportLists != "" {
-		tempSlice := strings.Split(*exportLists, ",")
-		for _, exportList := range tempSlice {
-			exportList = strings.TrimSpace(exportList)
-			if len(exportList) > 0 {
-				exportListsSlice = append(exportListsSlice, exportList)
-			}
+	// Process and split *mihomoBehavior
+	mihomoBehaviors, err := ruleset.ParseMihomoBehaviors(*mihomoBehavior)
+	if err != nil {
+		return err
+	}
+	for filename, behavior := range mihomoBehaviors {
+		if listinfo := listInfoMap[filename]; listinfo != nil && behavior != ruleset.MihomoIPCIDR {
+			listinfo.MihomoBehavior = behavior
 		}
 	}
 
+	exportListsSlice := splitExportLists(*exportLists)
+
+	// The lists each generated file is generated from, for stats.json
+	listsOfFile := make(map[string][]*ruleset.ListInfo)
+	// The exported lists and the formats of the files of the lists, for index.json
+	exportsOfFile := make(map[string]indexExport)
+	unchangedFiles := make(map[string]bool)
+
 	// Generate dlc.dat
-	if geositeList := listInfoMap.ToProto(excludeAttrsInFile); geositeList != nil {
-		protoBytes, err := proto.Marshal(geositeList)
+	done := ruleset.Timing.Start("dat")
+	if geositeList := listInfoMap.ToProto(excludeAttrsInFile, includeAttrsInFile); geositeList != nil {
+		// The build metadata is only in the dat file, not in geosite.db nor the changelog
+		datList := geositeList
+		if buildInfo != nil && *buildInfoDatEntry {
+			datList = &router.GeoSiteList{Entry: append(append([]*router.GeoSite{}, geositeList.Entry...), buildInfo.datEntry())}
+		}
+		protoBytes, err := proto.Marshal(datList)
 		if err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
+			return err
+		}
+		if err := ruleset.MkdirAll(*outputPath); err != nil {
+			return err
+		}
+		// Compare with the previous dat file for the notifications, unless it is the first run
+		if previous, err := loadDatRules(filepath.Join(*outputPath, *datName)); err == nil {
+			currentBuild.setChanged(DiffDatRules(previous, datRules(geositeList)))
 		}
-		if err := os.MkdirAll(*outputPath, 0755); err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
+		currentBuild.Lists = len(geositeList.Entry)
+		for _, geosite := range geositeList.Entry {
+			currentBuild.Rules += len(geosite.Domain)
 		}
-		if err := os.WriteFile(filepath.Join(*outputPath, *datName), protoBytes, 0644); err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
+		if err := ruleset.WriteFile(filepath.Join(*outputPath, *datName), protoBytes); err != nil {
+			return err
 		} else {
-			fmt.Printf("%s has been generated successfully in '%s'.\n", *datName, *outputPath)
+			ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", *datName, *outputPath)
+		}
+		if *changelogPath != "" && !*dryRun {
+			if err := GenerateChangelog(geositeList, *changelogPath, *changelogState); err != nil {
+				return err
+			}
+		}
+		if *debugPath != "" {
+			if err := GenerateSourceMap(*debugPath, listInfoMap); err != nil {
+				return err
+			}
+		}
+		for _, geosite := range geositeList.Entry {
+			listsOfFile[*datName] = append(listsOfFile[*datName], listInfoMap[ruleset.FileName(geosite.CountryCode)])
+		}
+
+		// Generate geosite.db of the same entries
+		if *geositeDBName != "" {
+			if _, err := writeOutputFile(filepath.Join(*outputPath, *geositeDBName), true, func(w io.Writer) error {
+				return ruleset.WriteSingBoxGeoSiteDB(w, geositeList)
+			}); err != nil {
+				return err
+			}
+			ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", *geositeDBName, *outputPath)
+			listsOfFile[*geositeDBName] = listsOfFile[*datName]
 		}
 	}
+	done()
 
-	// Generate plaintext list files
-	if filePlainTextBytesMap, err := listInfoMap.ToPlainText(exportListsSlice); err == nil {
-		for filename, plaintextBytes := range filePlainTextBytesMap {
-			// Generate .txt files
-			if err := os.WriteFile(filepath.Join(*outputPath, filename+".txt"), plaintextBytes, 0644); err != nil {
-				fmt.Println("Failed:", err)
-				os.Exit(1)
-			} else {
-				fmt.Printf("%s.txt has been generated successfully in '%s'.\n", filename, *outputPath)
-			}
-			
-			// Generate Surge .list files
-			if surgeBytes := listInfoMap[fileName(strings.ToUpper(filename))].ToSurgeList(); len(surgeBytes) > 0 {
-				if err := os.WriteFile(filepath.Join(*outputPath, filename+".list"), surgeBytes, 0644); err != nil {
-					fmt.Println("Failed:", err)
-					os.Exit(1)
-				} else {
-					fmt.Printf("%s.list has been generated successfully in '%s'.\n", filename, *outputPath)
+	// Derive the sub-lists with attributes, eg: `cn@ads`, exported like other lists
+	for _, subList := range listInfoMap.AttributeSubLists(ruleset.ParseExcludeAttrs(*exportAttrs)) {
+		listInfoMap[subList.Name] = subList
+		exportListsSlice = append(exportListsSlice, strings.ToLower(string(subList.Name)))
+	}
+	// Derive the lite variants of lists with the popular domains only, eg: `geolocation-!cn-lite`
+	ranking, err := loadRanking(client, snapshots)
+	if err != nil {
+		return err
+	}
+	subLists, err := liteSubLists(listInfoMap, ranking)
+	if err != nil {
+		return err
+	}
+	for _, subList := range subLists {
+		listInfoMap[subList.Name] = subList
+		exportListsSlice = append(exportListsSlice, strings.ToLower(string(subList.Name)))
+	}
+
+	// Generate list files of each format
+	exportListsSlice, formatsOfList := listInfoMap.ExportPlan(exportListsSlice, exportFormats)
+	var affected map[ruleset.FileName]bool
+	if watchChanged != nil {
+		affected = listInfoMap.Dependents(watchChanged)
+	}
+	var incremental *IncrementalState
+	// The dry run generates into an empty directory, so all lists are generated
+	if *incrementalMode && !*dryRun {
+		if incremental, err = LoadIncrementalState(*incrementalState); err != nil {
+			return err
+		}
+	}
+	// The lists exported in the singbox format, including the skipped ones, for the sing-box route
+	var singBoxLists []*ruleset.ListInfo
+exportLists:
+	for _, filename := range exportListsSlice {
+		listinfo := listInfoMap[ruleset.FileName(strings.ToUpper(filename))]
+		if listinfo == nil {
+			ruleset.Logf(ruleset.LevelNotice, "%s: no such exported list in the directory, skipped.", filename)
+			continue
+		}
+		formats := ruleset.FormatNames(formatsOfList[filename])
+		chunksOfFormat, err := exportChunks(listinfo, formatsOfList[filename], excludeAttrsInFile, includeAttrsInFile)
+		if err != nil {
+			if !*keepGoing {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+			skippedErrors = append(skippedErrors, fmt.Errorf("%s: %w", filename, err))
+			continue
+		}
+		for _, format := range formatsOfList[filename] {
+			for _, chunk := range chunksOfFormat[format.Name()] {
+				chunkFile := exportedFileName(chunkFileName(filename, chunk), format)
+				listsOfFile[chunkFile] = []*ruleset.ListInfo{chunk}
+				exportsOfFile[chunkFile] = indexExport{List: strings.ToLower(filename), Format: format.Name()}
+				if format.Name() == "singbox" {
+					singBoxLists = append(singBoxLists, chunk)
 				}
 			}
-
-			// Generate Mihomo/Clash.Meta .yaml files
-			if mihomoBytes := listInfoMap[fileName(strings.ToUpper(filename))].ToMihomoList(); len(mihomoBytes) > 0 {
-				if err := os.WriteFile(filepath.Join(*outputPath, filename+".yaml"), mihomoBytes, 0644); err != nil {
-					fmt.Println("Failed:", err)
-					os.Exit(1)
-				} else {
-					fmt.Printf("%s.yaml has been generated successfully in '%s'.\n", filename, *outputPath)
+		}
+		// Skip the exported lists not affected by the changed data files in watch mode
+		name := listinfo.Name
+		if listinfo.Parent != "" {
+			name = listinfo.Parent
+		}
+		if affected != nil && !affected[name] {
+			for _, format := range formatsOfList[filename] {
+				for _, chunk := range chunksOfFormat[format.Name()] {
+					unchangedFiles[exportedFileName(chunkFileName(filename, chunk), format)] = true
+				}
+			}
+			continue
+		}
+		// Skip the exported lists unchanged since the last run
+		if incremental != nil && incremental.Unchanged(filename, listinfo, formats, *outputPath) {
+			ruleset.Logf(slog.LevelInfo, "%s: unchanged since the last run, skipped.", filename)
+			for _, format := range formatsOfList[filename] {
+				for _, chunk := range chunksOfFormat[format.Name()] {
+					unchangedFiles[exportedFileName(chunkFileName(filename, chunk), format)] = true
 				}
 			}
+			continue
+		}
 
-			// Generate sing-box .json files
-			if singboxBytes := listInfoMap[fileName(strings.ToUpper(filename))].ToSingBoxList(); len(singboxBytes) > 0 {
-				if err := os.WriteFile(filepath.Join(*outputPath, filename+".json"), singboxBytes, 0644); err != nil {
-					fmt.Println("Failed:", err)
-					os.Exit(1)
-				} else {
-					fmt.Printf("%s.json has been generated successfully in '%s'.\n", filename, *outputPath)
+		// The formats are independent, so their files are written concurrently
+		started := time.Now()
+		exports := make([]formatExport, len(formatsOfList[filename]))
+		var wg sync.WaitGroup
+		for i, format := range formatsOfList[filename] {
+			wg.Add(1)
+			go func(i int, format ruleset.Exporter) {
+				defer wg.Done()
+				exports[i] = exportFormat(filename, format, chunksOfFormat[format.Name()])
+			}(i, format)
+		}
+		wg.Wait()
+		var generatedFiles []string
+		for i, format := range formatsOfList[filename] {
+			ruleset.Timing.Add("export "+format.Name(), exports[i].duration)
+			for _, generatedFile := range exports[i].files {
+				ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", generatedFile, *outputPath)
+				generatedFiles = append(generatedFiles, generatedFile)
+			}
+			if err := exports[i].err; err != nil {
+				if !*keepGoing {
+					return fmt.Errorf("%s: %s: %w", filename, format.Name(), err)
 				}
+				skippedErrors = append(skippedErrors, fmt.Errorf("%s: %s: %w", filename, format.Name(), err))
+				continue exportLists
 			}
+			if err := removeStaleChunks(*outputPath, filename, format, len(chunksOfFormat[format.Name()])); err != nil {
+				return err
+			}
+		}
+		ruleset.Logger.Debug("exported list", "list", filename, "formats", formats, "rules", len(listinfo.GeoSite.GetDomain()), "files", len(generatedFiles), "duration", time.Since(started))
 
-			// Generate Quantumult X .snippet files
-			if qxBytes := listInfoMap[fileName(strings.ToUpper(filename))].ToQuantumultXList(); len(qxBytes) > 0 {
-				if err := os.WriteFile(filepath.Join(*outputPath, filename+".snippet"), qxBytes, 0644); err != nil {
-					fmt.Println("Failed:", err)
-					os.Exit(1)
-				} else {
-					fmt.Printf("%s.snippet has been generated successfully in '%s'.\n", filename, *outputPath)
+		if incremental != nil {
+			if err := incremental.Update(filename, listinfo, formats, *outputPath, generatedFiles); err != nil {
+				return err
+			}
+		}
+	}
+	if incremental != nil {
+		if err := incremental.Save(); err != nil {
+			return err
+		}
+	}
+
+	// Check the dat file with the loaders of V2Ray, for the exported lists in it
+	if *checkLoaders {
+		done := ruleset.Timing.Start("check loaders")
+		inDat := make(map[string]bool, len(listsOfFile[*datName]))
+		for _, listinfo := range listsOfFile[*datName] {
+			inDat[strings.ToLower(string(listinfo.Name))] = true
+		}
+		var datLists []string
+		for _, filename := range exportListsSlice {
+			if inDat[strings.ToLower(filename)] {
+				datLists = append(datLists, filename)
+			}
+		}
+		if err := checkDatLoaders(filepath.Join(*outputPath, *datName), datLists); err != nil {
+			return err
+		}
+		ruleset.Logf(slog.LevelInfo, "%s: %d exported lists loaded by the V2Ray loaders.", *datName, len(datLists))
+		done()
+	}
+
+	// Generate the sing-box route referencing the rule sets of the exported lists
+	if len(singBoxLists) > 0 {
+		routeBytes, err := ruleset.SingBoxRoute(singBoxLists, *rawURL, func(name string) string {
+			return exportedFileName(name, ruleset.FindExporter("singbox"))
+		})
+		if err != nil {
+			return err
+		}
+		if err := ruleset.WriteFile(filepath.Join(*outputPath, ruleset.SingBoxRouteName), routeBytes); err != nil {
+			return err
+		}
+		ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", ruleset.SingBoxRouteName, *outputPath)
+	}
+
+	// Generate gfwlist.txt, of all the lists merged, and gfwlist-<name>.txt of each list if there are several
+	done = ruleset.Timing.Start("gfwlist")
+	var userRules []byte
+	if *gfwlistUserRules != "" {
+		if userRules, err = readGFWListUserRules(*gfwlistUserRules); err != nil {
+			return err
+		}
+	}
+	gfwLists := splitExportLists(*toGFWList)
+	gfwFiles := [][2]string{{"gfwlist.txt", strings.Join(gfwLists, ",")}}
+	if len(gfwLists) > 1 {
+		gfwFiles = gfwFiles[:0]
+		for _, name := range gfwLists {
+			gfwFiles = append(gfwFiles, [2]string{"gfwlist-" + strings.ToLower(name) + ".txt", name})
+		}
+		gfwFiles = append(gfwFiles, [2]string{"gfwlist.txt", strings.Join(gfwLists, ",")})
+	}
+	for _, gfwFile := range gfwFiles {
+		fileName, lists := gfwFile[0], gfwFile[1]
+		if _, err := writeOutputFile(filepath.Join(*outputPath, fileName), true, func(w io.Writer) error {
+			encoder := base64.NewEncoder(base64.StdEncoding, w)
+			if err := listInfoMap.WriteGFWList(encoder, fileName, lists, *gfwlistExceptAttr, *gfwlistExceptList); err != nil {
+				return err
+			}
+			if fileName == "gfwlist.txt" && len(userRules) > 0 {
+				fmt.Fprintf(encoder, "\n! User rules of %s\n", filepath.Base(*gfwlistUserRules))
+				if _, err := encoder.Write(userRules); err != nil {
+					return err
 				}
 			}
+			return encoder.Close()
+		}); err != nil {
+			if !*keepGoing {
+				return err
+			}
+			skippedErrors = append(skippedErrors, fmt.Errorf("%s: %w", fileName, err))
+			continue
+		}
+		ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", fileName, *outputPath)
+		for _, name := range strings.Split(lists, ",") {
+			listsOfFile[fileName] = append(listsOfFile[fileName], listInfoMap[ruleset.FileName(strings.ToUpper(name))])
 		}
-	} else {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
 	}
+	done()
 
-	// Generate gfwlist.txt
-	if gfwlistBytes, err := listInfoMap.ToGFWList(*toGFWList); err == nil {
-		if f, err := os.OpenFile(filepath.Join(*outputPath, "gfwlist.txt"), os.O_RDWR|os.O_CREATE, 0644); err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
-		} else {
-			encoder := base64.NewEncoder(base64.StdEncoding, f)
-			defer encoder.Close()
-			if _, err := encoder.Write(gfwlistBytes); err != nil {
-				fmt.Println("Failed:", err)
-				os.Exit(1)
+	// Generate anti-DNS-leak outputs
+	var dnsLeakListInfo *ruleset.ListInfo
+	if *dnsLeakList != "" {
+		if dnsLeakListInfo = listInfoMap[ruleset.FileName(strings.ToUpper(*dnsLeakList))]; dnsLeakListInfo == nil {
+			ruleset.Logf(ruleset.LevelNotice, "%s: no such DNS leak list in the directory, skipped.", *dnsLeakList)
+		}
+	}
+	done = ruleset.Timing.Start("dns leak")
+	if err := NewDNSLeakHelper(dnsLeakListInfo, *outputPath).Generate(); err != nil {
+		return err
+	}
+	done()
+
+	// Generate the report of overlaps between conflicting lists
+	if *overlapPath != "" && !*dryRun {
+		done := ruleset.Timing.Start("overlap")
+		overlaps := listInfoMap.Overlaps(ruleset.ParseConflictLists(*conflictLists), exportListsSlice)
+		if err := ruleset.GenerateOverlapReport(*overlapPath, overlaps); err != nil {
+			return err
+		}
+		done()
+	}
+
+	// Generate ipcidr, which is independent of the data directory so skipped in watch mode
+	if watchChanged == nil {
+		done := ruleset.Timing.Start("ip sets")
+		if err := generateIPSets(listInfoMap, client, snapshots); err != nil {
+			return err
+		}
+		done()
+	}
+
+	// Generate compressed variants of large files
+	done = ruleset.Timing.Start("compress")
+	if err := CompressFiles(*outputPath, compressFormats, *compressMinSize); err != nil {
+		return err
+	}
+	done()
+
+	// Generate stats.json, index.html and index.json
+	done = ruleset.Timing.Start("stats and index")
+	stats, err := GenerateStats(*outputPath, listsOfFile, unchangedFiles, ranking)
+	if err != nil {
+		return err
+	}
+	currentBuild.setStats(stats)
+	if err := GenerateIndex(*outputPath, stats, exportsOfFile, *rawURL, *cdnURL); err != nil {
+		return err
+	}
+	done()
+
+	// Generate manifest.json
+	done = ruleset.Timing.Start("manifest and checksums")
+	if err := GenerateManifest(*outputPath, snapshots.StaleSources(), buildInfo); err != nil {
+		return err
+	}
+
+	// Generate sha256sum.txt covering all files, including manifest.json
+	if err := GenerateChecksums(*outputPath, *checksumFiles); err != nil {
+		return err
+	}
+	done()
+
+	// The dry run leaves out signing, not to unlock the keys for nothing
+	if *dryRun {
+		return skippedListsError(skippedErrors)
+	}
+
+	// Sign all files, including sha256sum.txt, with detached signatures
+	var signers []Signer
+	minisignKey := os.Getenv("MINISIGN_SECRET_KEY")
+	if *minisignKeyPath != "" {
+		keyFile, err := os.ReadFile(*minisignKeyPath)
+		if err != nil {
+			return err
+		}
+		minisignKey = string(keyFile)
+	}
+	if minisignKey != "" {
+		signer, err := NewMinisignSigner([]byte(minisignKey), os.Getenv("MINISIGN_PASSWORD"))
+		if err != nil {
+			return err
+		}
+		signers = append(signers, signer)
+	}
+	if *pgpKeyID != "" {
+		signers = append(signers, &PGPSigner{KeyID: *pgpKeyID})
+	}
+	done = ruleset.Timing.Start("signing")
+	if err := SignFiles(*outputPath, signers...); err != nil {
+		return err
+	}
+	done()
+
+	return skippedListsError(skippedErrors)
+}
+
+// skippedListsError returns the error failing a generation in -keepgoing mode
+// with the report of all errors of the skipped lists, or nil if none is skipped.
+func skippedListsError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	// The errors of all lines of a data file are joined
+	var lines []string
+	for _, err := range errs {
+		lines = append(lines, strings.Split(err.Error(), "\n")...)
+	}
+	sort.Strings(lines)
+	return &skippedError{
+		msg:   fmt.Sprintf("%d errors, the lists with errors are skipped:\n%s", len(lines), strings.Join(lines, "\n")),
+		errs:  errs,
+		lines: lines,
+	}
+}
+
+// dataSources returns the data directories of the -datapath and -nsdatapath options
+func dataSources() ([]ruleset.DataSource, error) {
+	sources := ruleset.OverlayDataSources(GetDataDir())
+	if *nsDataPath != "" {
+		for _, pair := range strings.Split(*nsDataPath, ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, fmt.Errorf("invalid namespaced data directory: %s", pair)
 			}
-			fmt.Printf("gfwlist.txt has been generated successfully in '%s'.\n", *outputPath)
+			sources = append(sources, ruleset.DataSource{Namespace: strings.TrimSpace(kv[0]), Path: strings.TrimSpace(kv[1])})
 		}
-	} else {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
 	}
+	return sources, nil
+}
+
+// splitExportLists splits the lists of the -exportlists option
+func splitExportLists(lists string) []string {
+	var exportListsSlice []string
+	for _, exportList := range strings.Split(lists, ",") {
+		if exportList = strings.TrimSpace(exportList); len(exportList) > 0 {
+			exportListsSlice = append(exportListsSlice, exportList)
+		}
+	}
+	return exportListsSlice
+}
 
-	// Generate ipcidr
-	fmt.Println("\nGenerating IP rules...")
-	
-	ipSets := []*IPSet{
-		NewIPSet("private", []string{
+// setRulesetOptions sets the options of parsing the data directories from the flags
+func setRulesetOptions() {
+	ruleset.Lenient, ruleset.SimplifyRegexps = *lenient, *simplifyRegexps
+	ruleset.KeepGoing = *keepGoing
+	ruleset.DomainCheck, ruleset.SchemaVersion = *domainCheck, *schemaVersion
+	ruleset.DatName, ruleset.TLDListURL = *datName, *tldListURL
+	ruleset.SortOrder, ruleset.SingBoxVersion = *sortOrder, *singBoxVersion
+	ruleset.TrackOrigins = *debugPath != ""
+}
+
+// generateIPSets fetches, subtracts and generates the IP sets,
+// including the heuristic ones resolved from lists.
+func generateIPSets(listInfoMap ruleset.ListInfoMap, client *http.Client, snapshots *ruleset.SnapshotStore) error {
+	ruleset.Logf(slog.LevelInfo, "\nGenerating IP rules...")
+
+	ipSets := []*ruleset.IPSet{
+		ruleset.NewIPSet("private", []string{
 			"https://raw.githubusercontent.com/Loyalsoldier/geoip/release/text/private.txt",
 		}, *outputPath),
-		NewIPSet("cn", []string{
+		ruleset.NewIPSet("cn", []string{
 			"https://raw.githubusercontent.com/misakaio/chnroutes2/master/chnroutes.txt",
 			"https://raw.githubusercontent.com/gaoyifan/china-operator-ip/ip-lists/china6.txt",
 		}, *outputPath),
-		NewIPSet("telegram", []string{
+		ruleset.NewIPSet("telegram", []string{
 			"https://core.telegram.org/resources/cidr.txt",
 		}, *outputPath),
 	}
 
+	// Process and split *resolveLists
+	if *resolveLists != "" {
+		var servers []string
+		for _, server := range strings.Split(*resolvers, ",") {
+			if server = strings.TrimSpace(server); server != "" {
+				servers = append(servers, server)
+			}
+		}
+		resolver := ruleset.NewDNSResolver(servers, *resolveState, *resolveWindow)
+		resolver.Offline = *offline
+		resolver.ReadOnly = *dryRun
+		resolver.Widen = *resolveWiden
+		for _, resolveList := range strings.Split(*resolveLists, ",") {
+			resolveList = strings.TrimSpace(resolveList)
+			if resolveList == "" {
+				continue
+			}
+			listinfo := listInfoMap[ruleset.FileName(strings.ToUpper(resolveList))]
+			if listinfo == nil {
+				ruleset.Logf(ruleset.LevelNotice, "%s: no such list to resolve in the directory, skipped.", resolveList)
+				continue
+			}
+			set := ruleset.NewIPSet(resolveList+"-resolved", nil, *outputPath)
+			set.Domains = listinfo.ResolvableDomains()
+			set.Resolver = resolver
+			ipSets = append(ipSets, set)
+		}
+	}
+
 	policies := map[string]string{
 		"private":  "direct",
 		"cn":       "direct",
 		"telegram": "proxy",
 	}
 
+	minEntries := map[string]int{
+		"private":  10,
+		"cn":       1000,
+		"telegram": 5,
+	}
+
+	// Process and split *sourceSHA256
+	checksums := make(map[string]string)
+	if *sourceSHA256 != "" {
+		for _, pair := range strings.Split(*sourceSHA256, ",") {
+			pair = strings.TrimSpace(pair)
+			idx := strings.LastIndex(pair, "=")
+			if idx == -1 {
+				return fmt.Errorf("invalid source checksum: %s", pair)
+			}
+			checksums[strings.TrimSpace(pair[:idx])] = strings.TrimSpace(pair[idx+1:])
+		}
+	}
+
+	mihomoBehaviors, err := ruleset.ParseMihomoBehaviors(*mihomoBehavior)
+	if err != nil {
+		return err
+	}
+
+	fetchedSets := make(map[string]*ruleset.IPSet)
 	for _, set := range ipSets {
+		if behavior := mihomoBehaviors[ruleset.FileName(strings.ToUpper(set.Name))]; behavior != ruleset.MihomoDomain {
+			set.MihomoBehavior = behavior
+		}
+		set.Client = client
+		set.Snapshots = snapshots
+		set.SingBoxPath = *singBoxPath
+		set.Checksums = checksums
+		set.MinEntries = minEntries[set.Name]
+		if set.IsHeuristic() {
+			policies[set.Name] = "proxy"
+		}
+		if err := set.Fetch(); err != nil {
+			ruleset.Logf(slog.LevelError, "generating %s: %v", set.Name, err)
+			currentBuild.addError("%s: %v", set.Name, err)
+			continue
+		}
+		fetchedSets[set.Name] = set
+	}
+
+	// Process and split *ipSetExclude
+	if *ipSetExclude != "" {
+		for _, exNameSets := range strings.Split(*ipSetExclude, ",") {
+			exNameSetSlice := strings.Split(strings.TrimSpace(exNameSets), "@")
+			if set := fetchedSets[strings.TrimSpace(exNameSetSlice[0])]; set != nil {
+				for _, exName := range exNameSetSlice[1:] {
+					if exName = strings.TrimSpace(exName); exName != "" {
+						set.Exclude = append(set.Exclude, exName)
+					}
+				}
+			}
+		}
+	}
+
+	for _, set := range ipSets {
+		if fetchedSets[set.Name] == nil {
+			continue
+		}
+		var excluded []*ruleset.IPSet
+		for _, exName := range set.Exclude {
+			if exSet := fetchedSets[exName]; exSet != nil {
+				excluded = append(excluded, exSet)
+			} else {
+				ruleset.Logf(ruleset.LevelNotice, "%s: no such IP set to exclude from %s, skipped.", exName, set.Name)
+			}
+		}
+		if err := set.Subtract(excluded...); err != nil {
+			ruleset.Logf(slog.LevelError, "generating %s: %v", set.Name, err)
+			currentBuild.addError("%s: %v", set.Name, err)
+			continue
+		}
 		if err := set.Generate(policies[set.Name]); err != nil {
-			fmt.Printf("Error generating %s: %v\n", set.Name, err)
+			ruleset.Logf(slog.LevelError, "generating %s: %v", set.Name, err)
+			currentBuild.addError("%s: %v", set.Name, err)
 			continue
 		}
-		fmt.Printf("%s: %d entries\n", set.Name, len(set.IPs))
+		ruleset.Logf(slog.LevelInfo, "%s: %d entries", set.Name, len(set.IPs))
+	}
+	return nil
+}
+
+// writeOutputFile writes a file through a buffered writer into a temporary
+// file, renamed over the file when done, so that a failed write leaves the
+// previous file as it was. If write writes nothing, the file is not written
+// unless keepEmpty is true. It reports whether the file is written.
+func writeOutputFile(path string, keepEmpty bool, write func(io.Writer) error) (bool, error) {
+	// The files of a format are in its directory in the format layout
+	if err := ruleset.MkdirAll(filepath.Dir(path)); err != nil {
+		return false, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, &ruleset.WriteError{Err: err}
+	}
+	// Removes the temporary file unless it has been renamed
+	defer os.Remove(f.Name())
+
+	bw := bufio.NewWriter(f)
+	counter := &countingWriter{w: bw}
+	err = write(counter)
+	// The buffered writer keeps the error of writing the file, if any,
+	// which is also the error returned by write then
+	if flushErr := bw.Flush(); flushErr != nil {
+		err = &ruleset.WriteError{Err: flushErr}
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = &ruleset.WriteError{Err: closeErr}
+	}
+	if err != nil || (counter.n == 0 && !keepEmpty) {
+		return false, err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return false, &ruleset.WriteError{Err: err}
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return false, &ruleset.WriteError{Err: err}
+	}
+	return true, nil
+}
+
+// readGFWListUserRules reads the user rules appended to gfwlist.txt, without
+// the `[AutoProxy]` line of the files exported by GFWList clients, and ending
+// with a newline.
+func readGFWListUserRules(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if first, rest, _ := strings.Cut(string(content), "\n"); strings.HasPrefix(strings.TrimSpace(first), "[AutoProxy") {
+		content = []byte(rest)
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	return content, nil
+}
+
+// formatExport is the result of writing the files of a list in a format
+type formatExport struct {
+	// files are the written files, relative to the output path
+	files    []string
+	duration time.Duration
+	err      error
+}
+
+// exportFormat writes the files of the chunks of an exported list in the
+// format, stopping at the first error.
+func exportFormat(filename string, format ruleset.Exporter, chunks []*ruleset.ListInfo) formatExport {
+	started := time.Now()
+	var export formatExport
+	for _, chunk := range chunks {
+		generatedFile := exportedFileName(chunkFileName(filename, chunk), format)
+		written, err := writeOutputFile(filepath.Join(*outputPath, generatedFile), false, func(w io.Writer) error {
+			return format.Write(w, chunk)
+		})
+		if err != nil {
+			export.err = err
+			break
+		}
+		if written {
+			export.files = append(export.files, generatedFile)
+		}
 	}
+	export.duration = time.Since(started)
+	return export
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// manifestFileName is the name of the manifest of the publish directory
+const manifestFileName = "manifest.json"
+
+// Manifest describes the generated files in the publish directory.
+type Manifest struct {
+	SchemaVersion int        `json:"schema_version"`
+	GeneratedAt   *time.Time `json:"generated_at,omitempty"`
+	Files         []string   `json:"files"`
+	// StaleSources lists the remote sources replaced by their last-known-good snapshots
+	StaleSources []ruleset.StaleSource `json:"stale_sources,omitempty"`
+	// Build is the build metadata with -buildinfo
+	Build *BuildInfo `json:"build,omitempty"`
+}
+
+// GenerateManifest writes manifest.json listing all files in the output directory
+// but the checksum and signature files, the stale remote sources and the build
+// metadata, if any.
+func GenerateManifest(outputDir string, staleSources []ruleset.StaleSource, build *BuildInfo) error {
+	if *schemaVersion < ruleset.SchemaV2 {
+		return nil
+	}
+
+	files, err := outputFiles(outputDir)
+	if err != nil {
+		return err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: *schemaVersion,
+		Files:         make([]string, 0, len(files)),
+		StaleSources:  staleSources,
+		Build:         build,
+	}
+	if ruleset.TimeNow != nil {
+		generatedAt := ruleset.TimeNow().UTC()
+		manifest.GeneratedAt = &generatedAt
+	}
+	for _, name := range files {
+		if name == manifestFileName || isVerificationFile(name) {
+			continue
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ruleset.WriteFile(filepath.Join(outputDir, manifestFileName), manifestBytes); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", manifestFileName, outputDir)
+	return nil
+}
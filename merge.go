@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// Conflict resolution policies of the lists in more than one merged dat file
+const (
+	mergePreferFirst = "prefer-first"
+	mergePreferLast  = "prefer-last"
+	mergeUnion       = "union"
+)
+
+var (
+	mergeFlags    = flag.NewFlagSet("merge", flag.ExitOnError)
+	mergeConflict = mergeFlags.String("conflict", mergeUnion, "Resolution of the lists in more than one dat file: prefer-first or prefer-last to keep the list of the first or last file, or union to merge their rules without duplicates")
+	mergeOutput   = mergeFlags.String("output", "merged.dat", "Path to write the merged dat file to")
+	mergeDatName  = mergeFlags.String("datname", "geosite.dat", "Name of the dat file in the publish directories given instead of dat files")
+)
+
+// runMerge merges the lists of dat files, or the dat files of publish
+// directories, into one dat file.
+func runMerge() error {
+	if mergeFlags.NArg() < 2 {
+		return errors.New("merge: two or more dat files or publish directories are required, usage: merge <dat> <dat>...")
+	}
+	switch *mergeConflict {
+	case mergePreferFirst, mergePreferLast, mergeUnion:
+	default:
+		return fmt.Errorf("merge: unknown conflict resolution policy %q, want prefer-first, prefer-last or union", *mergeConflict)
+	}
+
+	geositeLists := make([]*router.GeoSiteList, 0, mergeFlags.NArg())
+	for _, path := range mergeFlags.Args() {
+		geositeList, err := loadDat(path, *mergeDatName)
+		if err != nil {
+			return err
+		}
+		geositeLists = append(geositeLists, geositeList)
+	}
+
+	merged := mergeDats(geositeLists, *mergeConflict)
+	protoBytes, err := proto.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if _, err := writeOutputFile(*mergeOutput, true, func(w io.Writer) error {
+		_, err := w.Write(protoBytes)
+		return err
+	}); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s of %d lists merged from %d dat files has been generated successfully.", *mergeOutput, len(merged.Entry), len(geositeLists))
+	return nil
+}
+
+// loadDat loads a dat file, or the dat file of the name in a publish directory
+func loadDat(path, datName string) (*router.GeoSiteList, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, datName)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	geositeList := new(router.GeoSiteList)
+	if err := proto.Unmarshal(content, geositeList); err != nil {
+		return nil, fmt.Errorf("invalid dat file %s: %w", path, err)
+	}
+	return geositeList, nil
+}
+
+// mergeDats merges the lists of dat files into one, sorted by name. The lists
+// of the same name in more than one file, in any case, are resolved by the
+// conflict policy: the list of the first or the last file, or the union of
+// their rules, where the rules of the same type and value are merged into one
+// with the attributes of all of them.
+func mergeDats(geositeLists []*router.GeoSiteList, conflict string) *router.GeoSiteList {
+	byName := make(map[string]*router.GeoSite)
+	for _, geositeList := range geositeLists {
+		for _, geosite := range geositeList.GetEntry() {
+			name := strings.ToUpper(geosite.GetCountryCode())
+			existing := byName[name]
+			switch {
+			case existing == nil:
+				byName[name] = &router.GeoSite{CountryCode: name, Domain: mergeRules(nil, geosite.GetDomain())}
+			case conflict == mergePreferLast:
+				ruleset.Logger.Debug("merged list replaced", "list", strings.ToLower(name))
+				byName[name] = &router.GeoSite{CountryCode: name, Domain: mergeRules(nil, geosite.GetDomain())}
+			case conflict == mergeUnion:
+				existing.Domain = mergeRules(existing.Domain, geosite.GetDomain())
+			}
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	merged := &router.GeoSiteList{Entry: make([]*router.GeoSite, 0, len(names))}
+	for _, name := range names {
+		merged.Entry = append(merged.Entry, byName[name])
+	}
+	return merged
+}
+
+// mergeRules appends the rules to the merged rules, merging the attributes of
+// the rules of the same type and value as one of them into it.
+func mergeRules(merged, rules []*router.Domain) []*router.Domain {
+	index := make(map[string]int, len(merged)+len(rules))
+	for i, rule := range merged {
+		index[fmt.Sprintf("%d:%s", rule.Type, rule.Value)] = i
+	}
+	for _, rule := range rules {
+		key := fmt.Sprintf("%d:%s", rule.Type, rule.Value)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, proto.Clone(rule).(*router.Domain))
+			continue
+		}
+		attrs := make(map[string]bool, len(merged[i].Attribute))
+		for _, attr := range merged[i].Attribute {
+			attrs[ruleset.AttributeString(attr)] = true
+		}
+		for _, attr := range rule.Attribute {
+			if !attrs[ruleset.AttributeString(attr)] {
+				attrs[ruleset.AttributeString(attr)] = true
+				merged[i].Attribute = append(merged[i].Attribute, proto.Clone(attr).(*router.Domain_Attribute))
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxUserAgentsPerArtifact limits the distinct User-Agents tracked per
+// artifact, the remaining ones are counted as "other".
+const maxUserAgentsPerArtifact = 100
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ArtifactMetrics tracks in memory how many times each served file is
+// requested and by which clients, so that unused lists and formats can
+// be pruned from the build config.
+type ArtifactMetrics struct {
+	mu         sync.Mutex
+	requests   map[string]int64
+	userAgents map[string]map[string]int64
+}
+
+// NewArtifactMetrics creates and returns a new ArtifactMetrics.
+func NewArtifactMetrics() *ArtifactMetrics {
+	return &ArtifactMetrics{
+		requests:   make(map[string]int64),
+		userAgents: make(map[string]map[string]int64),
+	}
+}
+
+// Middleware counts the requests of the files served by the handler.
+func (m *ArtifactMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// Only files actually served are counted, to keep the number of series bounded.
+		// Files are keyed by their paths in the publish directory, as the
+		// files of different formats have the same names in the format layout.
+		if artifact := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"); recorder.status == http.StatusOK && artifact != "" && !strings.HasSuffix(r.URL.Path, "/") {
+			m.record(artifact, r.UserAgent())
+		}
+	})
+}
+
+// statusRecorder records the status code written to a http.ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (m *ArtifactMetrics) record(artifact, userAgent string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[artifact]++
+
+	agents := m.userAgents[artifact]
+	if agents == nil {
+		agents = make(map[string]int64)
+		m.userAgents[artifact] = agents
+	}
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	if _, ok := agents[userAgent]; !ok && len(agents) >= maxUserAgentsPerArtifact {
+		userAgent = "other"
+	}
+	agents[userAgent]++
+}
+
+// ServeHTTP exposes the metrics in Prometheus text format.
+func (m *ArtifactMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("# HELP ruleset_artifact_requests_total Requests of each served file.\n")
+	sb.WriteString("# TYPE ruleset_artifact_requests_total counter\n")
+	artifacts := make([]string, 0, len(m.requests))
+	for artifact := range m.requests {
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Strings(artifacts)
+	for _, artifact := range artifacts {
+		fmt.Fprintf(&sb, "ruleset_artifact_requests_total{artifact=%s} %d\n", labelValue(artifact), m.requests[artifact])
+	}
+
+	sb.WriteString("# HELP ruleset_artifact_user_agent_requests_total Requests of each served file by User-Agent.\n")
+	sb.WriteString("# TYPE ruleset_artifact_user_agent_requests_total counter\n")
+	for _, artifact := range artifacts {
+		agents := make([]string, 0, len(m.userAgents[artifact]))
+		for agent := range m.userAgents[artifact] {
+			agents = append(agents, agent)
+		}
+		sort.Strings(agents)
+		for _, agent := range agents {
+			fmt.Fprintf(&sb, "ruleset_artifact_user_agent_requests_total{artifact=%s,user_agent=%s} %d\n", labelValue(artifact), labelValue(agent), m.userAgents[artifact][agent])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(sb.String()))
+}
+
+// labelValue returns the quoted Prometheus label value
+func labelValue(s string) string {
+	return `"` + labelValueReplacer.Replace(s) + `"`
+}
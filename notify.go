@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+const (
+	// notifyMaxChangedLists is the number of changed lists shown in Telegram messages
+	notifyMaxChangedLists = 20
+	// notifyMaxTextLength is the limit of the length of Telegram messages
+	notifyMaxTextLength = 4096
+)
+
+// BuildSummary is the summary of a generation, sent to the notification targets.
+type BuildSummary struct {
+	// Status is "ok" or "failed"
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Started  string `json:"started"`
+	Duration string `json:"duration"`
+	Lists    int    `json:"lists"`
+	Rules    int    `json:"rules"`
+	// Changed is the lists changed since the previous dat file in the output path
+	Changed []ChangedList `json:"changed"`
+	// Errors is the errors that did not fail the generation, eg: broken IP sources
+	Errors []string `json:"errors"`
+	// stats is the stats of the generated files, for the summary table
+	stats *Stats
+}
+
+// ChangedList is a changed list in a BuildSummary, with the numbers of changed rules.
+type ChangedList struct {
+	List string `json:"list"`
+	// Status is "added" or "removed" for whole lists, or "changed"
+	Status  string `json:"status"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// currentBuild is the summary of the running generation
+var currentBuild *BuildSummary
+
+// setChanged records the changed lists of the differences of the dat file
+func (s *BuildSummary) setChanged(diffs []ListDiff) {
+	s.Changed = make([]ChangedList, 0, len(diffs))
+	for _, diff := range diffs {
+		s.Changed = append(s.Changed, ChangedList{List: diff.List, Status: diff.Status, Added: len(diff.Added), Removed: len(diff.Removed)})
+	}
+}
+
+// setStats records the stats of the generated files
+func (s *BuildSummary) setStats(stats *Stats) {
+	if s != nil {
+		s.stats = stats
+	}
+}
+
+// addError records an error that did not fail the generation
+func (s *BuildSummary) addError(format string, a ...interface{}) {
+	if s != nil {
+		s.Errors = append(s.Errors, fmt.Sprintf(format, a...))
+	}
+}
+
+// runGenerate generates all the files, then sends the summary of the
+// generation to the notification targets, if any.
+func runGenerate() error {
+	started := time.Now()
+	currentBuild = &BuildSummary{
+		Status:  "ok",
+		Started: started.UTC().Format(time.RFC3339),
+		Changed: make([]ChangedList, 0),
+		Errors:  make([]string, 0),
+	}
+	ruleset.Timing.Reset()
+	stopRecording := recordWarnings()
+	err := generate()
+	warnings := stopRecording()
+	summary := currentBuild
+	currentBuild = nil
+	summary.Duration = time.Since(started).Round(time.Millisecond).String()
+	if *runReportPath != "" {
+		if reportErr := writeRunReport(*runReportPath, newRunReport(summary, err, warnings)); reportErr != nil {
+			ruleset.Logf(slog.LevelWarn, "failed to write the run report: %v", reportErr)
+		}
+	}
+	// The dry run logs the timings itself, after the messages of generating in the temporary directory
+	if !*dryRun {
+		logTimings(time.Since(started))
+		if err == nil {
+			printSummary(summary.stats, time.Since(started))
+		}
+	}
+
+	if (*notifyWebhook == "" && *notifyTelegramChat == "") || *dryRun {
+		return err
+	}
+	if err != nil {
+		summary.Status, summary.Error = "failed", err.Error()
+	}
+	if notifyErr := Notify(summary); notifyErr != nil {
+		ruleset.Logf(slog.LevelWarn, "failed to send notification: %v", notifyErr)
+	}
+	return err
+}
+
+// Notify sends the summary of a generation to the webhook and the Telegram chat
+// of the options. The Telegram bot token is the -telegramtoken option, or the
+// TELEGRAM_BOT_TOKEN env to keep it out of the process list.
+func Notify(summary *BuildSummary) error {
+	client, err := NewHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+	client.Timeout = 30 * time.Second
+
+	if *notifyWebhook != "" {
+		body, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		if err := postNotification(client, *notifyWebhook, "application/json", body); err != nil {
+			return fmt.Errorf("webhook: %w", err)
+		}
+	}
+
+	if *notifyTelegramChat != "" {
+		token := *notifyTelegramToken
+		if token == "" {
+			token = os.Getenv("TELEGRAM_BOT_TOKEN")
+		}
+		if token == "" {
+			return fmt.Errorf("telegram: no bot token, set -telegramtoken or the TELEGRAM_BOT_TOKEN env")
+		}
+		text := summary.Text()
+		if len(text) > notifyMaxTextLength {
+			text = strings.ToValidUTF8(text[:notifyMaxTextLength-4], "") + "\n..."
+		}
+		form := url.Values{"chat_id": {*notifyTelegramChat}, "text": {text}}
+		endpoint := "https://api.telegram.org/bot" + token + "/sendMessage"
+		if err := postNotification(client, endpoint, "application/x-www-form-urlencoded", []byte(form.Encode())); err != nil {
+			// The error of the client contains the URL, with the token in it
+			return fmt.Errorf("telegram: %s", strings.ReplaceAll(err.Error(), token, "<token>"))
+		}
+	}
+	return nil
+}
+
+func postNotification(client *http.Client, endpoint, contentType string, body []byte) error {
+	resp, err := client.Post(endpoint, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Text returns the summary in plain text, for chat messages.
+func (s *BuildSummary) Text() string {
+	var sb strings.Builder
+	if s.Status == "ok" {
+		fmt.Fprintf(&sb, "rule-set: generated in %s\n", s.Duration)
+	} else {
+		fmt.Fprintf(&sb, "rule-set: FAILED after %s\n%s\n", s.Duration, s.Error)
+	}
+	if s.Lists > 0 {
+		fmt.Fprintf(&sb, "%d lists, %d rules\n", s.Lists, s.Rules)
+	}
+
+	if len(s.Changed) > 0 {
+		fmt.Fprintf(&sb, "\n%d lists changed:\n", len(s.Changed))
+		for i, diff := range s.Changed {
+			if i == notifyMaxChangedLists {
+				fmt.Fprintf(&sb, "... and %d more\n", len(s.Changed)-i)
+				break
+			}
+			switch diff.Status {
+			case "added":
+				fmt.Fprintf(&sb, "%s: new, %d rules\n", diff.List, diff.Added)
+			case "removed":
+				fmt.Fprintf(&sb, "%s: removed\n", diff.List)
+			default:
+				fmt.Fprintf(&sb, "%s: +%d -%d\n", diff.List, diff.Added, diff.Removed)
+			}
+		}
+	}
+
+	if len(s.Errors) > 0 {
+		fmt.Fprintf(&sb, "\n%d errors:\n", len(s.Errors))
+		for _, err := range s.Errors {
+			sb.WriteString(err + "\n")
+		}
+	}
+	return sb.String()
+}
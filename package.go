@@ -0,0 +1,201 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	packageFlags      = flag.NewFlagSet("package", flag.ExitOnError)
+	packagePath       = packageFlags.String("path", "./publish", "Path to the publish directory to be packaged")
+	packageOutputPath = packageFlags.String("outputpath", "./release", "Output path to the bundles")
+	packageFormat     = packageFlags.String("format", "zip", "Archive format of the bundles, zip or tar.gz")
+	packageSplit      = packageFlags.Bool("split", false, "Also package a bundle for each client, eg: surge.zip, singbox.zip, clash.zip, v2ray.zip")
+)
+
+// packageClient is a client with its own bundle, containing the files of its formats.
+type packageClient struct {
+	Name       string
+	Extensions []string
+	// Excludes are the extensions of other clients ending with one of the extensions
+	Excludes []string
+}
+
+var packageClients = []packageClient{
+	{Name: "surge", Extensions: []string{".list", ".sgmodule"}},
+	{Name: "singbox", Extensions: []string{".json", ".srs", ".db"}, Excludes: []string{".v2ray.json"}},
+	{Name: "clash", Extensions: []string{".yaml", ".mihomo.txt"}, Excludes: []string{".egern.yaml"}},
+	{Name: "quantumultx", Extensions: []string{".snippet"}},
+	{Name: "stash", Extensions: []string{".stoverride"}},
+	{Name: "v2ray", Extensions: []string{".dat", ".v2ray.json"}},
+	{Name: "egern", Extensions: []string{".egern.yaml"}},
+}
+
+// packageMetaFiles are included in every bundle
+var packageMetaFiles = map[string]bool{
+	manifestFileName: true,
+	statsFileName:    true,
+	checksumFileName: true,
+}
+
+// runPackage archives the publish directory into a bundle, and a bundle
+// for each client with -split, ready to be attached to a GitHub Release.
+func runPackage() error {
+	var extension string
+	switch *packageFormat {
+	case "zip":
+		extension = ".zip"
+	case "tar.gz", "tgz":
+		extension = ".tar.gz"
+	default:
+		return errors.New("package: unsupported format: " + *packageFormat)
+	}
+
+	files, err := outputFiles(*packagePath)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, name := range files {
+		// Bundles are compressed already, so the compressed variants are left out
+		if !isCompressedFile(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("package: no files in '%s'", *packagePath)
+	}
+
+	if err := ruleset.MkdirAll(*packageOutputPath); err != nil {
+		return err
+	}
+	if err := writeBundle("rule-set"+extension, names); err != nil {
+		return err
+	}
+	if !*packageSplit {
+		return nil
+	}
+
+	for _, client := range packageClients {
+		var clientNames []string
+		for _, name := range names {
+			if packageMetaFiles[name] || client.hasFile(name) {
+				clientNames = append(clientNames, name)
+			}
+		}
+		if err := writeBundle(client.Name+extension, clientNames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasFile reports whether the file, or the file signed by a signature, is of a format of the client
+func (c packageClient) hasFile(name string) bool {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".minisig"), ".asc")
+	for _, extension := range c.Excludes {
+		if strings.HasSuffix(name, extension) {
+			return false
+		}
+	}
+	for _, extension := range c.Extensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBundle archives the files of the publish directory into a bundle in the output path
+func writeBundle(bundle string, names []string) error {
+	f, err := os.Create(filepath.Join(*packageOutputPath, bundle))
+	if err != nil {
+		return &ruleset.WriteError{Err: err}
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(bundle, ".zip") {
+		err = writeZip(f, names)
+	} else {
+		err = writeTarGz(f, names)
+	}
+	if err != nil {
+		return fmt.Errorf("package %s: %w", bundle, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s of %d files has been packaged successfully in '%s'.", bundle, len(names), *packageOutputPath)
+	return nil
+}
+
+func writeZip(w io.Writer, names []string) error {
+	zipWriter := zip.NewWriter(w)
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(*packagePath, name))
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name, header.Method = name, zip.Deflate
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(writer, name); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func writeTarGz(w io.Writer, names []string) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(*packagePath, name))
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tarWriter, name); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// copyFile copies a file of the publish directory into w
+func copyFile(w io.Writer, name string) error {
+	f, err := os.Open(filepath.Join(*packagePath, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
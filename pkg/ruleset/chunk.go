@@ -0,0 +1,104 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// SplitChunks splits a list whose files would have more than maxRules rules,
+// or more than maxBytes bytes in any of the formats, into numbered chunks
+// named like `GEOLOCATION-!CN.PART1`, with the same rules in the chunks of
+// every format. The list itself is returned if it fits, and the limits of
+// zero are unlimited. A chunk of a single rule is kept even if it is larger
+// than maxBytes.
+func SplitChunks(l *ListInfo, formats []Exporter, maxRules int, maxBytes int64) ([]*ListInfo, error) {
+	rules := l.GeoSite.GetDomain()
+	step := len(rules)
+	if maxRules > 0 && maxRules < step {
+		step = maxRules
+	}
+	var groups [][]*router.Domain
+	for start := 0; start < len(rules); start += step {
+		groups = append(groups, rules[start:min(start+step, len(rules))])
+	}
+
+	if maxBytes > 0 {
+		// Halve the groups until their files fit in maxBytes in all formats,
+		// without logging the notices of the formats about the trial files
+		logger := Logger
+		Logger = slog.New(NewTextHandler(io.Discard, slog.LevelError))
+		defer func() { Logger = logger }()
+		var fitted [][]*router.Domain
+		for len(groups) > 0 {
+			group := groups[0]
+			groups = groups[1:]
+			fits, err := l.chunk(1, group).fits(formats, maxBytes)
+			if err != nil {
+				return nil, err
+			}
+			if fits || len(group) == 1 {
+				fitted = append(fitted, group)
+				continue
+			}
+			half := len(group) / 2
+			groups = append([][]*router.Domain{group[:half], group[half:]}, groups...)
+		}
+		groups = fitted
+	}
+
+	if len(groups) <= 1 {
+		return []*ListInfo{l}, nil
+	}
+	chunks := make([]*ListInfo, 0, len(groups))
+	for i, group := range groups {
+		chunks = append(chunks, l.chunk(i+1, group))
+	}
+	return chunks, nil
+}
+
+// chunk returns the numbered chunk of the list with the rules
+func (l *ListInfo) chunk(number int, rules []*router.Domain) *ListInfo {
+	chunk := NewListInfo()
+	chunk.Name = l.Name + FileName(fmt.Sprintf(".PART%d", number))
+	chunk.Parent = l.Name
+	chunk.Chunk = number
+	chunk.Policy = l.Policy
+	chunk.MihomoBehavior = l.MihomoBehavior
+	chunk.GeoSite = &router.GeoSite{CountryCode: string(chunk.Name), Domain: rules}
+	return chunk
+}
+
+// fits reports whether the files of the list are at most maxBytes in all formats
+func (l *ListInfo) fits(formats []Exporter, maxBytes int64) (bool, error) {
+	for _, format := range formats {
+		w := &limitedCounter{limit: maxBytes}
+		if err := format.Write(w, l); err != nil && !errors.Is(err, errChunkTooLarge) {
+			return false, err
+		}
+		if w.n > maxBytes {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// errChunkTooLarge stops writing a chunk once it is larger than the limit
+var errChunkTooLarge = errors.New("chunk too large")
+
+// limitedCounter counts the bytes written to it, and fails once they exceed the limit
+type limitedCounter struct {
+	n     int64
+	limit int64
+}
+
+func (w *limitedCounter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	if w.n > w.limit {
+		return 0, errChunkTooLarge
+	}
+	return len(p), nil
+}
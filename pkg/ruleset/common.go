@@ -0,0 +1,186 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FileName is the name of a list, the uppercase name of its file in the data
+// directory, with the namespace if any, eg: `GEOLOCATION-!CN`, `UPSTREAM:GOOGLE`.
+type FileName string
+
+// Attribute is an attribute of rules, eg: `cn`, or with the `@` prefix in
+// the attributes of inclusions, eg: `@cn`.
+type Attribute string
+
+// TimeNow returns the time written into the headers of generated files.
+// It is replaced with a fixed time to generate byte-identical outputs,
+// or set to nil to omit the time.
+var TimeNow = time.Now
+
+// SetReproducibleTime fixes the time written into the headers of generated files
+// to SOURCE_DATE_EPOCH in seconds, or omits the time if it is empty.
+func SetReproducibleTime(sourceDateEpoch string) error {
+	if sourceDateEpoch == "" {
+		TimeNow = nil
+		return nil
+	}
+	seconds, err := strconv.ParseInt(sourceDateEpoch, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid SOURCE_DATE_EPOCH: %s", sourceDateEpoch)
+	}
+	fixed := time.Unix(seconds, 0).UTC()
+	TimeNow = func() time.Time { return fixed }
+	return nil
+}
+
+// isEmpty checks if the rule that has been trimmed out spaces is empty
+func isEmpty(s string) bool {
+	return len(strings.TrimSpace(s)) == 0
+}
+
+// removeComment removes comments in the rule
+func removeComment(line string) string {
+	idx := strings.Index(line, "#")
+	if idx == -1 {
+		return line
+	}
+	return strings.TrimSpace(line[:idx])
+}
+
+// ParseExcludeAttrs parses the -excludeattrs option into a map of
+// file names and the attributes to be excluded from them,
+// eg: `geolocation-!cn@cn@ads,geolocation-cn@!cn`.
+func ParseExcludeAttrs(excludeAttrs string) map[FileName]map[Attribute]bool {
+	excludeAttrsInFile := make(map[FileName]map[Attribute]bool)
+	if excludeAttrs == "" {
+		return excludeAttrsInFile
+	}
+	exFilenameAttrSlice := strings.Split(excludeAttrs, ",")
+	for _, exFilenameAttr := range exFilenameAttrSlice {
+		exFilenameAttr = strings.TrimSpace(exFilenameAttr)
+		exFilenameAttrMap := strings.Split(exFilenameAttr, "@")
+		filename := FileName(strings.ToUpper(strings.TrimSpace(exFilenameAttrMap[0])))
+		excludeAttrsInFile[filename] = make(map[Attribute]bool)
+		for _, attr := range exFilenameAttrMap[1:] {
+			attr = strings.TrimSpace(attr)
+			if len(attr) > 0 {
+				excludeAttrsInFile[filename][Attribute(attr)] = true
+			}
+		}
+	}
+	return excludeAttrsInFile
+}
+
+// yamlQuote returns the string as a quoted YAML scalar. Single quotes are
+// used whenever possible, as they only need the quote itself to be doubled.
+// Strings with control characters fall back to double quotes with escapes.
+func yamlQuote(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) == -1 {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&sb, "\\u%04x", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// isListFieldSafe checks if the rule value can be written as a field of
+// comma separated rule lines (Surge, Quantumult X), which have no escaping syntax.
+func isListFieldSafe(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r == ',' || r == '"' || r == '#' || r == ';' || unicode.IsSpace(r) || unicode.IsControl(r)
+	}) == -1
+}
+
+// cleanDomain tolerates the common forms of domains pasted from browsers or
+// other lists, eg: `https://www.Example.com:443/path`, `*.example.com` and
+// `example.com.`, and returns the bare domain. Leading `*.` is only allowed
+// if wildcard is true, as for domain type rules.
+func cleanDomain(domain string, wildcard bool) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	for _, scheme := range []string{"http://", "https://"} {
+		domain = strings.TrimPrefix(domain, scheme)
+	}
+	if idx := strings.IndexAny(domain, "/?"); idx != -1 {
+		domain = domain[:idx]
+	}
+	if idx := strings.LastIndex(domain, ":"); idx != -1 && isPort(domain[idx+1:]) {
+		domain = domain[:idx]
+	}
+	if idx := strings.Index(domain, ":"); idx != -1 {
+		return "", errors.New("unknown domain type: " + domain[:idx])
+	}
+	if strings.HasPrefix(domain, "*.") {
+		if !wildcard {
+			return "", errors.New("wildcard is only allowed in domain type rule: " + domain)
+		}
+		domain = domain[2:]
+	}
+	domain = strings.TrimRight(strings.TrimLeft(domain, "."), ".")
+	if domain == "" {
+		return "", errors.New("empty domain")
+	}
+	return domain, nil
+}
+
+func isPort(s string) bool {
+	if s == "" || len(s) > 5 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteError is an error of writing an output file or directory, told apart
+// from the errors of reading the inputs.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteFile writes an output file like os.WriteFile with the 0644 permission,
+// and returns a *WriteError on failure.
+func WriteFile(name string, data []byte) error {
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return &WriteError{Err: err}
+	}
+	return nil
+}
+
+// MkdirAll creates an output directory like os.MkdirAll with the 0755
+// permission, and returns a *WriteError on failure.
+func MkdirAll(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return &WriteError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package ruleset
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzYAMLQuote(f *testing.F) {
+	for _, s := range []string{"", "example.com", "it's", `"quoted"`, `back\slash`, "tab\there", "new\nline", "\x7f", "中国"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip()
+		}
+		quoted := yamlQuote(s)
+		unquoted, err := yamlUnquote(quoted)
+		if err != nil {
+			t.Fatalf("yamlUnquote(%s): %v", quoted, err)
+		}
+		if unquoted != s {
+			t.Fatalf("yamlUnquote(yamlQuote(%q)) = %q", s, unquoted)
+		}
+	})
+}
+
+func FuzzIsListFieldSafe(f *testing.F) {
+	for _, s := range []string{"example.com", "a,b", "a b", "a#b", "a;b", `a"b`, " ", "中国"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if s == "" || !isListFieldSafe(s) {
+			t.Skip()
+		}
+		for _, format := range []string{"surge", "quantumultx"} {
+			rule, err := parseExportedLine(format, "DOMAIN-SUFFIX,"+s+",PROXY")
+			if err != nil {
+				t.Fatalf("%s: parse %q: %v", format, s, err)
+			}
+			if rule.GetValue() != s {
+				t.Fatalf("%s: field %q parsed back as %q", format, s, rule.GetValue())
+			}
+		}
+	})
+}
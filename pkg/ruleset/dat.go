@@ -0,0 +1,46 @@
+package ruleset
+
+import (
+	"fmt"
+	"io"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// datExporter is the format of the dat files of single lists, eg: `cn.dat`
+var datExporter = exporterFunc{name: "dat", extension: "dat", write: (*ListInfo).WriteDat}
+
+// RegisterDatExporter registers the dat format, exporting a dat file of each
+// exported list besides the dat file of all lists. It is not registered by
+// default, and registering it again has no effect.
+func RegisterDatExporter() {
+	if FindExporter(datExporter.Name()) == nil {
+		RegisterExporter(datExporter)
+	}
+}
+
+// WriteDat writes a dat file of the single entry of the list to w, for the
+// clients using a list without loading the whole dat file, eg: `ext:cn.dat:cn`
+// in V2Ray and Xray.
+func (l *ListInfo) WriteDat(w io.Writer) error {
+	protoBytes, err := proto.Marshal(&router.GeoSiteList{Entry: []*router.GeoSite{l.GeoSite}})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(protoBytes)
+	return err
+}
+
+// parseDatExported returns the rules of all entries of a dat file
+func parseDatExported(content []byte) ([]*router.Domain, error) {
+	geositeList := new(router.GeoSiteList)
+	if err := proto.Unmarshal(content, geositeList); err != nil {
+		return nil, fmt.Errorf("invalid dat file: %w", err)
+	}
+	var rules []*router.Domain
+	for _, geosite := range geositeList.GetEntry() {
+		rules = append(rules, geosite.GetDomain()...)
+	}
+	return rules, nil
+}
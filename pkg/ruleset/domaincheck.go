@@ -0,0 +1,115 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Modes of the -domaincheck option.
+const (
+	DomainCheckOff    = "off"
+	DomainCheckReport = "report"
+	DomainCheckStrict = "strict"
+)
+
+// specialUseTLDs are top-level names that are not delegated in the DNS root,
+// but are commonly used for private networks and thus valid in rules.
+var specialUseTLDs = map[string]bool{
+	"localhost":   true,
+	"local":       true,
+	"test":        true,
+	"invalid":     true,
+	"example":     true,
+	"onion":       true,
+	"internal":    true,
+	"lan":         true,
+	"home":        true,
+	"corp":        true,
+	"localdomain": true,
+}
+
+// CheckDomainCheckMode checks the mode of the -domaincheck option.
+func CheckDomainCheckMode(mode string) error {
+	switch mode {
+	case DomainCheckOff, DomainCheckReport, DomainCheckStrict:
+		return nil
+	}
+	return errors.New("unknown domain check mode: " + mode)
+}
+
+// checkDomainRule reports the issues of a full or domain type rule found
+// by checkDomain, as warnings in report mode, or as an error in strict mode.
+func checkDomainRule(source string, lineNumber int, rawLine string, rule *router.Domain) error {
+	if DomainCheck == DomainCheckOff {
+		return nil
+	}
+	for _, issue := range domainIssues(rule) {
+		if DomainCheck == DomainCheckStrict {
+			return &ParseError{File: source, Line: lineNumber, Raw: rawLine, Err: errors.New(issue)}
+		}
+		Logf(slog.LevelWarn, "%s:%d: %s: %q", source, lineNumber, issue, strings.TrimSpace(rawLine))
+	}
+	return nil
+}
+
+// domainIssues returns the issues of the value of a full or domain type rule:
+// labels violating RFC 1035, an unknown top-level domain, or being a bare
+// public suffix of the Public Suffix List. Single-label rules like `domain:cn`
+// are not reported as public suffixes, as they are used to match a whole TLD.
+func domainIssues(rule *router.Domain) []string {
+	if rule.Type != router.Domain_Full && rule.Type != router.Domain_RootDomain {
+		return nil
+	}
+	domain := rule.Value
+
+	var issues []string
+	if err := checkLabels(domain); err != nil {
+		return append(issues, err.Error())
+	}
+
+	labels := strings.Split(domain, ".")
+	tld := labels[len(labels)-1]
+	if _, icann := publicsuffix.PublicSuffix(tld); !icann && !specialUseTLDs[tld] {
+		issues = append(issues, fmt.Sprintf("unknown top-level domain %q", tld))
+	}
+
+	if suffix, icann := publicsuffix.PublicSuffix(domain); len(labels) > 1 && suffix == domain {
+		if icann {
+			issues = append(issues, "domain is a public suffix")
+		} else {
+			issues = append(issues, "domain is a private public suffix")
+		}
+	}
+
+	return issues
+}
+
+// checkLabels checks the syntax of a domain name according to RFC 1035,
+// with the relaxation of RFC 1123 allowing labels to start with a digit.
+func checkLabels(domain string) error {
+	if len(domain) > 253 {
+		return errors.New("domain is longer than 253 characters")
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" {
+			return errors.New("domain has an empty label")
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("label %q contains invalid character %q", label, c)
+			}
+		}
+	}
+	return nil
+}
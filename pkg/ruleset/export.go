@@ -0,0 +1,227 @@
+package ruleset
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Exporter converts lists into an output format. Exporters of other formats
+// can be added to the ones of this package with RegisterExporter.
+type Exporter interface {
+	// Name is the name of the format in the -export option, eg: "surge"
+	Name() string
+	// Extension is the file extension of the generated files, without the dot, eg: "list"
+	Extension() string
+	// Write writes the content of the file of a list to w, from the rules of
+	// the list converted by ToGeoSite. The file is skipped if nothing is written.
+	Write(w io.Writer, l *ListInfo) error
+}
+
+// exporterFunc is an Exporter of a writing method of ListInfo
+type exporterFunc struct {
+	name      string
+	extension string
+	write     func(*ListInfo, io.Writer) error
+}
+
+func (e exporterFunc) Name() string      { return e.name }
+func (e exporterFunc) Extension() string { return e.extension }
+
+func (e exporterFunc) Write(w io.Writer, l *ListInfo) error {
+	return e.write(l, w)
+}
+
+// exporters is the registry of the output formats of the exported lists, in the order of generation.
+var exporters = []Exporter{
+	exporterFunc{name: "text", extension: "txt", write: (*ListInfo).WritePlainText},
+	exporterFunc{name: "surge", extension: "list", write: (*ListInfo).WriteSurgeList},
+	exporterFunc{name: "mihomo", extension: "yaml", write: (*ListInfo).WriteMihomoList},
+	exporterFunc{name: "mihomotext", extension: "mihomo.txt", write: (*ListInfo).WriteMihomoText},
+	exporterFunc{name: "singbox", extension: "json", write: (*ListInfo).WriteSingBoxList},
+	exporterFunc{name: "quantumultx", extension: "snippet", write: (*ListInfo).WriteQuantumultXList},
+	exporterFunc{name: "stash", extension: "stoverride", write: (*ListInfo).WriteStashOverride},
+	exporterFunc{name: "v2ray", extension: "v2ray.json", write: (*ListInfo).WriteV2RayRules},
+	exporterFunc{name: "egern", extension: "egern.yaml", write: (*ListInfo).WriteEgernRuleSet},
+}
+
+// RegisterExporter adds an output format to the registry, generated after the
+// registered ones. It panics if the name or the extension is already registered,
+// like the registration functions of the standard library.
+func RegisterExporter(exporter Exporter) {
+	if FindExporter(exporter.Name()) != nil || FindExporter(exporter.Extension()) != nil {
+		panic("ruleset: RegisterExporter called twice for format " + exporter.Name())
+	}
+	exporters = append(exporters, exporter)
+}
+
+// Exporters returns the registered output formats, in the order of generation.
+func Exporters() []Exporter {
+	return append([]Exporter(nil), exporters...)
+}
+
+// FindExporter returns the output format of the name or the file extension, or nil if not found.
+func FindExporter(name string) Exporter {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, exporter := range exporters {
+		if exporter.Name() == name || exporter.Extension() == name {
+			return exporter
+		}
+	}
+	return nil
+}
+
+// ExportFlag is the repeatable -export option, mapping output formats to the
+// lists exported in them, eg: `-export surge=cn,google -export singbox=all`.
+type ExportFlag map[string][]string
+
+func (e ExportFlag) String() string {
+	formats := make([]string, 0, len(e))
+	for format, lists := range e {
+		formats = append(formats, format+"="+strings.Join(lists, ","))
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, " ")
+}
+
+func (e ExportFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return errors.New("export must be in `format=list1,list2` format")
+	}
+	// Formats unknown yet may be registered later, eg: from templates, see Check
+	name := strings.ToLower(strings.TrimSpace(kv[0]))
+	if format := FindExporter(name); format != nil {
+		name = format.Name()
+	}
+	lists := make([]string, 0)
+	for _, list := range strings.Split(kv[1], ",") {
+		if list = strings.TrimSpace(list); list != "" {
+			lists = append(lists, list)
+		}
+	}
+	e[name] = lists
+	return nil
+}
+
+// Check reports the formats of the option that are not registered,
+// and replaces the file extensions of the option with the format names.
+func (e ExportFlag) Check() error {
+	for name, lists := range e {
+		format := FindExporter(name)
+		if format == nil {
+			return errors.New("unknown export format: " + name)
+		}
+		if format.Name() != name {
+			delete(e, name)
+			e[format.Name()] = lists
+		}
+	}
+	return nil
+}
+
+// ExcludeAttrsFlag is the repeatable -formatexcludeattrs option, mapping output
+// formats to the attributes excluded from their lists instead of the ones of
+// -excludeattrs, in the same syntax, eg: `-formatexcludeattrs adblock=` keeps
+// all rules in the adblock format.
+type ExcludeAttrsFlag map[string]string
+
+func (e ExcludeAttrsFlag) String() string {
+	formats := make([]string, 0, len(e))
+	for format, excludeAttrs := range e {
+		formats = append(formats, format+"="+excludeAttrs)
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, " ")
+}
+
+func (e ExcludeAttrsFlag) Set(value string) error {
+	name, excludeAttrs, ok := strings.Cut(value, "=")
+	if !ok {
+		return errors.New("formatexcludeattrs must be in `format=list@attr1@attr2,list2@attr1` format")
+	}
+	// Formats unknown yet may be registered later, eg: from templates, see Check
+	name = strings.ToLower(strings.TrimSpace(name))
+	if format := FindExporter(name); format != nil {
+		name = format.Name()
+	}
+	e[name] = strings.TrimSpace(excludeAttrs)
+	return nil
+}
+
+// Check reports the formats of the option that are not registered,
+// and replaces the file extensions of the option with the format names.
+func (e ExcludeAttrsFlag) Check() error {
+	for name, excludeAttrs := range e {
+		format := FindExporter(name)
+		if format == nil {
+			return errors.New("unknown format to exclude attributes from: " + name)
+		}
+		if format.Name() != name {
+			delete(e, name)
+			e[format.Name()] = excludeAttrs
+		}
+	}
+	return nil
+}
+
+// For returns the excluded attributes of the format, or the default ones if
+// the option does not override them for the format.
+func (e ExcludeAttrsFlag) For(format string, defaults map[FileName]map[Attribute]bool) map[FileName]map[Attribute]bool {
+	if excludeAttrs, ok := e[format]; ok {
+		return ParseExcludeAttrs(excludeAttrs)
+	}
+	return defaults
+}
+
+// ExportPlan returns the lists to be exported, and the output formats of each,
+// from the lists of the -export option or the -exportlists ones by default.
+// The list name `all` exports all lists in the data directory.
+func (lm *ListInfoMap) ExportPlan(defaultLists []string, perFormat ExportFlag) ([]string, map[string][]Exporter) {
+	var lists []string
+	formatsOfList := make(map[string][]Exporter)
+	for _, format := range exporters {
+		formatLists, ok := perFormat[format.Name()]
+		if !ok {
+			formatLists = defaultLists
+		}
+		for _, list := range lm.expandAll(formatLists) {
+			formats, ok := formatsOfList[list]
+			if !ok {
+				lists = append(lists, list)
+			}
+			if len(formats) == 0 || formats[len(formats)-1].Name() != format.Name() {
+				formatsOfList[list] = append(formats, format)
+			}
+		}
+	}
+	return lists, formatsOfList
+}
+
+// expandAll replaces the list name `all` with the lowercase names of all lists
+func (lm *ListInfoMap) expandAll(lists []string) []string {
+	expanded := make([]string, 0, len(lists))
+	for _, list := range lists {
+		if strings.ToLower(list) != "all" {
+			expanded = append(expanded, list)
+			continue
+		}
+		names := make([]string, 0, len(*lm))
+		for name := range *lm {
+			names = append(names, strings.ToLower(string(name)))
+		}
+		sort.Strings(names)
+		expanded = append(expanded, names...)
+	}
+	return expanded
+}
+
+// FormatNames returns the names of the formats, eg: "text,surge"
+func FormatNames(formats []Exporter) string {
+	names := make([]string, 0, len(formats))
+	for _, format := range formats {
+		names = append(names, format.Name())
+	}
+	return strings.Join(names, ",")
+}
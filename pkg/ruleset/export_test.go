@@ -0,0 +1,62 @@
+package ruleset
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// FuzzExporters writes the lists of the fuzzed data files in every format
+// that can be verified, and checks that the rules parsed back are the rules of
+// the list, besides the ones dropped as documented. The full and domain rules
+// are checked in strict mode, as the formats have no syntax for other domains.
+func FuzzExporters(f *testing.F) {
+	domainCheck := DomainCheck
+	DomainCheck = DomainCheckStrict
+	f.Cleanup(func() { DomainCheck = domainCheck })
+	for _, s := range []string{
+		"example.com\nfull:www.example.com @cn",
+		"keyword:google\nregexp:^ad[0-9]+\\.example\\.com$",
+		"wildcard:*.cdn.example.com\ndomain:a.example.com @ads @!cn",
+		"full:it's.example.com",
+		"domain:中国",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		list := NewListInfo()
+		list.Name = "FUZZ"
+		for _, line := range strings.Split(data, "\n") {
+			if isEmpty(removeComment(line)) {
+				continue
+			}
+			rule, err := list.parseRule(removeComment(line))
+			if err != nil || rule == nil || checkDomainRule("fuzz", 1, line, rule) != nil {
+				t.Skip()
+			}
+			list.classifyRule(rule)
+		}
+		lm := ListInfoMap{list.Name: list}
+		if err := lm.Flatten(); err != nil {
+			t.Skip()
+		}
+		list.ToGeoSite(nil, nil)
+
+		for _, exporter := range Exporters() {
+			if !CanVerify(exporter.Name()) {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := exporter.Write(&buf, list); err != nil {
+				t.Fatalf("%s: %v", exporter.Name(), err)
+			}
+			result, err := list.VerifyExported(exporter.Name(), buf.Bytes(), nil, nil)
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", exporter.Name(), err, buf.String())
+			}
+			if len(result.Missing) > 0 || len(result.Unexpected) > 0 {
+				t.Fatalf("%s: missing %v, unexpected %v\n%s", exporter.Name(), result.Missing, result.Unexpected, buf.String())
+			}
+		}
+	})
+}
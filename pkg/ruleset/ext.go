@@ -0,0 +1,104 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// extDats is the cache of the dat files referenced by `ext` rules.
+var extDats = &extDatCache{dats: make(map[string]*router.GeoSiteList)}
+
+// extDatCache loads the dat files referenced by `ext` rules,
+// from a local path or a URL, once per run.
+type extDatCache struct {
+	mu   sync.Mutex
+	dats map[string]*router.GeoSiteList
+}
+
+// Get returns the parsed dat file of a local path or a URL.
+func (c *extDatCache) Get(source string) (*router.GeoSiteList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dat, ok := c.dats[source]; ok {
+		return dat, nil
+	}
+
+	var body []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		body, err = remoteLists.Get(source)
+	} else {
+		body, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dat := new(router.GeoSiteList)
+	if err := proto.Unmarshal(body, dat); err != nil {
+		return nil, fmt.Errorf("invalid dat file %s: %w", source, err)
+	}
+	c.dats[source] = dat
+	return dat, nil
+}
+
+// parseExtInclusion imports the rules of a category from an existing dat file,
+// eg: `ext:geosite.dat:category-ads-all`, `ext:https://example.com/geosite.dat:google @cn`.
+// With attributes, only the rules with any of the attributes are imported.
+func (l *ListInfo) parseExtInclusion(inclusion string) error {
+	parts := strings.Fields(strings.TrimPrefix(strings.TrimSpace(inclusion), "ext:"))
+	if len(parts) == 0 {
+		return errors.New("empty ext rule")
+	}
+	idx := strings.LastIndex(parts[0], ":")
+	if idx <= 0 || idx == len(parts[0])-1 {
+		return errors.New("ext rule must be in `ext:file:category` format")
+	}
+	source, category := parts[0][:idx], strings.ToUpper(parts[0][idx+1:])
+
+	attrsWanted := make(map[Attribute]bool)
+	for _, attrString := range parts[1:] {
+		attr, err := l.parseAttribute(attrString)
+		if err != nil {
+			return err
+		}
+		attrsWanted[Attribute(AttributeString(attr))] = true
+	}
+
+	dat, err := extDats.Get(source)
+	if err != nil {
+		return err
+	}
+
+	for _, geosite := range dat.GetEntry() {
+		if strings.ToUpper(geosite.GetCountryCode()) != category {
+			continue
+		}
+		for _, domain := range geosite.GetDomain() {
+			if len(attrsWanted) > 0 && !hasAnyAttribute(domain, attrsWanted) {
+				continue
+			}
+			l.classifyRule(proto.Clone(domain).(*router.Domain))
+		}
+		return nil
+	}
+	return fmt.Errorf("no such category %s in %s", category, source)
+}
+
+// hasAnyAttribute reports whether the rule has any of the attributes, by
+// their names or with their values
+func hasAnyAttribute(rule *router.Domain, attrs map[Attribute]bool) bool {
+	for _, attr := range rule.GetAttribute() {
+		if attributeMatches(attr, attrs) {
+			return true
+		}
+	}
+	return false
+}
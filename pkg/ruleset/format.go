@@ -0,0 +1,147 @@
+package ruleset
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// inputFormat is the syntax of a data file or a remote list.
+type inputFormat int
+
+const (
+	formatUnknown inputFormat = iota
+	// formatDomainList is the syntax of the data files, eg: `full:www.example.com @cn`
+	formatDomainList
+	// formatHosts is the hosts file syntax, eg: `0.0.0.0 ads.example.com`
+	formatHosts
+	// formatAdblock is the Adblock Plus filter syntax, eg: `||ads.example.com^`
+	formatAdblock
+)
+
+// formatDirective declares the syntax of a file in its header,
+// eg: `# format: hosts` or `! format: adblock`
+var formatDirective = regexp.MustCompile(`^[#!]\s*format:\s*(domain-list|hosts|adblock)\s*$`)
+
+// overlayReplaceDirective makes a list in an overlay data directory replace
+// the same-named list of earlier data directories
+var overlayReplaceDirective = regexp.MustCompile(`^#\s*overlay:\s*replace\s*$`)
+
+// adblockComment matches the metadata comments in the header of Adblock Plus filter lists,
+// eg: `! Title: EasyList`, which are not valid exclusion rules of the data file syntax.
+var adblockComment = regexp.MustCompile(`^!\s*[A-Za-z][A-Za-z ]*:\s`)
+
+// adblockDomainRule matches the Adblock Plus rules blocking or allowing a domain and
+// its subdomains, eg: `||example.com^`, `@@||example.com^`
+var adblockDomainRule = regexp.MustCompile(`^(@@)?\|\|([A-Za-z0-9.*_-]+)\^?$`)
+
+// hostsIgnoredNames are the names in the standard entries of hosts files
+var hostsIgnoredNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// lineConverter converts the lines of a data file or a remote list in
+// hosts or Adblock Plus syntax into the data file syntax.
+// The syntax is declared by a format directive before the first rule,
+// or detected from the first rule.
+type lineConverter struct {
+	format inputFormat
+	// Skipped is the number of rules that cannot be converted
+	Skipped int
+}
+
+// Convert returns the lines in the data file syntax converted from a raw line.
+// Lines in the data file syntax are returned as is.
+func (c *lineConverter) Convert(rawLine string) []string {
+	line := strings.TrimSpace(rawLine)
+	if c.format == formatUnknown {
+		if matches := formatDirective.FindStringSubmatch(strings.ToLower(line)); matches != nil {
+			switch matches[1] {
+			case "hosts":
+				c.format = formatHosts
+			case "adblock":
+				c.format = formatAdblock
+			default:
+				c.format = formatDomainList
+			}
+			return nil
+		}
+		if isEmpty(removeComment(line)) {
+			return []string{rawLine}
+		}
+		c.format = detectFormat(line)
+	}
+
+	switch c.format {
+	case formatHosts:
+		return c.convertHosts(line)
+	case formatAdblock:
+		return c.convertAdblock(line)
+	default:
+		return []string{rawLine}
+	}
+}
+
+// detectFormat detects the syntax of a file from its first rule
+func detectFormat(line string) inputFormat {
+	if strings.HasPrefix(strings.ToLower(line), "[adblock") || strings.HasPrefix(line, "||") ||
+		strings.HasPrefix(line, "@@||") || adblockComment.MatchString(line) {
+		return formatAdblock
+	}
+	if fields := strings.Fields(removeComment(line)); len(fields) >= 2 && net.ParseIP(fields[0]) != nil {
+		return formatHosts
+	}
+	return formatDomainList
+}
+
+// convertHosts converts a hosts entry into full type rules,
+// eg: `0.0.0.0 a.example.com b.example.com` into `full:a.example.com` and `full:b.example.com`
+func (c *lineConverter) convertHosts(line string) []string {
+	fields := strings.Fields(removeComment(line))
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		c.Skipped++
+		return nil
+	}
+
+	var lines []string
+	for _, name := range fields[1:] {
+		if hostsIgnoredNames[strings.ToLower(name)] || net.ParseIP(name) != nil {
+			continue
+		}
+		lines = append(lines, "full:"+name)
+	}
+	return lines
+}
+
+// convertAdblock converts an Adblock Plus rule blocking a domain into a domain type rule,
+// eg: `||example.com^` into `domain:example.com`, and an exception rule into an exclusion,
+// eg: `@@||example.com^` into `exclude:domain:example.com`. Comments, cosmetic rules and
+// rules with paths or options are not domain rules and are skipped.
+func (c *lineConverter) convertAdblock(line string) []string {
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return nil
+	}
+	matches := adblockDomainRule.FindStringSubmatch(line)
+	if matches == nil || strings.Contains(matches[2], "*") {
+		c.Skipped++
+		return nil
+	}
+	if matches[1] == "@@" {
+		return []string{"exclude:domain:" + matches[2]}
+	}
+	return []string{"domain:" + matches[2]}
+}
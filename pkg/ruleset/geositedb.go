@@ -0,0 +1,98 @@
+package ruleset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// The rule types of the geosite.db format of sing-box
+const (
+	geositeDBDomain byte = iota
+	geositeDBDomainSuffix
+	geositeDBDomainKeyword
+	geositeDBDomainRegex
+)
+
+// geositeDBItem is a rule in the geosite.db format
+type geositeDBItem struct {
+	Type  byte
+	Value string
+}
+
+// WriteSingBoxGeoSiteDB writes the entries of a dat file in the geosite.db
+// format of the sing-box versions before rule sets, like the files of
+// SagerNet/sing-geosite. The codes are lowercase, and the rules with
+// attributes are also in the codes of each attribute, eg: `cn@ads`.
+// A domain rule is a domain and a domain suffix item of the domain.
+func WriteSingBoxGeoSiteDB(w io.Writer, geositeList *router.GeoSiteList) error {
+	items := make(map[string][]geositeDBItem)
+	for _, geosite := range geositeList.GetEntry() {
+		code := strings.ToLower(geosite.GetCountryCode())
+		if _, ok := items[code]; !ok {
+			items[code] = make([]geositeDBItem, 0, len(geosite.GetDomain()))
+		}
+		for _, rule := range geosite.GetDomain() {
+			ruleVal := strings.TrimSpace(rule.GetValue())
+			if len(ruleVal) == 0 {
+				continue
+			}
+
+			var ruleItems []geositeDBItem
+			switch rule.Type {
+			case router.Domain_Full:
+				ruleItems = []geositeDBItem{{geositeDBDomain, ruleVal}}
+			case router.Domain_RootDomain:
+				ruleItems = []geositeDBItem{{geositeDBDomain, ruleVal}, {geositeDBDomainSuffix, "." + ruleVal}}
+			case router.Domain_Plain:
+				ruleItems = []geositeDBItem{{geositeDBDomainKeyword, ruleVal}}
+			case router.Domain_Regex:
+				ruleItems = []geositeDBItem{{geositeDBDomainRegex, ruleVal}}
+			}
+			items[code] = append(items[code], ruleItems...)
+			for _, attr := range rule.Attribute {
+				attrCode := code + "@" + strings.ToLower(AttributeString(attr))
+				items[attrCode] = append(items[attrCode], ruleItems...)
+			}
+		}
+	}
+
+	codes := make([]string, 0, len(items))
+	for code := range items {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	// The header has the offset of the items of each code in the content after it
+	var content []byte
+	offsets := make(map[string]int, len(codes))
+	for _, code := range codes {
+		offsets[code] = len(content)
+		for _, item := range items[code] {
+			content = append(content, item.Type)
+			content = appendGeoSiteDBString(content, item.Value)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	// Version
+	bw.WriteByte(0)
+	bw.Write(binary.AppendUvarint(nil, uint64(len(codes))))
+	for _, code := range codes {
+		bw.Write(appendGeoSiteDBString(nil, code))
+		bw.Write(binary.AppendUvarint(nil, uint64(offsets[code])))
+		bw.Write(binary.AppendUvarint(nil, uint64(len(items[code]))))
+	}
+	bw.Write(content)
+	return bw.Flush()
+}
+
+// appendGeoSiteDBString appends a string prefixed by its length in uvarint
+func appendGeoSiteDBString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,131 @@
+package ruleset
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// HomePage is the URL of the project, in the headers of generated files
+const HomePage = "https://github.com/caocaocc/rule-set"
+
+// Options of the header comments of generated text files, set by the command
+// line flags of the program.
+var (
+	// HeaderTemplate is the template of the header comments, executed with a
+	// HeaderData, or nil for the default header.
+	HeaderTemplate *template.Template
+	// NoHeaders leaves out the header comments.
+	NoHeaders bool
+	// BuildInfo is the build metadata in the Build header, if not empty, eg:
+	// `v1.2.0, data ./data@5f6a7b8, source sha256:9c0d...`
+	BuildInfo string
+	// HeaderLocation and HeaderTimeLayout are the time zone and the layout of
+	// the Last Modified time of all formats, or the ones of each format if
+	// nil or empty: the local time, UTC for the IP sets and Asia/Shanghai for
+	// GFWList, in RFC 1123.
+	HeaderLocation   *time.Location
+	HeaderTimeLayout string
+)
+
+// headerTimeLayouts are the names of the common layouts of the -timefmt option
+var headerTimeLayouts = map[string]string{
+	"rfc1123":  time.RFC1123,
+	"rfc1123z": time.RFC1123Z,
+	"rfc3339":  time.RFC3339,
+	"datetime": time.DateTime,
+}
+
+// ParseHeaderTimeLayout returns the time layout of the name of a common one,
+// rfc1123, rfc1123z, rfc3339 or datetime, or the layout itself in the syntax
+// of the time package, eg: `2006-01-02 15:04 MST`.
+func ParseHeaderTimeLayout(layout string) string {
+	if named, ok := headerTimeLayouts[strings.ToLower(layout)]; ok {
+		return named
+	}
+	return layout
+}
+
+// lastModified returns the time of the generation in the location, if not
+// nil, and the layout of a format, unless HeaderLocation and HeaderTimeLayout
+// are set, or empty if TimeNow is nil in reproducible mode.
+func lastModified(loc *time.Location, layout string) string {
+	if TimeNow == nil {
+		return ""
+	}
+	if HeaderLocation != nil {
+		loc = HeaderLocation
+	}
+	if HeaderTimeLayout != "" {
+		layout = HeaderTimeLayout
+	}
+	t := TimeNow()
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(layout)
+}
+
+// HeaderData is the data of the header template of a generated text file.
+type HeaderData struct {
+	// Name is the name of the list in lower case, or the name of the IP set
+	Name string
+	// LastModified is the time of the generation in the layout of the format
+	// or the HeaderTimeLayout, empty in reproducible mode without SOURCE_DATE_EPOCH
+	LastModified  string
+	SchemaVersion int
+	HomePage      string
+	// BuildInfo is the build metadata, empty unless enabled
+	BuildInfo string
+}
+
+// ParseHeaderTemplate parses the template of the header comments, whose lines
+// are prefixed with the comment prefix of each format, eg:
+//
+//	{{.Name}} rules by Jane Doe, CC BY-SA 4.0
+//	Last Modified: {{.LastModified}}
+//	Expires: 24h
+func ParseHeaderTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("header").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Fail early on the references of unknown fields
+	if err := tmpl.Execute(new(strings.Builder), HeaderData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// FileHeader returns the header comments of a generated text file of the list
+// or IP set name, using the comment prefix and the time layout of the format,
+// in the location if not nil, followed by a blank line. It is the HeaderTemplate
+// if set, or the project URL, the Last Modified, the schema version and the
+// build headers.
+func FileHeader(comment, name string, loc *time.Location, layout string) (string, error) {
+	switch {
+	case NoHeaders:
+		return "", nil
+	case HeaderTemplate == nil:
+		header := comment + " Generated by " + HomePage + "\n" + LastModifiedHeader(comment, loc, layout) + SchemaHeader(comment)
+		if BuildInfo != "" {
+			header += comment + " Build: " + BuildInfo + "\n"
+		}
+		return header + "\n", nil
+	}
+
+	data := HeaderData{Name: name, LastModified: lastModified(loc, layout), SchemaVersion: SchemaVersion, HomePage: HomePage, BuildInfo: BuildInfo}
+	var sb strings.Builder
+	if err := HeaderTemplate.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	var header strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(sb.String(), "\n"), "\n") {
+		if line = strings.TrimRight(line, " \t"); line == "" {
+			header.WriteString(comment + "\n")
+		} else {
+			header.WriteString(comment + " " + line + "\n")
+		}
+	}
+	return header.String() + "\n", nil
+}
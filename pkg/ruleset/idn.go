@@ -0,0 +1,53 @@
+package ruleset
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// normalizeDomain converts an internationalized domain name to its punycode
+// form, eg: `中文.cn` to `xn--fiq228c.cn`, and validates the punycode labels.
+func normalizeDomain(domain string) (string, error) {
+	if !isASCII(domain) {
+		asciiDomain, err := idna.Lookup.ToASCII(domain)
+		if err != nil {
+			return "", fmt.Errorf("invalid internationalized domain %q: %w", domain, err)
+		}
+		return asciiDomain, nil
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		if _, err := idna.Lookup.ToUnicode(label); err != nil {
+			return "", fmt.Errorf("invalid punycode label %q: %w", label, err)
+		}
+	}
+	return domain, nil
+}
+
+// unicodeDomain returns the Unicode form of a domain with punycode labels,
+// or empty if the domain has none.
+func unicodeDomain(domain string) string {
+	if !strings.Contains(domain, "xn--") {
+		return ""
+	}
+	unicode, err := idna.Lookup.ToUnicode(domain)
+	if err != nil || unicode == domain {
+		return ""
+	}
+	return unicode
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,387 @@
+package ruleset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IPSet 表示一组IP地址及其相关信息
+type IPSet struct {
+	Name    string
+	URLs    []string
+	IPs     []string
+	BaseDir string
+	Client  *http.Client
+	// Checksums 为可选的来源SHA-256校验值，键为来源URL
+	Checksums map[string]string
+	// MinEntries 为最少条目数，低于该值视为来源异常
+	MinEntries int
+	// Domains 为需要通过DNS解析得到IP的域名，结果为启发式数据
+	Domains  []string
+	Resolver *DNSResolver
+	// Snapshots 保存来源的最近一次有效内容，离线模式下从中读取
+	Snapshots *SnapshotStore
+	// Exclude 为需要从本集合中减去的其他IP集合名称
+	Exclude []string
+	// SingBoxPath 为sing-box可执行文件路径，设置后额外编译生成.srs文件
+	SingBoxPath string
+	// MihomoBehavior 为.yaml文件的Mihomo规则集行为，为空时即ipcidr
+	MihomoBehavior MihomoBehavior
+}
+
+// Formatter 定义了规则格式化接口
+type Formatter interface {
+	Format(ips []string, params ...string) string
+	Extension() string
+	NeedsHeader() bool
+}
+
+// 各种格式的实现
+type (
+	TxtFormatter     struct{}
+	ListFormatter    struct{}
+	YAMLFormatter    struct{}
+	JSONFormatter    struct{}
+	SnippetFormatter struct{}
+)
+
+func (TxtFormatter) Format(ips []string, _ ...string) string {
+	return strings.Join(ips, "\n")
+}
+func (TxtFormatter) Extension() string { return "txt" }
+func (TxtFormatter) NeedsHeader() bool { return true }
+
+func (ListFormatter) Format(ips []string, _ ...string) string {
+	var result []string
+	for _, ip := range ips {
+		prefix := "IP-CIDR"
+		if strings.Contains(ip, ":") {
+			prefix = "IP-CIDR6"
+		}
+		// IP规则不需要为域名请求解析DNS
+		result = append(result, prefix+","+ip+",no-resolve")
+	}
+	return strings.Join(result, "\n")
+}
+func (ListFormatter) Extension() string { return "list" }
+func (ListFormatter) NeedsHeader() bool { return true }
+
+func (YAMLFormatter) Format(ips []string, params ...string) string {
+	classical := len(params) > 0 && MihomoBehavior(params[0]) == MihomoClassical
+	var result []string
+	result = append(result, "payload:")
+	for _, ip := range ips {
+		if classical {
+			prefix := "IP-CIDR"
+			if strings.Contains(ip, ":") {
+				prefix = "IP-CIDR6"
+			}
+			ip = prefix + "," + ip + ",no-resolve"
+		}
+		result = append(result, "  - "+yamlQuote(ip))
+	}
+	return strings.Join(result, "\n")
+}
+func (YAMLFormatter) Extension() string { return "yaml" }
+func (YAMLFormatter) NeedsHeader() bool { return true }
+
+func (JSONFormatter) Format(ips []string, _ ...string) string {
+	data := struct {
+		Version int `json:"version"`
+		Rules   []struct {
+			IPCIDR []string `json:"ip_cidr"`
+		} `json:"rules"`
+	}{
+		Version: SingBoxVersion,
+		Rules: []struct {
+			IPCIDR []string `json:"ip_cidr"`
+		}{{IPCIDR: ips}},
+	}
+	bytes, _ := json.MarshalIndent(data, "", "  ")
+	return string(bytes)
+}
+func (JSONFormatter) Extension() string { return "json" }
+func (JSONFormatter) NeedsHeader() bool { return false }
+
+func (SnippetFormatter) Format(ips []string, params ...string) string {
+	policy := params[0]
+	var result []string
+	for _, ip := range ips {
+		prefix := "ip-cidr"
+		if strings.Contains(ip, ":") {
+			prefix = "ip6-cidr"
+		}
+		result = append(result, fmt.Sprintf("%s, %s, %s", prefix, ip, policy))
+	}
+	return strings.Join(result, "\n")
+}
+func (SnippetFormatter) Extension() string { return "snippet" }
+func (SnippetFormatter) NeedsHeader() bool { return true }
+
+// NewIPSet 创建新的IP集合
+func NewIPSet(name string, urls []string, baseDir string) *IPSet {
+	return &IPSet{
+		Name:    name,
+		URLs:    urls,
+		BaseDir: baseDir,
+	}
+}
+
+// Fetch 获取IP列表
+func (s *IPSet) Fetch() error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var allIPs []string
+	bodies := make(map[string][]byte)
+	for _, url := range s.URLs {
+		var body []byte
+		var err error
+		if s.Snapshots != nil {
+			body, err = s.Snapshots.Fetch(client, url)
+		} else {
+			body, err = FetchURL(client, url)
+		}
+		if err != nil {
+			return err
+		}
+		bodies[url] = body
+
+		if expected := s.Checksums[url]; expected != "" {
+			sum := sha256.Sum256(body)
+			if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, expected, actual)
+			}
+		}
+
+		for _, line := range strings.Split(string(body), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !isIPOrCIDR(line) {
+				return fmt.Errorf("invalid entry in %s: %q", url, line)
+			}
+			allIPs = append(allIPs, line)
+		}
+	}
+
+	if len(s.Domains) > 0 && s.Resolver != nil {
+		resolvedIPs, err := s.Resolver.Resolve(s.Name, s.Domains)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", s.Name, err)
+		}
+		allIPs = append(allIPs, resolvedIPs...)
+	}
+
+	if len(allIPs) < s.MinEntries {
+		return fmt.Errorf("too few entries for %s: expected at least %d, got %d", s.Name, s.MinEntries, len(allIPs))
+	}
+
+	if s.Snapshots != nil {
+		for url, body := range bodies {
+			if err := s.Snapshots.Save(url, body); err != nil {
+				return fmt.Errorf("save snapshot of %s: %w", url, err)
+			}
+		}
+	}
+
+	s.IPs = allIPs
+	return nil
+}
+
+// DownloadError 表示远程来源下载失败，且没有可用的快照
+type DownloadError struct {
+	URL string
+	Err error
+}
+
+func (e *DownloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// FetchURL 下载单个来源的内容，失败时返回 *DownloadError
+func FetchURL(client *http.Client, url string) ([]byte, error) {
+	defer Timing.Start("download")()
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, &DownloadError{URL: url, Err: fmt.Errorf("fetch %s: %w", url, err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &DownloadError{URL: url, Err: fmt.Errorf("fetch %s: unexpected status %s", url, resp.Status)}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &DownloadError{URL: url, Err: fmt.Errorf("read %s: %w", url, err)}
+	}
+	return body, nil
+}
+
+// isIPOrCIDR 判断是否为合法的IP地址或CIDR
+func isIPOrCIDR(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+// IsHeuristic 判断IP集合是否包含DNS解析得到的启发式数据
+func (s *IPSet) IsHeuristic() bool {
+	return len(s.Domains) > 0
+}
+
+// Subtract 从IP集合中减去其他集合所覆盖的地址段
+func (s *IPSet) Subtract(others ...*IPSet) error {
+	var excluded []netip.Prefix
+	for _, other := range others {
+		for _, ip := range other.IPs {
+			prefix, err := parsePrefix(ip)
+			if err != nil {
+				return fmt.Errorf("exclude %s from %s: %w", other.Name, s.Name, err)
+			}
+			excluded = append(excluded, prefix)
+		}
+	}
+
+	result := make([]string, 0, len(s.IPs))
+	for _, ip := range s.IPs {
+		prefix, err := parsePrefix(ip)
+		if err != nil {
+			return fmt.Errorf("exclude from %s: %w", s.Name, err)
+		}
+		remaining := subtractPrefix(prefix, excluded)
+		if len(remaining) == 1 && remaining[0] == prefix {
+			result = append(result, ip)
+			continue
+		}
+		for _, p := range remaining {
+			result = append(result, p.String())
+		}
+	}
+	s.IPs = result
+	return nil
+}
+
+// parsePrefix 将IP地址或CIDR解析为netip.Prefix
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// subtractPrefix 计算地址段减去若干地址段后剩余的地址段
+func subtractPrefix(prefix netip.Prefix, excluded []netip.Prefix) []netip.Prefix {
+	var overlapping []netip.Prefix
+	for _, ex := range excluded {
+		if ex.Addr().Is4() != prefix.Addr().Is4() || !ex.Overlaps(prefix) {
+			continue
+		}
+		if ex.Bits() <= prefix.Bits() { // 被完全覆盖
+			return nil
+		}
+		overlapping = append(overlapping, ex)
+	}
+	if len(overlapping) == 0 {
+		return []netip.Prefix{prefix}
+	}
+
+	// 拆分为两个子地址段后递归处理
+	lower, upper := splitPrefix(prefix)
+	return append(subtractPrefix(lower, overlapping), subtractPrefix(upper, overlapping)...)
+}
+
+// splitPrefix 将地址段平分为两个子地址段
+func splitPrefix(prefix netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := prefix.Bits() + 1
+	addr := prefix.Addr()
+	lower := netip.PrefixFrom(addr, bits)
+
+	b := addr.AsSlice()
+	b[(bits-1)/8] |= 0x80 >> ((bits - 1) % 8)
+	upperAddr, _ := netip.AddrFromSlice(b)
+	upper := netip.PrefixFrom(upperAddr, bits)
+	return lower, upper
+}
+
+// Generate 生成所有格式的规则文件
+func (s *IPSet) Generate(policy string) error {
+	formatters := []Formatter{
+		TxtFormatter{},
+		ListFormatter{},
+		YAMLFormatter{},
+		JSONFormatter{},
+		SnippetFormatter{},
+	}
+
+	header, err := FileHeader("#", s.Name, time.UTC, "Mon, 02 Jan 2006 15:04:05 MST")
+	if err != nil {
+		return err
+	}
+	if s.IsHeuristic() && !NoHeaders {
+		if s.Resolver != nil && s.Resolver.Widen {
+			header += fmt.Sprintf("# Heuristic: resolved from DNS answers and widened to /%d and /%d networks, may be incomplete, stale or too broad\n\n", WidenedIPv4Bits, WidenedIPv6Bits)
+		} else {
+			header += "# Heuristic: resolved from DNS answers, may be incomplete or stale\n\n"
+		}
+	}
+
+	for _, formatter := range formatters {
+		var content string
+		switch formatter.Extension() {
+		case "snippet":
+			content = formatter.Format(s.IPs, policy)
+		case "yaml":
+			content = formatter.Format(s.IPs, string(s.MihomoBehavior))
+		default:
+			content = formatter.Format(s.IPs)
+		}
+
+		if formatter.NeedsHeader() {
+			content = header + content
+		}
+
+		filename := filepath.Join(s.BaseDir, fmt.Sprintf("%s-ip.%s", s.Name, formatter.Extension()))
+		if err := WriteFile(filename, []byte(content)); err != nil {
+			return fmt.Errorf("write %s: %w", filename, err)
+		}
+
+		Logf(slog.LevelInfo, "%s-ip.%s has been generated successfully in '%s'.", s.Name, formatter.Extension(), s.BaseDir)
+
+		if formatter.Extension() == "json" && s.SingBoxPath != "" {
+			if _, err := CompileSingBoxRuleSet(s.SingBoxPath, filename); err != nil {
+				return err
+			}
+			Logf(slog.LevelInfo, "%s-ip.srs has been generated successfully in '%s'.", s.Name, s.BaseDir)
+		}
+	}
+
+	return nil
+}
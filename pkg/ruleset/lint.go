@@ -0,0 +1,182 @@
+package ruleset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// LintIssue is an issue found in a list of the data directory.
+type LintIssue struct {
+	List    FileName
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.List, i.Message)
+}
+
+// Lint reports duplicate rules within and across lists, attributes used
+// only once, empty lists, lists never included nor referenced, rules
+// shadowed by broader domain type rules of the same list, and domains
+// failing the checks of the -domaincheck option.
+// The lists must not have been flattened.
+func (lm *ListInfoMap) Lint(referenced []string) []LintIssue {
+	var issues []LintIssue
+
+	isReferenced := make(map[FileName]bool)
+	for _, name := range referenced {
+		isReferenced[FileName(strings.ToUpper(name))] = true
+	}
+	for _, listinfo := range *lm {
+		for _, included := range listinfo.includedNames() {
+			isReferenced[included] = true
+		}
+	}
+
+	ruleLists := make(map[string][]FileName)
+	attrRules := make(map[string][]LintIssue)
+	for name, listinfo := range *lm {
+		rules := listinfo.rules()
+		if len(rules) == 0 && !listinfo.HasInclusion {
+			issues = append(issues, LintIssue{name, "empty list"})
+		}
+		if !isReferenced[name] {
+			issues = append(issues, LintIssue{name, "list is never included by other lists nor exported"})
+		}
+
+		seen := make(map[string]bool)
+		for _, rule := range rules {
+			key := ruleTypeValue(rule)
+			if seen[key] {
+				issues = append(issues, LintIssue{name, "duplicate rule " + key})
+				continue
+			}
+			seen[key] = true
+			ruleLists[key] = append(ruleLists[key], name)
+
+			for _, issue := range domainIssues(rule) {
+				issues = append(issues, LintIssue{name, fmt.Sprintf("rule %s: %s", RuleString(rule), issue)})
+			}
+
+			for _, attr := range rule.Attribute {
+				attrRules[AttributeString(attr)] = append(attrRules[AttributeString(attr)], LintIssue{name, fmt.Sprintf("attribute @%s is used only once, in rule %s", AttributeString(attr), RuleString(rule))})
+			}
+		}
+
+		issues = append(issues, listinfo.lintShadowedRules()...)
+	}
+
+	for key, names := range ruleLists {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+		otherNames := make([]string, 0, len(names)-1)
+		for _, name := range names[1:] {
+			otherNames = append(otherNames, string(name))
+		}
+		issues = append(issues, LintIssue{names[0], fmt.Sprintf("rule %s is duplicated in %s", key, strings.Join(otherNames, ", "))})
+	}
+
+	for _, attrIssues := range attrRules {
+		if len(attrIssues) == 1 {
+			issues = append(issues, attrIssues[0])
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].List != issues[j].List {
+			return issues[i].List < issues[j].List
+		}
+		return issues[i].Message < issues[j].Message
+	})
+	return issues
+}
+
+// lintShadowedRules reports the domain and full type rules that are covered
+// by a domain type rule of a parent domain with the same attributes.
+func (l *ListInfo) lintShadowedRules() []LintIssue {
+	domains := make(map[string]bool)
+	for _, rule := range l.rules() {
+		if rule.Type == router.Domain_RootDomain {
+			domains[ruleAttributes(rule)+" "+rule.Value] = true
+		}
+	}
+
+	var issues []LintIssue
+	for _, rule := range l.rules() {
+		if rule.Type != router.Domain_RootDomain && rule.Type != router.Domain_Full {
+			continue
+		}
+		parent := rule.Value
+		if rule.Type == router.Domain_RootDomain {
+			parent = nextParentDomain(parent)
+		}
+		for ; parent != ""; parent = nextParentDomain(parent) {
+			if domains[ruleAttributes(rule)+" "+parent] {
+				issues = append(issues, LintIssue{l.Name, fmt.Sprintf("rule %s is shadowed by domain:%s", RuleString(rule), parent)})
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// rules returns all rules of a list that has not been flattened yet
+func (l *ListInfo) rules() []*router.Domain {
+	rules := make([]*router.Domain, 0, len(l.FullTypeList)+len(l.DomainTypeList)+len(l.KeywordTypeList)+len(l.RegexpTypeList)+len(l.AttributeRuleUniqueList))
+	rules = append(rules, l.FullTypeList...)
+	rules = append(rules, l.DomainTypeList...)
+	rules = append(rules, l.KeywordTypeList...)
+	rules = append(rules, l.RegexpTypeList...)
+	rules = append(rules, l.AttributeRuleUniqueList...)
+	return rules
+}
+
+// nextParentDomain returns the parent domain, or empty if it is a top-level domain
+func nextParentDomain(domain string) string {
+	if idx := strings.Index(domain, "."); idx != -1 {
+		return domain[idx+1:]
+	}
+	return ""
+}
+
+// ruleTypeValue returns the rule in `type:value` format, without attributes,
+// with the regexps of wildcard rules as the wildcards
+func ruleTypeValue(rule *router.Domain) string {
+	switch rule.Type {
+	case router.Domain_Full:
+		return "full:" + rule.Value
+	case router.Domain_Plain:
+		return "keyword:" + rule.Value
+	case router.Domain_Regex:
+		if pattern, ok := regexpToWildcard(rule.Value); ok {
+			return "wildcard:" + pattern
+		}
+		return "regexp:" + rule.Value
+	default:
+		return "domain:" + rule.Value
+	}
+}
+
+// ruleAttributes returns the sorted attributes of the rule, eg: "@ads@cn"
+func ruleAttributes(rule *router.Domain) string {
+	attrs := make([]string, 0, len(rule.Attribute))
+	for _, attr := range rule.Attribute {
+		attrs = append(attrs, "@"+AttributeString(attr))
+	}
+	sort.Strings(attrs)
+	return strings.Join(attrs, "")
+}
+
+// RuleString returns the rule in the format of data files, eg: "domain:example.com @cn"
+func RuleString(rule *router.Domain) string {
+	ruleString := ruleTypeValue(rule)
+	for _, attr := range rule.Attribute {
+		ruleString += " @" + AttributeString(attr)
+	}
+	return ruleString
+}
@@ -0,0 +1,1396 @@
+package ruleset
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ListInfo is the information structure of a single file in data directory.
+// It includes all types of rules of the file, as well as servel types of
+// sturctures of same items for convenience in later process.
+type ListInfo struct {
+	Name                    FileName
+	HasInclusion            bool
+	InclusionAttributeMap   map[FileName][]Attribute
+	ExclusionRuleList       []*router.Domain
+	FullTypeList            []*router.Domain
+	KeywordTypeList         []*router.Domain
+	RegexpTypeList          []*router.Domain
+	AttributeRuleUniqueList []*router.Domain
+	DomainTypeList          []*router.Domain
+	DomainTypeUniqueList    []*router.Domain
+	AttributeRuleListMap    map[Attribute][]*router.Domain
+	GeoSite                 *router.GeoSite
+	Policy                  ListPolicy
+	// OverlayReplace is set by the `# overlay: replace` directive, so that the list
+	// in an overlay data directory replaces the same-named list instead of being merged.
+	OverlayReplace bool
+	// Parent is the name of the list a sub-list is derived from, eg: `CN` of `CN@ADS`
+	Parent FileName
+	// Chunk is the number of the chunk a list is split into by SplitChunks, or 0
+	Chunk int
+	// MihomoBehavior is the behavior of the Mihomo rule providers of the list,
+	// or the domain behavior if empty
+	MihomoBehavior MihomoBehavior
+	// sourceOrder is the rules in the order they are read, for SortSourceOrder
+	sourceOrder []*router.Domain
+	// origins are the origins of the rules with TrackOrigins, and origin is
+	// the origin of the rules of the line being processed
+	origins map[*router.Domain]RuleOrigin
+	origin  RuleOrigin
+}
+
+// ParseError is an error of parsing a line in a data file or a remote list.
+type ParseError struct {
+	File string
+	Line int
+	Raw  string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v: %q", e.File, e.Line, e.Err, strings.TrimSpace(e.Raw))
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// NewListInfo return a ListInfo
+func NewListInfo() *ListInfo {
+	return &ListInfo{
+		InclusionAttributeMap:   make(map[FileName][]Attribute),
+		FullTypeList:            make([]*router.Domain, 0, 10),
+		KeywordTypeList:         make([]*router.Domain, 0, 10),
+		RegexpTypeList:          make([]*router.Domain, 0, 10),
+		AttributeRuleUniqueList: make([]*router.Domain, 0, 10),
+		DomainTypeList:          make([]*router.Domain, 0, 10),
+		DomainTypeUniqueList:    make([]*router.Domain, 0, 10),
+		AttributeRuleListMap:    make(map[Attribute][]*router.Domain),
+	}
+}
+
+// maxLineSize is the maximum length of a line of a data file or a generated
+// file parsed back, well above the default limit of bufio.Scanner, for the
+// long regexp rules.
+const maxLineSize = 16 * 1024 * 1024
+
+// byteOrderMark is the UTF-8 byte order mark some editors on Windows put at
+// the start of files.
+const byteOrderMark = "\ufeff"
+
+// normalizeLine removes the byte order mark from the first line of a file,
+// and the carriage return of the CRLF line ending of a line.
+func normalizeLine(lineNumber int, rawLine string) string {
+	if lineNumber == 1 {
+		rawLine = strings.TrimPrefix(rawLine, byteOrderMark)
+	}
+	return strings.TrimSuffix(rawLine, "\r")
+}
+
+// ProcessList processes each line of every single file in the data directory
+// and generates a ListInfo of each file.
+func (l *ListInfo) ProcessList(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	converter := new(lineConverter)
+	lineNumber := 0
+	// The errors of all lines with KeepGoing
+	var errs []error
+	// Parse a file line by line to generate ListInfo
+	for scanner.Scan() {
+		lineNumber++
+		rawLine := normalizeLine(lineNumber, scanner.Text())
+		if overlayReplaceDirective.MatchString(strings.TrimSpace(rawLine)) {
+			l.OverlayReplace = true
+			continue
+		}
+		for _, line := range converter.Convert(rawLine) {
+			if err := l.processLine(file.Name(), lineNumber, rawLine, line); err != nil {
+				if !KeepGoing {
+					return err
+				}
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", file.Name(), err)
+	}
+	if converter.Skipped > 0 {
+		Logf(LevelNotice, "%s: %d rules that are not domain rules are skipped.", file.Name(), converter.Skipped)
+	}
+
+	return errors.Join(errs...)
+}
+
+// processLine processes a line of a data file, in the data file syntax
+// converted from the raw line.
+func (l *ListInfo) processLine(source string, lineNumber int, rawLine, line string) error {
+	if isEmpty(line) {
+		return nil
+	}
+	l.origin = RuleOrigin{File: source, Line: lineNumber}
+	line = removeComment(line)
+	if isEmpty(line) {
+		return nil
+	}
+	// Parse `include-url` rule, eg: `include-url:https://example.com/list.txt @cn`
+	if strings.HasPrefix(strings.TrimSpace(line), "include-url:") {
+		if err := l.parseURLInclusion(line); err != nil {
+			return &ParseError{File: source, Line: lineNumber, Raw: rawLine, Err: err}
+		}
+		return nil
+	}
+	// Parse `ext` rule, eg: `ext:geosite.dat:category-ads-all`
+	if strings.HasPrefix(strings.TrimSpace(line), "ext:") {
+		if err := l.parseExtInclusion(line); err != nil {
+			return &ParseError{File: source, Line: lineNumber, Raw: rawLine, Err: err}
+		}
+		return nil
+	}
+	// Parse `tld` rule, eg: `tld:cn,xn--fiqs8s @cn`
+	if strings.HasPrefix(strings.TrimSpace(line), "tld:") {
+		if err := l.parseTLDExpansion(line); err != nil {
+			return &ParseError{File: source, Line: lineNumber, Raw: rawLine, Err: err}
+		}
+		return nil
+	}
+	parsedRule, err := l.parseRule(line)
+	if err != nil {
+		parseErr := &ParseError{File: source, Line: lineNumber, Raw: rawLine, Err: err}
+		if Lenient && (errors.Is(err, ErrInvalidRegexp) || errors.Is(err, ErrInvalidWildcard)) {
+			Logf(slog.LevelWarn, "%v skipped", parseErr)
+			return nil
+		}
+		return parseErr
+	}
+	if parsedRule == nil {
+		return nil
+	}
+	if parsedRule.Type == router.Domain_Regex {
+		for _, warning := range regexpCompatibilityWarnings(parsedRule.Value) {
+			Logf(slog.LevelWarn, "%s:%d: %s: %q", source, lineNumber, warning, strings.TrimSpace(rawLine))
+		}
+	}
+	if err := checkDomainRule(source, lineNumber, rawLine, parsedRule); err != nil {
+		return err
+	}
+	l.classifyRule(parsedRule)
+	return nil
+}
+
+// parseRule parses a single rule
+func (l *ListInfo) parseRule(line string) (*router.Domain, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return nil, errors.New("empty line")
+	}
+
+	// Parse `include` rule first, eg: `include:google`, `include:google @cn @gfw`
+	if strings.HasPrefix(line, "include:") {
+		l.parseInclusion(line)
+		return nil, nil
+	}
+
+	// Parse `exclude` rule, eg: `exclude:domain:tracker.example.com`, `!full:bad.example.com`
+	if strings.HasPrefix(line, "exclude:") || strings.HasPrefix(line, "!") {
+		return nil, l.parseExclusion(line)
+	}
+
+	parts := strings.Split(line, " ")
+	ruleWithType := strings.TrimSpace(parts[0])
+	if ruleWithType == "" {
+		return nil, errors.New("empty rule")
+	}
+
+	var rule router.Domain
+	if err := l.parseTypeRule(ruleWithType, &rule); err != nil {
+		return nil, err
+	}
+
+	for _, attrString := range parts[1:] {
+		if attrString = strings.TrimSpace(attrString); attrString != "" {
+			attr, err := l.parseAttribute(attrString)
+			if err != nil {
+				return nil, err
+			}
+			rule.Attribute = append(rule.Attribute, attr)
+		}
+	}
+
+	return &rule, nil
+}
+
+// parseURLInclusion downloads a remote plaintext domain list and adds
+// its rules, with the attributes of the `include-url` rule attached.
+func (l *ListInfo) parseURLInclusion(inclusion string) error {
+	parts := strings.Fields(strings.TrimPrefix(strings.TrimSpace(inclusion), "include-url:"))
+	if len(parts) == 0 {
+		return errors.New("empty include-url rule")
+	}
+	url := parts[0]
+
+	var attrs []*router.Domain_Attribute
+	for _, attrString := range parts[1:] {
+		attr, err := l.parseAttribute(attrString)
+		if err != nil {
+			return err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	body, err := remoteLists.Get(url)
+	if err != nil {
+		return err
+	}
+
+	converter := new(lineConverter)
+	for idx, rawLine := range strings.Split(string(body), "\n") {
+		rawLine = normalizeLine(idx+1, rawLine)
+		for _, line := range converter.Convert(rawLine) {
+			if err := l.processRemoteLine(url, idx+1, rawLine, line, attrs); err != nil {
+				return err
+			}
+		}
+	}
+	if converter.Skipped > 0 {
+		Logf(LevelNotice, "%s: %d rules that are not domain rules are skipped.", url, converter.Skipped)
+	}
+
+	return nil
+}
+
+// processRemoteLine processes a line of a remote list, in the data file syntax
+// converted from the raw line, and attaches the attributes of the `include-url` rule.
+func (l *ListInfo) processRemoteLine(url string, lineNumber int, rawLine, line string, attrs []*router.Domain_Attribute) error {
+	if isEmpty(line) {
+		return nil
+	}
+	l.origin = RuleOrigin{File: url, Line: lineNumber}
+	line = removeComment(line)
+	if isEmpty(line) {
+		return nil
+	}
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "include:") || strings.HasPrefix(trimmed, "include-url:") || strings.HasPrefix(trimmed, "ext:") || strings.HasPrefix(trimmed, "tld:") {
+		return &ParseError{File: url, Line: lineNumber, Raw: rawLine, Err: errors.New("inclusion is not allowed in remote list")}
+	}
+	rule, err := l.parseRule(line)
+	if err != nil {
+		return &ParseError{File: url, Line: lineNumber, Raw: rawLine, Err: err}
+	}
+	if rule == nil {
+		return nil
+	}
+	if err := checkDomainRule(url, lineNumber, rawLine, rule); err != nil {
+		return err
+	}
+	rule.Attribute = append(rule.Attribute, attrs...)
+	l.classifyRule(rule)
+	return nil
+}
+
+func (l *ListInfo) parseExclusion(exclusion string) error {
+	exclusionVal := strings.TrimSpace(exclusion)
+	if strings.HasPrefix(exclusionVal, "exclude:") {
+		exclusionVal = strings.TrimPrefix(exclusionVal, "exclude:")
+	} else {
+		exclusionVal = strings.TrimPrefix(exclusionVal, "!")
+	}
+	exclusionVal = strings.TrimSpace(exclusionVal)
+	if exclusionVal == "" {
+		return errors.New("empty exclude rule")
+	}
+	if strings.ContainsAny(exclusionVal, " \t") {
+		return errors.New("attributes are not supported in exclude rule: " + exclusion)
+	}
+
+	var rule router.Domain
+	if err := l.parseTypeRule(exclusionVal, &rule); err != nil {
+		return err
+	}
+	l.ExclusionRuleList = append(l.ExclusionRuleList, &rule)
+	return nil
+}
+
+func (l *ListInfo) parseInclusion(inclusion string) {
+	inclusionVal := strings.TrimPrefix(strings.TrimSpace(inclusion), "include:")
+	l.HasInclusion = true
+	inclusionValSlice := strings.Split(inclusionVal, "@")
+	filename := FileName(strings.ToUpper(strings.TrimSpace(inclusionValSlice[0])))
+	switch len(inclusionValSlice) {
+	case 1: // Inclusion without attribute
+		// Use '@' as the placeholder attribute for 'include:filename'
+		l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], Attribute("@"))
+	default: // Inclusion with attribute(s)
+		// support new inclusion syntax, eg: `include:google @cn @gfw`
+		for _, attr := range inclusionValSlice[1:] {
+			attr = strings.ToLower(strings.TrimSpace(attr))
+			if attr != "" {
+				// Added in this format: '@cn'
+				l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], Attribute("@"+attr))
+			}
+		}
+	}
+}
+
+func (l *ListInfo) parseTypeRule(domain string, rule *router.Domain) error {
+	ruleType, ruleVal := "", strings.TrimSpace(domain)
+	// Only known types are taken as the type prefix, so that the scheme and port
+	// of a line without type prefix, eg: `https://example.com:443/`, are not.
+	if kv := strings.SplitN(ruleVal, ":", 2); len(kv) == 2 && isRuleType(kv[0]) {
+		ruleType, ruleVal = strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+	}
+	rule.Value = strings.ToLower(ruleVal)
+
+	switch ruleType {
+	case "", "domain": // line without type prefix is a domain type rule
+		rule.Type = router.Domain_RootDomain
+		if err := normalizeRuleDomain(rule); err != nil {
+			return err
+		}
+	case "full":
+		rule.Type = router.Domain_Full
+		if err := normalizeRuleDomain(rule); err != nil {
+			return err
+		}
+	case "keyword":
+		rule.Type = router.Domain_Plain
+	case "regexp":
+		rule.Type = router.Domain_Regex
+		rule.Value = ruleVal
+		if err := validateRegexp(ruleVal); err != nil {
+			return err
+		}
+	case "wildcard":
+		rule.Type = router.Domain_Regex
+		if err := validateWildcard(rule.Value); err != nil {
+			return err
+		}
+		rule.Value = wildcardToRegexp(rule.Value)
+	}
+	return nil
+}
+
+// isRuleType reports whether s is a type prefix of rules
+func isRuleType(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "full", "domain", "keyword", "regexp", "wildcard":
+		return true
+	}
+	return false
+}
+
+// normalizeRuleDomain cleans up the value of a full or domain type rule,
+// and converts it to punycode.
+func normalizeRuleDomain(rule *router.Domain) error {
+	domain, err := cleanDomain(rule.Value, rule.Type == router.Domain_RootDomain)
+	if err != nil {
+		return err
+	}
+	if domain, err = normalizeDomain(domain); err != nil {
+		return err
+	}
+	rule.Value = domain
+	return nil
+}
+
+func (l *ListInfo) parseAttribute(attr string) (*router.Domain_Attribute, error) {
+	if attr[0] != '@' {
+		return nil, errors.New("invalid attribute: " + attr)
+	}
+	attr = attr[1:] // Trim out attribute prefix `@` character
+
+	var attribute router.Domain_Attribute
+	attribute.Key = strings.ToLower(attr)
+	attribute.TypedValue = &router.Domain_Attribute_BoolValue{BoolValue: true}
+
+	// Typed attributes like `@rank=5` have an int value, and the ones like
+	// `@policy=media` keep the string value in the key, as the dat file has
+	// no string values
+	if name, value, ok := strings.Cut(attribute.Key, "="); ok {
+		if name == "" || value == "" || strings.Contains(value, "=") {
+			return nil, errors.New("invalid attribute: @" + attr)
+		}
+		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+			attribute.Key = name
+			attribute.TypedValue = &router.Domain_Attribute_IntValue{IntValue: intValue}
+		}
+	}
+	return &attribute, nil
+}
+
+// AttributeString returns the attribute in the data syntax without `@`,
+// eg: "ads", or "rank=5" and "policy=media" for typed attributes.
+func AttributeString(attr *router.Domain_Attribute) string {
+	if value, ok := attr.GetTypedValue().(*router.Domain_Attribute_IntValue); ok {
+		return attr.GetKey() + "=" + strconv.FormatInt(value.IntValue, 10)
+	}
+	return attr.GetKey()
+}
+
+// attributeNameValue returns the name of the attribute, and its value if typed,
+// eg: "policy" and "media" of `@policy=media`
+func attributeNameValue(attr *router.Domain_Attribute) (name, value string) {
+	name, value, _ = strings.Cut(AttributeString(attr), "=")
+	return name, value
+}
+
+// attributeMatches reports whether the attribute is in attrs, by its name or
+// with its value, so that `@policy` matches all values of the attribute
+func attributeMatches(attr *router.Domain_Attribute, attrs map[Attribute]bool) bool {
+	name, _ := attributeNameValue(attr)
+	return attrs[Attribute(AttributeString(attr))] || attrs[Attribute(name)]
+}
+
+// classifyRule classifies a single rule and write into *ListInfo
+func (l *ListInfo) classifyRule(rule *router.Domain) {
+	if SimplifyRegexps && rule.Type == router.Domain_Regex {
+		if simplified := simplifyRegexp(rule.GetValue()); simplified != nil {
+			rule.Type, rule.Value = simplified.Type, simplified.Value
+		}
+	}
+	l.sourceOrder = append(l.sourceOrder, rule)
+	l.recordOrigin(rule)
+	if len(rule.Attribute) > 0 {
+		l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, rule)
+		var attrsString Attribute
+		for _, attr := range rule.Attribute {
+			attrsString += Attribute("@" + AttributeString(attr)) // attrsString will be "@cn@ads" if there are more than one attributes
+		}
+		l.AttributeRuleListMap[attrsString] = append(l.AttributeRuleListMap[attrsString], rule)
+	} else {
+		switch rule.Type {
+		case router.Domain_Full:
+			l.FullTypeList = append(l.FullTypeList, rule)
+		case router.Domain_RootDomain:
+			l.DomainTypeList = append(l.DomainTypeList, rule)
+		case router.Domain_Plain:
+			l.KeywordTypeList = append(l.KeywordTypeList, rule)
+		case router.Domain_Regex:
+			l.RegexpTypeList = append(l.RegexpTypeList, rule)
+		}
+	}
+}
+
+// Merge merges the rules of another list that has not been flattened yet.
+func (l *ListInfo) Merge(other *ListInfo) {
+	l.HasInclusion = l.HasInclusion || other.HasInclusion
+	for filename, attrs := range other.InclusionAttributeMap {
+		l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], attrs...)
+	}
+	l.ExclusionRuleList = append(l.ExclusionRuleList, other.ExclusionRuleList...)
+	l.FullTypeList = append(l.FullTypeList, other.FullTypeList...)
+	l.KeywordTypeList = append(l.KeywordTypeList, other.KeywordTypeList...)
+	l.RegexpTypeList = append(l.RegexpTypeList, other.RegexpTypeList...)
+	l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, other.AttributeRuleUniqueList...)
+	l.DomainTypeList = append(l.DomainTypeList, other.DomainTypeList...)
+	l.sourceOrder = append(l.sourceOrder, other.sourceOrder...)
+	l.includeOrigins(other, other.sourceOrder, "")
+	for attr, domainList := range other.AttributeRuleListMap {
+		l.AttributeRuleListMap[attr] = append(l.AttributeRuleListMap[attr], domainList...)
+	}
+}
+
+// includedNames returns the sorted names of the lists included by the list
+func (l *ListInfo) includedNames() []FileName {
+	names := make([]FileName, 0, len(l.InclusionAttributeMap))
+	for name := range l.InclusionAttributeMap {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// attributeKeys returns the sorted keys of AttributeRuleListMap
+func (l *ListInfo) attributeKeys() []Attribute {
+	keys := make([]Attribute, 0, len(l.AttributeRuleListMap))
+	for attr := range l.AttributeRuleListMap {
+		keys = append(keys, attr)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Flatten flattens the rules in a file that have "include" syntax
+// in data directory, and adds those need-to-included rules into it.
+// This feature supports the "include:filename@attribute" syntax.
+// It also generates a domain trie of domain-typed rules for each file
+// to remove duplications of them.
+func (l *ListInfo) Flatten(lm *ListInfoMap) error {
+	if l.HasInclusion {
+		for _, filename := range l.includedNames() {
+			for _, attrWanted := range l.InclusionAttributeMap[filename] {
+				includedList := (*lm)[filename]
+				switch string(attrWanted) {
+				case "@":
+					l.FullTypeList = append(l.FullTypeList, includedList.FullTypeList...)
+					l.DomainTypeList = append(l.DomainTypeList, includedList.DomainTypeList...)
+					l.KeywordTypeList = append(l.KeywordTypeList, includedList.KeywordTypeList...)
+					l.RegexpTypeList = append(l.RegexpTypeList, includedList.RegexpTypeList...)
+					l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, includedList.AttributeRuleUniqueList...)
+					l.sourceOrder = append(l.sourceOrder, includedList.sourceOrder...)
+					l.includeOrigins(includedList, includedList.sourceOrder, includeRule(filename, attrWanted))
+					for attr, domainList := range includedList.AttributeRuleListMap {
+						l.AttributeRuleListMap[attr] = append(l.AttributeRuleListMap[attr], domainList...)
+					}
+
+				default:
+					for _, attr := range includedList.attributeKeys() {
+						domainList := includedList.AttributeRuleListMap[attr]
+						// If there are more than one attribute attached to the rule,
+						// the attribute key of AttributeRuleListMap in ListInfo
+						// will be like: "@cn@ads".
+						// So if to extract rules with a specific attribute, it is necessary
+						// also to test the multi-attribute keys of AttributeRuleListMap.
+						// Notice: if "include:google @cn" and "include:google @ads" appear
+						// at the same time in the parent list. There are chances that the same
+						// rule with that two attributes(`@cn` and `@ads`) will be included twice in the parent list.
+						if strings.Contains(string(attr)+"@", string(attrWanted)+"@") {
+							l.AttributeRuleListMap[attr] = append(l.AttributeRuleListMap[attr], domainList...)
+							l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, domainList...)
+							l.sourceOrder = append(l.sourceOrder, domainList...)
+							l.includeOrigins(includedList, domainList, includeRule(filename, attrWanted))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(l.ExclusionRuleList) > 0 {
+		l.applyExclusion()
+	}
+
+	domains := make([]string, 0, len(l.DomainTypeList))
+	for _, domain := range l.DomainTypeList {
+		if domain.GetValue() == "" {
+			return errors.New("empty domain")
+		}
+		domains = append(domains, domain.GetValue())
+	}
+	// The rules kept are the first ones of the domains left in the trie,
+	// not subdomains of other rules.
+	trie := NewDomainTrieOf(domains)
+	for _, domain := range l.DomainTypeList {
+		if trie.take(domain.GetValue()) {
+			l.DomainTypeUniqueList = append(l.DomainTypeUniqueList, domain)
+		}
+	}
+
+	l.dropCoveredRules(trie)
+	l.warnDuplicateRegexps()
+
+	return nil
+}
+
+// dropCoveredRules removes the full type rules covered by a domain type rule
+// of the same or a parent domain, and the domain type rules covered by one of
+// a parent domain, both with the same attributes. The trie is the one of the
+// domain type rules of the list. Keyword type rules are not exported, so the
+// rules they cover are kept.
+func (l *ListInfo) dropCoveredRules(trie *DomainTrie) {
+	// The domains of the domain type rules with attributes by their attributes
+	attrDomains := make(map[string][]string)
+	for _, rule := range l.AttributeRuleUniqueList {
+		if rule.Type == router.Domain_RootDomain {
+			attrs := ruleAttributes(rule)
+			attrDomains[attrs] = append(attrDomains[attrs], rule.GetValue())
+		}
+	}
+	tries := map[string]*DomainTrie{"": trie}
+	for attrs, domains := range attrDomains {
+		tries[attrs] = NewDomainTrieOf(domains)
+	}
+
+	isCovered := func(rule *router.Domain) bool {
+		if rule.Type != router.Domain_Full && rule.Type != router.Domain_RootDomain {
+			return false
+		}
+		domain := rule.GetValue()
+		if rule.Type == router.Domain_RootDomain {
+			domain = nextParentDomain(domain)
+		}
+		trie := tries[ruleAttributes(rule)]
+		return trie != nil && domain != "" && trie.Covers(domain)
+	}
+	dropCovered := func(rules []*router.Domain) []*router.Domain {
+		kept := make([]*router.Domain, 0, len(rules))
+		for _, rule := range rules {
+			if !isCovered(rule) {
+				kept = append(kept, rule)
+			}
+		}
+		return kept
+	}
+
+	l.FullTypeList = dropCovered(l.FullTypeList)
+	l.AttributeRuleUniqueList = dropCovered(l.AttributeRuleUniqueList)
+	for attr, domainList := range l.AttributeRuleListMap {
+		l.AttributeRuleListMap[attr] = dropCovered(domainList)
+	}
+}
+
+// warnDuplicateRegexps warns about the regexp type rules matching the
+// same domains as a full or domain type rule of the list.
+func (l *ListInfo) warnDuplicateRegexps() {
+	if len(l.RegexpTypeList) == 0 {
+		return
+	}
+	matcher := newRuleMatcher(append(append([]*router.Domain{}, l.FullTypeList...), l.DomainTypeUniqueList...))
+	for _, rule := range l.RegexpTypeList {
+		equivalent := regexpEquivalentRule(rule.GetValue())
+		if equivalent == nil {
+			continue
+		}
+		if other := matcher.Match(equivalent); other != nil {
+			Logf(slog.LevelWarn, "%s: regexp rule %s duplicates %s", strings.ToLower(string(l.Name)), RuleString(rule), RuleString(other))
+		}
+	}
+}
+
+// applyExclusion removes the rules matching the `exclude` rules of the list.
+// An excluded domain type rule also removes the domain and full type rules
+// of its subdomains, while other types only remove rules of the same value.
+func (l *ListInfo) applyExclusion() {
+	l.FullTypeList = l.filterExcluded(l.FullTypeList)
+	l.DomainTypeList = l.filterExcluded(l.DomainTypeList)
+	l.KeywordTypeList = l.filterExcluded(l.KeywordTypeList)
+	l.RegexpTypeList = l.filterExcluded(l.RegexpTypeList)
+	l.AttributeRuleUniqueList = l.filterExcluded(l.AttributeRuleUniqueList)
+	for attr, domainList := range l.AttributeRuleListMap {
+		l.AttributeRuleListMap[attr] = l.filterExcluded(domainList)
+	}
+}
+
+// filterExcluded returns a new slice without the rules matching `exclude` rules
+func (l *ListInfo) filterExcluded(rules []*router.Domain) []*router.Domain {
+	kept := make([]*router.Domain, 0, len(rules))
+	for _, rule := range rules {
+		if !l.isExcluded(rule) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
+
+func (l *ListInfo) isExcluded(rule *router.Domain) bool {
+	for _, exclusion := range l.ExclusionRuleList {
+		if exclusion.Type == router.Domain_RootDomain {
+			switch rule.Type {
+			case router.Domain_RootDomain, router.Domain_Full:
+				if rule.Value == exclusion.Value || strings.HasSuffix(rule.Value, "."+exclusion.Value) {
+					return true
+				}
+			}
+			continue
+		}
+		if rule.Type == exclusion.Type && rule.Value == exclusion.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// ToGeoSite converts every ListInfo into a router.GeoSite structure.
+// It also excludes rules with certain attributes in certain files that
+// user specified in command line when runing the program, or keeps only
+// rules with certain attributes if the file is in includeAttrs.
+func (l *ListInfo) ToGeoSite(excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) {
+	geosite := new(router.GeoSite)
+	geosite.CountryCode = string(l.Name)
+	excludeAttrsMap, includeAttrsMap := excludeAttrs[l.Name], includeAttrs[l.Name]
+
+	// 1. First collect all full domain rules (including those with attributes)
+	if len(includeAttrsMap) == 0 {
+		geosite.Domain = append(geosite.Domain, l.FullTypeList...)
+	}
+	for _, domain := range l.AttributeRuleUniqueList {
+		if domain.Type == router.Domain_Full && keepAttributeRule(domain, excludeAttrsMap, includeAttrsMap) {
+			geosite.Domain = append(geosite.Domain, domain)
+		}
+	}
+
+	// 2. Then add all domain suffix rules (including those with attributes),
+	// the ones without attributes by their number of labels
+	if len(includeAttrsMap) == 0 {
+		geosite.Domain = append(geosite.Domain, byLabelCount(l.DomainTypeUniqueList)...)
+	}
+	for _, domain := range l.AttributeRuleUniqueList {
+		if domain.Type == router.Domain_RootDomain && keepAttributeRule(domain, excludeAttrsMap, includeAttrsMap) {
+			geosite.Domain = append(geosite.Domain, domain)
+		}
+	}
+
+	// 3. At last add the wildcard rules, the only regexp rules kept
+	seen := make(map[string]bool)
+	addWildcard := func(domain *router.Domain) {
+		if _, ok := regexpToWildcard(domain.GetValue()); ok && !seen[domain.GetValue()+ruleAttributes(domain)] {
+			seen[domain.GetValue()+ruleAttributes(domain)] = true
+			geosite.Domain = append(geosite.Domain, domain)
+		}
+	}
+	if len(includeAttrsMap) == 0 {
+		for _, domain := range l.RegexpTypeList {
+			addWildcard(domain)
+		}
+	}
+	for _, domain := range l.AttributeRuleUniqueList {
+		if domain.Type == router.Domain_Regex && keepAttributeRule(domain, excludeAttrsMap, includeAttrsMap) {
+			addWildcard(domain)
+		}
+	}
+
+	l.sortRules(geosite.Domain)
+	l.GeoSite = geosite
+}
+
+// WithExcludeAttrs returns a copy of the list converted by ToGeoSite with other
+// excluded attributes, for the formats overriding -excludeattrs. The lists
+// derived from other lists, like the sub-lists of attributes, are returned as is.
+func (l *ListInfo) WithExcludeAttrs(excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) *ListInfo {
+	if l.Parent != "" {
+		return l
+	}
+	view := *l
+	view.ToGeoSite(excludeAttrs, includeAttrs)
+	return &view
+}
+
+// keepAttributeRule reports whether a rule with attributes has none of the
+// excluded attributes, and any of the included ones if there are any
+func keepAttributeRule(domain *router.Domain, excludeAttrsMap, includeAttrsMap map[Attribute]bool) bool {
+	included := len(includeAttrsMap) == 0
+	for _, attr := range domain.GetAttribute() {
+		if attributeMatches(attr, excludeAttrsMap) {
+			return false
+		}
+		if attributeMatches(attr, includeAttrsMap) {
+			included = true
+		}
+	}
+	return included
+}
+
+// attributes returns the sorted unique attributes of the rules in the list
+func (l *ListInfo) attributes() []Attribute {
+	seen := make(map[Attribute]bool)
+	for _, rule := range l.AttributeRuleUniqueList {
+		for _, attr := range rule.Attribute {
+			seen[Attribute(AttributeString(attr))] = true
+		}
+	}
+	attrs := make([]Attribute, 0, len(seen))
+	for attr := range seen {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i] < attrs[j] })
+	return attrs
+}
+
+// AttributeSubList returns a sub-list of the flattened list, named like `CN@ADS`,
+// with only the full, domain and wildcard rules with the attribute, the same
+// as `geosite:cn@ads` in V2Ray. Attributes excluded by -excludeattrs are kept.
+func (l *ListInfo) AttributeSubList(attr Attribute) *ListInfo {
+	subList := NewListInfo()
+	subList.Name = l.Name + "@" + FileName(strings.ToUpper(string(attr)))
+	subList.Parent = l.Name
+	subList.Policy = l.Policy
+	subList.MihomoBehavior = l.MihomoBehavior
+	subList.GeoSite = &router.GeoSite{CountryCode: string(subList.Name)}
+
+	seen := make(map[string]bool)
+	for _, ruleType := range []router.Domain_Type{router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex} {
+		for _, rule := range l.AttributeRuleUniqueList {
+			if rule.Type != ruleType || !hasAnyAttribute(rule, map[Attribute]bool{attr: true}) {
+				continue
+			}
+			if _, ok := regexpToWildcard(rule.GetValue()); rule.Type == router.Domain_Regex && !ok {
+				continue
+			}
+			if key := ruleTypeValue(rule); !seen[key] {
+				seen[key] = true
+				subList.GeoSite.Domain = append(subList.GeoSite.Domain, rule)
+			}
+		}
+	}
+	return subList
+}
+
+// Match returns the rules in router.GeoSite that match the domain.
+func (l *ListInfo) Match(domain string) []*router.Domain {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+
+	var matched []*router.Domain
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := rule.GetValue()
+		switch rule.Type {
+		case router.Domain_Full:
+			if domain == ruleVal {
+				matched = append(matched, rule)
+			}
+		case router.Domain_RootDomain:
+			if domain == ruleVal || strings.HasSuffix(domain, "."+ruleVal) {
+				matched = append(matched, rule)
+			}
+		case router.Domain_Plain:
+			if strings.Contains(domain, ruleVal) {
+				matched = append(matched, rule)
+			}
+		case router.Domain_Regex:
+			if re, err := regexp.Compile(ruleVal); err == nil && re.MatchString(domain) {
+				matched = append(matched, rule)
+			}
+		}
+	}
+	return matched
+}
+
+// ResolvableDomains returns the values of full and domain type rules
+// in router.GeoSite, which can be resolved to IPs by DNS.
+func (l *ListInfo) ResolvableDomains() []string {
+	domains := make([]string, 0, len(l.GeoSite.Domain))
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+		switch rule.Type {
+		case router.Domain_Full, router.Domain_RootDomain:
+			domains = append(domains, ruleVal)
+		}
+	}
+	return domains
+}
+
+// WritePlainText writes router.GeoSite structure in plaintext format to w.
+func (l *ListInfo) WritePlainText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		bw.WriteString(ruleTypeValue(&router.Domain{Type: rule.Type, Value: ruleVal}))
+
+		// Output format is: type:domain.tld:@attr1,@attr2
+		for i, attr := range rule.Attribute {
+			if i == 0 {
+				bw.WriteString(":@" + AttributeString(attr))
+			} else {
+				bw.WriteString(",@" + AttributeString(attr))
+			}
+		}
+		bw.WriteByte('\n')
+	}
+
+	// The errors of the writes are kept by bufio.Writer and returned by Flush
+	return bw.Flush()
+}
+
+// WriteGFWList writes router.GeoSite in GFWList format to w, as the file of the
+// name in the URLs of the header. Rules with the exceptAttr attribute and the
+// rules of the exceptions list are emitted as `@@` exception rules.
+func (l *ListInfo) WriteGFWList(w io.Writer, fileName, exceptAttr string, exceptions *ListInfo) error {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	timeString := LastModifiedHeader("!", loc, time.RFC1123)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[AutoProxy 0.2.9]\n")
+	bw.WriteString(timeString)
+	bw.WriteString(SchemaHeader("!"))
+	bw.WriteString("! Expires: 24h\n")
+	bw.WriteString("! HomePage: https://github.com/caocaocc/rule-set\n")
+	bw.WriteString("! GitHub URL: https://raw.githubusercontent.com/caocaocc/rule-set/release/" + fileName + "\n")
+	bw.WriteString("! jsdelivr URL: https://cdn.jsdelivr.net/gh/caocaocc/rule-set@release/" + fileName + "\n")
+	bw.WriteString("\n")
+
+	var exceptionRules []*router.Domain
+	for _, rule := range l.GeoSite.Domain {
+		if exceptAttr != "" && hasAnyAttribute(rule, map[Attribute]bool{Attribute(exceptAttr): true}) {
+			exceptionRules = append(exceptionRules, rule)
+			continue
+		}
+		writeGFWListRule(bw, "", rule)
+	}
+
+	// Exception rules take precedence over the others in GFWList clients
+	if exceptions != nil {
+		exceptionRules = append(exceptionRules, exceptions.GeoSite.Domain...)
+	}
+	for _, rule := range exceptionRules {
+		writeGFWListRule(bw, "@@", rule)
+	}
+
+	return bw.Flush()
+}
+
+// writeGFWListRule writes a rule in GFWList format, with `@@` prefix for exception rules.
+func writeGFWListRule(bw *bufio.Writer, prefix string, rule *router.Domain) {
+	ruleVal := strings.TrimSpace(rule.GetValue())
+	if len(ruleVal) == 0 {
+		return
+	}
+
+	// Adblock-style clients may match either form of an internationalized domain
+	unicodeVal := unicodeDomain(ruleVal)
+
+	switch rule.Type {
+	case router.Domain_Full:
+		bw.WriteString(prefix + "|http://" + ruleVal + "\n")
+		bw.WriteString(prefix + "|https://" + ruleVal + "\n")
+		if unicodeVal != "" {
+			bw.WriteString(prefix + "|http://" + unicodeVal + "\n")
+			bw.WriteString(prefix + "|https://" + unicodeVal + "\n")
+		}
+	case router.Domain_RootDomain:
+		bw.WriteString(prefix + "||" + ruleVal + "\n")
+		if unicodeVal != "" {
+			bw.WriteString(prefix + "||" + unicodeVal + "\n")
+		}
+	case router.Domain_Plain:
+		bw.WriteString(prefix + ruleVal + "\n")
+	case router.Domain_Regex:
+		bw.WriteString(prefix + "/" + ruleVal + "/\n")
+	}
+}
+
+// WriteSurgeList writes router.GeoSite in Surge rule list format to w
+func (l *ListInfo) WriteSurgeList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		if !isListFieldSafe(ruleVal) {
+			Logf(LevelNotice, "%s: rule %q cannot be represented in Surge format, skipped.", l.Name, ruleVal)
+			continue
+		}
+
+		// Append the policy column only if a policy is configured for the list or the rule
+		var policyColumn string
+		if policy := l.rulePolicy(rule); policy != "" {
+			policyColumn = "," + surgePolicy(policy)
+		}
+
+		// Convert different rule types to Surge format
+		switch rule.Type {
+		case router.Domain_Full:
+			bw.WriteString("DOMAIN," + ruleVal + policyColumn + "\n")
+		case router.Domain_RootDomain:
+			bw.WriteString("DOMAIN-SUFFIX," + ruleVal + policyColumn + "\n")
+		case router.Domain_Regex:
+			if pattern, ok := regexpToWildcard(ruleVal); ok {
+				bw.WriteString("DOMAIN-WILDCARD," + pattern + policyColumn + "\n")
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteEgernRuleSet writes router.GeoSite in Egern rule set YAML format to w,
+// with the full rules in domain_set, the domain rules in domain_suffix_set and
+// the wildcard rules in domain_wildcard_set.
+func (l *ListInfo) WriteEgernRuleSet(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	// writeSet writes the values of the rules of a type in their original order,
+	// leaving out the key of an empty set
+	written := false
+	writeSet := func(key string, ruleType router.Domain_Type) {
+		first := true
+		for _, rule := range l.GeoSite.Domain {
+			ruleVal := strings.TrimSpace(rule.GetValue())
+			if len(ruleVal) == 0 || rule.Type != ruleType {
+				continue
+			}
+			if ruleType == router.Domain_Regex {
+				pattern, ok := regexpToWildcard(ruleVal)
+				if !ok {
+					continue
+				}
+				ruleVal = pattern
+			}
+			if first {
+				bw.WriteString(key + ":\n")
+				first, written = false, true
+			}
+			bw.WriteString("  - " + yamlQuote(ruleVal) + "\n")
+		}
+	}
+	writeSet("domain_set", router.Domain_Full)
+	writeSet("domain_suffix_set", router.Domain_RootDomain)
+	writeSet("domain_wildcard_set", router.Domain_Regex)
+	if !written {
+		bw.WriteString("domain_set: []\n")
+	}
+
+	return bw.Flush()
+}
+
+// WriteMihomoList writes router.GeoSite in Mihomo/Clash.Meta YAML format to w,
+// in the Mihomo behavior of the list
+func (l *ListInfo) WriteMihomoList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments and payload
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+	bw.WriteString("payload:\n")
+	for _, rule := range l.mihomoPayload() {
+		bw.WriteString("  - " + yamlQuote(rule) + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// WriteMihomoText writes router.GeoSite to w as a Mihomo/Clash.Meta rule
+// provider of the text format, one rule per line without the YAML payload,
+// which Mihomo loads faster.
+func (l *ListInfo) WriteMihomoText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	for _, rule := range l.mihomoPayload() {
+		bw.WriteString(rule + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// WriteStashOverride writes router.GeoSite to w as a Stash override, with the
+// rules in a rule provider of the list and a RULE-SET rule of its policy.
+func (l *ListInfo) WriteStashOverride(w io.Writer) error {
+	name := strings.ToLower(string(l.Name))
+
+	// Rule providers have a single policy, the one of the domain rules
+	policy := l.defaultPolicy()
+	if configured := l.Policy.For(router.Domain_RootDomain); configured != "" {
+		policy = configured
+	}
+
+	var payload []string
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		// Rules of the domain behavior are in the Mihomo/Clash.Meta syntax
+		switch rule.Type {
+		case router.Domain_Full:
+			payload = append(payload, yamlQuote(ruleVal))
+		case router.Domain_RootDomain:
+			payload = append(payload, yamlQuote("+."+ruleVal))
+		case router.Domain_Regex:
+			if pattern, ok := mihomoWildcard(l.Name, "Stash", ruleVal); ok {
+				payload = append(payload, yamlQuote(pattern))
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	bw.WriteString("name: " + yamlQuote(name) + "\n")
+	bw.WriteString("desc: " + yamlQuote("Rules of the "+name+" list of https://github.com/caocaocc/rule-set") + "\n")
+	bw.WriteString("rule-providers:\n")
+	bw.WriteString("  " + yamlQuote(name) + ":\n")
+	bw.WriteString("    behavior: domain\n")
+	if len(payload) == 0 {
+		bw.WriteString("    payload: []\n")
+	} else {
+		bw.WriteString("    payload:\n")
+		for _, value := range payload {
+			bw.WriteString("      - " + value + "\n")
+		}
+	}
+	bw.WriteString("rules:\n")
+	bw.WriteString("  - " + yamlQuote("RULE-SET,"+name+","+stashPolicy(policy)) + "\n")
+
+	return bw.Flush()
+}
+
+// WriteSingBoxList writes router.GeoSite in sing-box rule list format to w,
+// a rule set of the SingBoxVersion with a single rule, indented like
+// json.MarshalIndent.
+func (l *ListInfo) WriteSingBoxList(w io.Writer) error {
+	// The keys of the rule in the order of encoding/json, with the rule types of their values
+	keys := []struct {
+		key       string
+		ruleTypes []router.Domain_Type
+	}{
+		{"domain", []router.Domain_Type{router.Domain_Full}},
+		{"domain_suffix", []router.Domain_Type{router.Domain_RootDomain}},
+		{"domain_regex", []router.Domain_Type{router.Domain_Regex}},
+	}
+	if _, inDomain := SingBoxDomainSuffix(""); inDomain {
+		keys[0].ruleTypes = append(keys[0].ruleTypes, router.Domain_RootDomain)
+	}
+	has := make(map[router.Domain_Type]bool)
+	for _, rule := range l.GeoSite.Domain {
+		if len(strings.TrimSpace(rule.GetValue())) > 0 {
+			has[rule.Type] = true
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("{\n  \"version\": " + strconv.Itoa(SingBoxVersion) + ",\n  \"rules\": [\n    {")
+	// writeValues writes the values of the rules of the types in their original order
+	writeValues := func(key string, ruleTypes []router.Domain_Type) {
+		bw.WriteString("\n      \"" + key + "\": [")
+		first := true
+		for _, rule := range l.GeoSite.Domain {
+			ruleVal := strings.TrimSpace(rule.GetValue())
+			if len(ruleVal) == 0 || !slices.Contains(ruleTypes, rule.Type) {
+				continue
+			}
+			if key == "domain_suffix" {
+				ruleVal, _ = SingBoxDomainSuffix(ruleVal)
+			}
+			if !first {
+				bw.WriteString(",")
+			}
+			first = false
+			value, _ := json.Marshal(ruleVal)
+			bw.WriteString("\n        ")
+			bw.Write(value)
+		}
+		bw.WriteString("\n      ]")
+	}
+	written := false
+	for _, k := range keys {
+		if !slices.ContainsFunc(k.ruleTypes, func(ruleType router.Domain_Type) bool { return has[ruleType] }) {
+			continue
+		}
+		if written {
+			bw.WriteString(",")
+		}
+		writeValues(k.key, k.ruleTypes)
+		written = true
+	}
+	if written {
+		bw.WriteString("\n    }")
+	} else {
+		bw.WriteString("}")
+	}
+	bw.WriteString("\n  ]\n}")
+
+	return bw.Flush()
+}
+
+// WriteV2RayRules writes the routing rules of V2Ray/Xray for the list to w, to
+// be pasted into the routing.rules of a config: the "geosite" rule references
+// the entry of the list in the dat file, and the "inline" rules have the rules
+// of the list in the domain syntax of V2Ray instead, one rule per outbound.
+// Lite variants and chunks of lists have no entries in the dat file, nor
+// "geosite" rules.
+func (l *ListInfo) WriteV2RayRules(w io.Writer) error {
+	name := strings.ToLower(string(l.Name))
+	reference := "geosite:" + name
+	if DatName != "geosite.dat" {
+		reference = "ext:" + DatName + ":" + name
+	}
+
+	// The geosite rule has a single outbound, the one of the domain rules
+	policy := l.defaultPolicy()
+	if configured := l.Policy.For(router.Domain_RootDomain); configured != "" {
+		policy = configured
+	}
+
+	// outboundOf returns the outbound of a rule, and the outbounds are in
+	// the order of the first rules sent to them
+	outboundOf := func(rule *router.Domain) string {
+		if configured := l.rulePolicy(rule); configured != "" {
+			return v2rayOutbound(configured)
+		}
+		return v2rayOutbound(l.defaultPolicy())
+	}
+	var outbounds []string
+	for _, rule := range l.GeoSite.Domain {
+		if len(strings.TrimSpace(rule.GetValue())) == 0 {
+			continue
+		}
+		if outbound := outboundOf(rule); !slices.Contains(outbounds, outbound) {
+			outbounds = append(outbounds, outbound)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	// writeRule writes a rule object of the outbound with the domains written by writeDomains
+	writeRule := func(outbound string, writeDomains func()) {
+		bw.WriteString("\n    {\n      \"type\": \"field\",\n      \"domain\": [")
+		writeDomains()
+		value, _ := json.Marshal(outbound)
+		bw.WriteString("\n      ],\n      \"outboundTag\": ")
+		bw.Write(value)
+		bw.WriteString("\n    }")
+	}
+	writeValue := func(s string) {
+		value, _ := json.Marshal(s)
+		bw.WriteString("\n        ")
+		bw.Write(value)
+	}
+
+	bw.WriteString("{\n  \"geosite\": [")
+	if !l.isLite() && l.Chunk == 0 {
+		writeRule(v2rayOutbound(policy), func() { writeValue(reference) })
+		bw.WriteString("\n  ")
+	}
+	bw.WriteString("],\n  \"inline\": [")
+	for i, outbound := range outbounds {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		writeRule(outbound, func() {
+			first := true
+			for _, rule := range l.GeoSite.Domain {
+				ruleVal := strings.TrimSpace(rule.GetValue())
+				if len(ruleVal) == 0 || outboundOf(rule) != outbound {
+					continue
+				}
+				if !first {
+					bw.WriteString(",")
+				}
+				first = false
+				if rule.Type == router.Domain_Regex {
+					writeValue("regexp:" + ruleVal)
+				} else {
+					writeValue(ruleTypeValue(&router.Domain{Type: rule.Type, Value: ruleVal}))
+				}
+			}
+		})
+	}
+	if len(outbounds) > 0 {
+		bw.WriteString("\n  ")
+	}
+	bw.WriteString("]\n}\n")
+
+	return bw.Flush()
+}
+
+// WriteQuantumultXList writes router.GeoSite in Quantumult X snippet format to w
+func (l *ListInfo) WriteQuantumultXList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	// Add header comments
+	header, err := FileHeader("#", strings.ToLower(string(l.Name)), nil, time.RFC1123)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(header)
+
+	policy := l.defaultPolicy()
+
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		if !isListFieldSafe(ruleVal) {
+			Logf(LevelNotice, "%s: rule %q cannot be represented in Quantumult X format, skipped.", l.Name, ruleVal)
+			continue
+		}
+
+		rulePolicy := policy
+		if configured := l.rulePolicy(rule); configured != "" {
+			rulePolicy = quantumultXPolicy(configured)
+		}
+
+		// Convert different rule types to Quantumult X format
+		switch rule.Type {
+		case router.Domain_Full:
+			bw.WriteString("host, " + ruleVal + ", " + rulePolicy + "\n")
+		case router.Domain_RootDomain:
+			bw.WriteString("host-suffix, " + ruleVal + ", " + rulePolicy + "\n")
+		case router.Domain_Regex:
+			if pattern, ok := regexpToWildcard(ruleVal); ok {
+				bw.WriteString("host-wildcard, " + pattern + ", " + rulePolicy + "\n")
+			}
+		}
+	}
+
+	if keywords, regexps := l.droppedRuleCounts(); keywords+regexps > 0 {
+		Logf(LevelNotice, "%s: %d keyword and %d regexp rules cannot be represented in Quantumult X format, skipped.", l.Name, keywords, regexps)
+	}
+
+	return bw.Flush()
+}
+
+// droppedRuleCounts returns the numbers of the keyword rules and of the regexp
+// rules other than wildcards of the list, which ToGeoSite leaves out.
+func (l *ListInfo) droppedRuleCounts() (keywords, regexps int) {
+	count := func(rule *router.Domain) {
+		switch rule.Type {
+		case router.Domain_Plain:
+			keywords++
+		case router.Domain_Regex:
+			if _, ok := regexpToWildcard(rule.GetValue()); !ok {
+				regexps++
+			}
+		}
+	}
+	for _, rules := range [][]*router.Domain{l.KeywordTypeList, l.RegexpTypeList, l.AttributeRuleUniqueList} {
+		for _, rule := range rules {
+			count(rule)
+		}
+	}
+	return keywords, regexps
+}
@@ -0,0 +1,525 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ListInfoMap is the map of files in data directory and ListInfo
+type ListInfoMap map[FileName]*ListInfo
+
+// Conflict resolution policies for lists with the same name
+// defined more than once in the data directories.
+const (
+	ConflictError       = "error"
+	ConflictMerge       = "merge"
+	ConflictPreferLocal = "prefer-local"
+)
+
+// DataSource is a data directory, with the namespace of its lists.
+// Lists in a namespaced data directory are named like `upstream:google`,
+// and are also available without the namespace, unless a list of the same
+// name is already defined and the conflict resolution policy is not `merge`.
+type DataSource struct {
+	Namespace string
+	Path      string
+	// Overlay merges the lists into the same-named lists of earlier data
+	// directories, or replaces them if the `# overlay: replace` directive is set.
+	Overlay bool
+}
+
+// OverlayDataSources returns the data directories of the comma separated paths,
+// where later directories overlay earlier ones.
+func OverlayDataSources(paths string) []DataSource {
+	var sources []DataSource
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			sources = append(sources, DataSource{Path: path, Overlay: len(sources) > 0})
+		}
+	}
+	return sources
+}
+
+// LoadListInfoMap processes all files in the data directories,
+// then flattens the included lists of them.
+func LoadListInfoMap(sources []DataSource, conflict string) (ListInfoMap, error) {
+	started := time.Now()
+	listInfoMap, err := Parse(sources, conflict)
+	var skipped *SkippedListsError
+	if err != nil && !errors.As(err, &skipped) {
+		return nil, err
+	}
+	Timing.Add("parse", time.Since(started))
+	Logger.Debug("parsed data directories", "sources", len(sources), "lists", len(listInfoMap), "duration", time.Since(started))
+
+	started = time.Now()
+	if err := listInfoMap.Flatten(); err != nil {
+		return nil, err
+	}
+	Timing.Add("flatten", time.Since(started))
+	Logger.Debug("flattened lists", "lists", len(listInfoMap), "duration", time.Since(started))
+
+	if skipped != nil {
+		return listInfoMap, skipped
+	}
+	return listInfoMap, nil
+}
+
+// SkippedListsError is the error of parsing the data directories with
+// KeepGoing, returned with the lists parsed without errors.
+type SkippedListsError struct {
+	// Errors is an error of each skipped list
+	Errors []error
+}
+
+func (e *SkippedListsError) Error() string {
+	return fmt.Sprintf("%d lists skipped:\n%v", len(e.Errors), errors.Join(e.Errors...))
+}
+
+func (e *SkippedListsError) Unwrap() []error {
+	return e.Errors
+}
+
+// Parse processes all files in the data directories
+// without flattening the included lists. With KeepGoing, the lists with
+// errors and the lists including them are skipped, and returned with a
+// *SkippedListsError.
+func Parse(sources []DataSource, conflict string) (ListInfoMap, error) {
+	switch conflict {
+	case ConflictError, ConflictMerge, ConflictPreferLocal:
+	default:
+		return nil, errors.New("unknown conflict resolution policy: " + conflict)
+	}
+
+	listInfoMap := make(ListInfoMap)
+	var skippedErrors []error
+	skippedNames := make(map[FileName]bool)
+
+	for _, source := range sources {
+		var lists []*ListInfo
+		if err := filepath.Walk(source.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			list, err := listInfoMap.Marshal(path, source.Namespace)
+			if err != nil {
+				if !KeepGoing {
+					return err
+				}
+				skippedErrors = append(skippedErrors, err)
+				skippedNames[listName(path, source.Namespace)] = true
+				return nil
+			}
+			if source.Overlay {
+				listInfoMap.overlay(list)
+			} else if err := listInfoMap.Add(list, conflict); err != nil {
+				return err
+			}
+			lists = append(lists, list)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		if source.Namespace != "" {
+			if err := listInfoMap.addNamespacedLists(source.Namespace, lists, conflict); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if KeepGoing {
+		// The lists overlaid by a skipped list are skipped too, not to be
+		// generated without the overlay
+		for name := range skippedNames {
+			delete(listInfoMap, name)
+		}
+		skippedErrors = append(skippedErrors, listInfoMap.dropBrokenInclusions()...)
+	}
+	if len(skippedErrors) > 0 {
+		return listInfoMap, &SkippedListsError{Errors: skippedErrors}
+	}
+	return listInfoMap, nil
+}
+
+// dropBrokenInclusions removes the lists including a skipped or unknown list,
+// directly or not, and returns an error of each.
+func (lm *ListInfoMap) dropBrokenInclusions() []error {
+	var errs []error
+	for dropped := true; dropped; {
+		dropped = false
+		names := make([]string, 0, len(*lm))
+		for name := range *lm {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, included := range (*lm)[FileName(name)].includedNames() {
+				if (*lm)[included] == nil {
+					errs = append(errs, fmt.Errorf("list %s includes skipped or unknown list %s", name, included))
+					delete(*lm, FileName(name))
+					dropped = true
+					break
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// listName returns the name of the list of a data file, eg: `UPSTREAM:GOOGLE`
+func listName(path, namespace string) FileName {
+	name := FileName(strings.ToUpper(filepath.Base(path)))
+	if namespace != "" {
+		name = FileName(strings.ToUpper(namespace)) + ":" + name
+	}
+	return name
+}
+
+// Marshal processes a file in data directory and generates ListInfo for it.
+func (lm *ListInfoMap) Marshal(path, namespace string) (*ListInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := NewListInfo()
+	list.Name = listName(path, namespace)
+	if err := list.ProcessList(file); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Add adds a ListInfo, resolving the conflict with an existing
+// list of the same name according to the conflict resolution policy.
+func (lm *ListInfoMap) Add(list *ListInfo, conflict string) error {
+	existing := (*lm)[list.Name]
+	if existing == nil {
+		(*lm)[list.Name] = list
+		return nil
+	}
+
+	switch conflict {
+	case ConflictMerge:
+		existing.Merge(list)
+	case ConflictPreferLocal:
+		Logf(LevelNotice, "%s: list is defined more than once, the first one is kept.", list.Name)
+	default:
+		return fmt.Errorf("list %s is defined more than once, use a namespace or another conflict resolution policy", list.Name)
+	}
+	return nil
+}
+
+// overlay merges a list of an overlay data directory into the same-named list,
+// or replaces it if the list has the `# overlay: replace` directive.
+func (lm *ListInfoMap) overlay(list *ListInfo) {
+	existing := (*lm)[list.Name]
+	if existing == nil || list.OverlayReplace {
+		(*lm)[list.Name] = list
+		return
+	}
+	existing.Merge(list)
+}
+
+// addNamespacedLists resolves the included lists of the lists in a namespace
+// to the same namespace if exist, and adds them without the namespace.
+// A list already defined without the namespace is kept, as the namespaced
+// list remains available with its qualified name, unless the conflict
+// resolution policy is to merge them.
+func (lm *ListInfoMap) addNamespacedLists(namespace string, lists []*ListInfo, conflict string) error {
+	prefix := FileName(strings.ToUpper(namespace)) + ":"
+	for _, list := range lists {
+		for included, attrs := range list.InclusionAttributeMap {
+			if strings.Contains(string(included), ":") || (*lm)[prefix+included] == nil {
+				continue
+			}
+			delete(list.InclusionAttributeMap, included)
+			list.InclusionAttributeMap[prefix+included] = append(list.InclusionAttributeMap[prefix+included], attrs...)
+		}
+	}
+
+	for _, list := range lists {
+		name := FileName(strings.TrimPrefix(string(list.Name), string(prefix)))
+		if (*lm)[name] != nil && conflict != ConflictMerge {
+			Logger.Debug("list without namespace kept", "list", name, "namespaced", list.Name)
+			continue
+		}
+		alias := NewListInfo()
+		alias.Name = name
+		alias.Merge(list)
+		if err := lm.Add(alias, conflict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckInclusions builds the include dependency graph of the lists
+// in data directory, and reports unknown included lists and include cycles.
+func (lm *ListInfoMap) CheckInclusions() error {
+	names := make([]string, 0, len(*lm))
+	for name := range *lm {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, included := range (*lm)[FileName(name)].includedNames() {
+			if (*lm)[included] == nil {
+				return fmt.Errorf("list %s includes unknown list %s", name, included)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[FileName]int)
+	var path []FileName
+	var visit func(name FileName) error
+	visit = func(name FileName) error {
+		switch state[name] {
+		case visiting:
+			cycle := []string{string(name)}
+			for i := len(path) - 1; i >= 0 && path[i] != name; i-- {
+				cycle = append([]string{string(path[i])}, cycle...)
+			}
+			return fmt.Errorf("include cycle: %s -> %s", name, strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, included := range (*lm)[name].includedNames() {
+			if err := visit(included); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(FileName(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Dependents returns the lists that are changed by changes of the given lists,
+// which are the lists themselves and the lists including them, directly or not.
+func (lm *ListInfoMap) Dependents(names map[FileName]bool) map[FileName]bool {
+	includers := make(map[FileName][]FileName)
+	for name, listinfo := range *lm {
+		for _, included := range listinfo.includedNames() {
+			includers[included] = append(includers[included], name)
+		}
+	}
+
+	dependents := make(map[FileName]bool)
+	var visit func(name FileName)
+	visit = func(name FileName) {
+		if dependents[name] {
+			return
+		}
+		dependents[name] = true
+		for _, includer := range includers[name] {
+			visit(includer)
+		}
+	}
+	for name := range names {
+		visit(name)
+	}
+	return dependents
+}
+
+// Flatten flattens the included lists and
+// generates a domain trie for each file in data directory to
+// make the items of domain type list unique.
+func (lm *ListInfoMap) Flatten() error {
+	if err := lm.CheckInclusions(); err != nil {
+		return err
+	}
+
+	inclusionLevel := make([]map[FileName]bool, 0, 20)
+	okayList := make(map[FileName]bool)
+	inclusionLevelAllLength, loopTimes := 0, 0
+
+	for inclusionLevelAllLength < len(*lm) {
+		inclusionMap := make(map[FileName]bool)
+
+		if loopTimes == 0 {
+			for _, listinfo := range *lm {
+				if listinfo.HasInclusion {
+					continue
+				}
+				inclusionMap[listinfo.Name] = true
+			}
+		} else {
+			for _, listinfo := range *lm {
+				if !listinfo.HasInclusion || okayList[listinfo.Name] {
+					continue
+				}
+
+				var passTimes int
+				for filename := range listinfo.InclusionAttributeMap {
+					if !okayList[filename] {
+						break
+					}
+					passTimes++
+				}
+				if passTimes == len(listinfo.InclusionAttributeMap) {
+					inclusionMap[listinfo.Name] = true
+				}
+			}
+		}
+
+		for filename := range inclusionMap {
+			okayList[filename] = true
+		}
+
+		inclusionLevel = append(inclusionLevel, inclusionMap)
+		inclusionLevelAllLength += len(inclusionMap)
+		loopTimes++
+	}
+
+	for idx, inclusionMap := range inclusionLevel {
+		Logger.Debug("flattening inclusion level", "level", idx+1, "lists", len(inclusionMap))
+
+		for inclusionFilename := range inclusionMap {
+			if err := (*lm)[inclusionFilename].Flatten(lm); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToProto generates a router.GeoSite for each file in data directory
+// and returns a router.GeoSiteList
+func (lm *ListInfoMap) ToProto(excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) *router.GeoSiteList {
+	names := make([]string, 0, len(*lm))
+	for name := range *lm {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	protoList := new(router.GeoSiteList)
+	for _, name := range names {
+		listinfo := (*lm)[FileName(name)]
+		listinfo.ToGeoSite(excludeAttrs, includeAttrs)
+		protoList.Entry = append(protoList.Entry, listinfo.GeoSite)
+	}
+	return protoList
+}
+
+// AttributeSubLists returns the sub-lists of the lists with certain attributes,
+// named like `CN@ADS`, or with each of their attributes if none is specified.
+func (lm *ListInfoMap) AttributeSubLists(exportAttrs map[FileName]map[Attribute]bool) []*ListInfo {
+	names := make([]string, 0, len(exportAttrs))
+	for name := range exportAttrs {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var subLists []*ListInfo
+	for _, name := range names {
+		listinfo := (*lm)[FileName(name)]
+		if listinfo == nil {
+			Logf(LevelNotice, "%s: no such list to export attributes of in the directory, skipped.", strings.ToLower(name))
+			continue
+		}
+		attrs := make([]Attribute, 0, len(exportAttrs[FileName(name)]))
+		for attr := range exportAttrs[FileName(name)] {
+			attrs = append(attrs, Attribute(strings.ToLower(string(attr))))
+		}
+		if len(attrs) == 0 {
+			attrs = listinfo.attributes()
+		}
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i] < attrs[j] })
+		for _, attr := range attrs {
+			subLists = append(subLists, listinfo.AttributeSubList(attr))
+		}
+	}
+	return subLists
+}
+
+// WriteGFWList writes the lists to be generated into GFWList format, separated
+// by ',' comma and merged into one if several, to w as the file of the name,
+// with the rules of the exceptList list as exception rules.
+// Nothing is written if togfwlist is empty.
+func (lm *ListInfoMap) WriteGFWList(w io.Writer, fileName, togfwlist, exceptAttr, exceptList string) error {
+	var lists []*ListInfo
+	for _, name := range strings.Split(togfwlist, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		listinfo := (*lm)[FileName(strings.ToUpper(name))]
+		if listinfo == nil {
+			return errors.New("no such list: " + name)
+		}
+		lists = append(lists, listinfo)
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	var exceptions *ListInfo
+	if exceptList != "" {
+		if exceptions = (*lm)[FileName(strings.ToUpper(exceptList))]; exceptions == nil {
+			return errors.New("no such list: " + exceptList)
+		}
+	}
+	return mergeLists(lists).WriteGFWList(w, fileName, strings.ToLower(exceptAttr), exceptions)
+}
+
+// mergeLists returns a list of the rules of the lists converted by ToGeoSite,
+// without duplicates, or the list itself if there is only one.
+func mergeLists(lists []*ListInfo) *ListInfo {
+	if len(lists) == 1 {
+		return lists[0]
+	}
+	merged := NewListInfo()
+	merged.Name = lists[0].Name
+	merged.GeoSite = &router.GeoSite{CountryCode: string(merged.Name)}
+	seen := make(map[string]bool)
+	for _, listinfo := range lists {
+		for _, rule := range listinfo.GeoSite.GetDomain() {
+			if key := ruleTypeValue(rule) + ruleAttributes(rule); !seen[key] {
+				seen[key] = true
+				merged.GeoSite.Domain = append(merged.GeoSite.Domain, rule)
+			}
+		}
+	}
+	return merged
+}
+
+// MatchLists returns the sorted names of the lists that the domain belongs to.
+func (lm *ListInfoMap) MatchLists(domain string) []string {
+	names := make([]string, 0)
+	for name, listinfo := range *lm {
+		if listinfo.GeoSite != nil && len(listinfo.Match(domain)) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
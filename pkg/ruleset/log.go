@@ -0,0 +1,148 @@
+package ruleset
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LevelNotice is the level of the messages about skipped lists and rules,
+// between info and warning.
+const LevelNotice = slog.Level(2)
+
+// Log formats of NewLogger
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Logger is the logger of the messages of the package and the program,
+// writing plain text at the info level to the standard output by default.
+var Logger = slog.New(NewTextHandler(os.Stdout, slog.LevelInfo))
+
+// NewLogger returns a logger writing to w the messages at level or above,
+// in plain text or in JSON lines for parsing by CI systems.
+func NewLogger(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	switch format {
+	case LogFormatText:
+		return slog.New(NewTextHandler(w, level)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: replaceJSONAttr})), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// replaceJSONAttr names LevelNotice as NOTICE instead of INFO+2, and trims the
+// blank lines separating the steps in plain text.
+func replaceJSONAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelNotice {
+			a.Value = slog.StringValue("NOTICE")
+		}
+	case slog.MessageKey:
+		a.Value = slog.StringValue(strings.TrimSpace(a.Value.String()))
+	}
+	return a
+}
+
+// TextHandler is a slog.Handler writing a message per line, prefixed by its
+// level except info, and followed by its attributes in key=value pairs, eg:
+//
+//	Warning: data/cn:12: invalid attribute: "example.com @"
+//	Debug: cn exported rules=1024 duration=3ms
+type TextHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs string
+	group string
+}
+
+// NewTextHandler returns a TextHandler writing to w the messages at level or above.
+func NewTextHandler(w io.Writer, level slog.Leveler) *TextHandler {
+	return &TextHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		sb.WriteString("Failed: ")
+	case r.Level >= slog.LevelWarn:
+		sb.WriteString("Warning: ")
+	case r.Level >= LevelNotice:
+		sb.WriteString("Notice: ")
+	case r.Level < slog.LevelInfo:
+		sb.WriteString("Debug: ")
+	}
+	sb.WriteString(r.Message)
+	sb.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeTextAttr(&sb, h.group, a)
+		return true
+	})
+	sb.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
+
+func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	for _, a := range attrs {
+		writeTextAttr(&sb, h.group, a)
+	}
+	h2 := *h
+	h2.attrs += sb.String()
+	return &h2
+}
+
+func (h *TextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group += name + "."
+	return &h2
+}
+
+func writeTextAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeTextAttr(sb, prefix, ga)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(sb, " %s%s=%s", prefix, a.Key, value)
+}
+
+// Logf logs a message formatted in the manner of fmt.Printf at level with Logger.
+func Logf(level slog.Level, format string, a ...interface{}) {
+	Logger.Log(context.Background(), level, fmt.Sprintf(format, a...))
+}
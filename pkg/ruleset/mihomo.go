@@ -0,0 +1,115 @@
+package ruleset
+
+import (
+	"fmt"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// MihomoBehavior is the behavior of the Mihomo/Clash.Meta rule providers of a
+// list or an IP set, which the rule provider config must declare.
+type MihomoBehavior string
+
+const (
+	// MihomoDomain is the default behavior of lists, with domains like `+.example.com`
+	MihomoDomain MihomoBehavior = "domain"
+	// MihomoClassical is the behavior of rules with their types, like `DOMAIN-SUFFIX,example.com`
+	MihomoClassical MihomoBehavior = "classical"
+	// MihomoIPCIDR is the default behavior of IP sets, with CIDRs like `1.0.1.0/24`
+	MihomoIPCIDR MihomoBehavior = "ipcidr"
+)
+
+// mihomoPolicies maps policies to their Mihomo flavors, the proxy policy being
+// the conventional name of the proxy group
+var mihomoPolicies = map[string]string{
+	"direct":      "DIRECT",
+	"proxy":       "PROXY",
+	"reject":      "REJECT",
+	"reject-drop": "REJECT-DROP",
+}
+
+// ParseMihomoBehaviors parses the -mihomobehavior option into a map of the
+// names of lists or IP sets and their behavior, eg: `cn=classical,telegram=classical`.
+func ParseMihomoBehaviors(behaviors string) (map[FileName]MihomoBehavior, error) {
+	behaviorOfFile := make(map[FileName]MihomoBehavior)
+	for _, nameBehavior := range strings.Split(behaviors, ",") {
+		if nameBehavior = strings.TrimSpace(nameBehavior); nameBehavior == "" {
+			continue
+		}
+		name, behavior, ok := strings.Cut(nameBehavior, "=")
+		behavior = strings.ToLower(strings.TrimSpace(behavior))
+		switch MihomoBehavior(behavior) {
+		case MihomoDomain, MihomoClassical, MihomoIPCIDR:
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid Mihomo behavior %q, want name=domain, name=classical or name=ipcidr", nameBehavior)
+		}
+		behaviorOfFile[FileName(strings.ToUpper(strings.TrimSpace(name)))] = MihomoBehavior(behavior)
+	}
+	return behaviorOfFile, nil
+}
+
+// mihomoPolicy returns the Mihomo flavor of the policy, the other reject
+// policies being REJECT
+func mihomoPolicy(policy string) string {
+	if mihomo, ok := mihomoPolicies[policy]; ok {
+		return mihomo
+	}
+	if strings.HasPrefix(policy, "reject-") {
+		return "REJECT"
+	}
+	return policy
+}
+
+// mihomoPayload returns the unquoted rules of the Mihomo rule providers of the
+// list in its behavior, where the classical rules have their policy if one is
+// configured for the rule or its type.
+func (l *ListInfo) mihomoPayload() []string {
+	var payload []string
+	for _, rule := range l.GeoSite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		if l.MihomoBehavior == MihomoClassical {
+			var ruleType string
+			switch rule.Type {
+			case router.Domain_Full:
+				ruleType = "DOMAIN"
+			case router.Domain_RootDomain:
+				ruleType = "DOMAIN-SUFFIX"
+			case router.Domain_Regex:
+				// The regexps of wildcards keep the wildcards within a label
+				ruleType = "DOMAIN-REGEX"
+			default:
+				continue
+			}
+			line := ruleType + "," + ruleVal
+			if policy := l.rulePolicy(rule); policy != "" {
+				line += "," + mihomoPolicy(policy)
+			}
+			payload = append(payload, line)
+			continue
+		}
+
+		// Convert different rule types to Mihomo/Clash.Meta format
+		switch rule.Type {
+		case router.Domain_Full:
+			// Full domain match should use exact domain
+			payload = append(payload, ruleVal)
+		case router.Domain_RootDomain:
+			// Root domain should use +. prefix which matches the domain itself and all subdomains
+			payload = append(payload, "+."+ruleVal)
+		case router.Domain_Regex:
+			// Wildcards of whole labels match a label like in the data syntax
+			if pattern, ok := mihomoWildcard(l.Name, "Mihomo", ruleVal); ok {
+				payload = append(payload, pattern)
+			}
+		}
+	}
+	return payload
+}
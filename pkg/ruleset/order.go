@@ -0,0 +1,91 @@
+package ruleset
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// Orders of the rules of the generated lists, the values of the -sort option.
+const (
+	// SortFullBeforeSuffix puts the full rules first, then the domain rules
+	// by their number of labels, then the wildcard rules, as they are deduplicated.
+	SortFullBeforeSuffix = "full-before-suffix"
+	// SortSourceOrder keeps the order of the rules in the data files, with
+	// the rules of the included lists after the ones of the list.
+	SortSourceOrder = "source-order"
+	// SortAlphabetical sorts the rules by their domains, then the full rules
+	// before the domain and the wildcard rules.
+	SortAlphabetical = "alphabetical"
+	// SortLabelCount sorts the rules by the number of labels of their domains,
+	// then by their domains, eg: `cn` before `example.cn`.
+	SortLabelCount = "label-count"
+)
+
+// CheckSortOrder checks the order of the -sort option.
+func CheckSortOrder(order string) error {
+	switch order {
+	case SortFullBeforeSuffix, SortSourceOrder, SortAlphabetical, SortLabelCount:
+		return nil
+	}
+	return errors.New("unknown sort order: " + order)
+}
+
+// sortDomain returns the domain of a rule to sort it by, the pattern of a
+// wildcard rather than its regexp.
+func sortDomain(rule *router.Domain) string {
+	if rule.Type == router.Domain_Regex {
+		if pattern, ok := regexpToWildcard(rule.GetValue()); ok {
+			return pattern
+		}
+	}
+	return rule.GetValue()
+}
+
+// byLabelCount returns the rules sorted by the number of labels of their
+// domains, keeping the order of the rules with the same number.
+func byLabelCount(rules []*router.Domain) []*router.Domain {
+	sorted := append([]*router.Domain(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(sorted[i].GetValue(), ".") < strings.Count(sorted[j].GetValue(), ".")
+	})
+	return sorted
+}
+
+// sortRules sorts the rules of a list converted by ToGeoSite in the SortOrder,
+// which are in the full-before-suffix order already.
+func (l *ListInfo) sortRules(rules []*router.Domain) {
+	switch SortOrder {
+	case SortSourceOrder:
+		position := make(map[*router.Domain]int, len(l.sourceOrder))
+		for i, rule := range l.sourceOrder {
+			if _, ok := position[rule]; !ok {
+				position[rule] = i
+			}
+		}
+		sort.SliceStable(rules, func(i, j int) bool {
+			pi, iok := position[rules[i]]
+			pj, jok := position[rules[j]]
+			return iok && (!jok || pi < pj)
+		})
+
+	case SortAlphabetical:
+		sort.SliceStable(rules, func(i, j int) bool {
+			if di, dj := sortDomain(rules[i]), sortDomain(rules[j]); di != dj {
+				return di < dj
+			}
+			return rules[i].Type > rules[j].Type
+		})
+
+	case SortLabelCount:
+		sort.SliceStable(rules, func(i, j int) bool {
+			di, dj := sortDomain(rules[i]), sortDomain(rules[j])
+			if ci, cj := strings.Count(di, "."), strings.Count(dj, "."); ci != cj {
+				return ci < cj
+			}
+			return di < dj
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// Overlap is a domain matched by two lists that should not overlap.
+type Overlap struct {
+	Domain string `json:"domain"`
+	// Reason is why the lists conflict, "lists" or "policies"
+	Reason string `json:"reason"`
+	// Lists and Rules are the names of the two lists and their matching rules
+	Lists [2]string `json:"lists"`
+	Rules [2]string `json:"rules"`
+	// Policies are the policies of the two rules in policy conflicts
+	Policies []string `json:"policies,omitempty"`
+
+	ruleTypes [2]router.Domain_Type
+}
+
+func (o Overlap) String() string {
+	s := fmt.Sprintf("%s: %s (%s) and %s (%s)", o.Domain, o.Lists[0], o.Rules[0], o.Lists[1], o.Rules[1])
+	if o.Reason == "policies" {
+		s += fmt.Sprintf(" with policies %s and %s", o.Policies[0], o.Policies[1])
+	}
+	return s
+}
+
+// ParseConflictLists parses the -conflictlists option into pairs of list names,
+// eg: `cn:geolocation-!cn,private:geolocation-!cn`.
+func ParseConflictLists(conflictLists string) [][2]FileName {
+	var pairs [][2]FileName
+	for _, pair := range strings.Split(conflictLists, ",") {
+		names := strings.Split(strings.TrimSpace(pair), ":")
+		if len(names) != 2 {
+			continue
+		}
+		pairs = append(pairs, [2]FileName{
+			FileName(strings.ToUpper(strings.TrimSpace(names[0]))),
+			FileName(strings.ToUpper(strings.TrimSpace(names[1]))),
+		})
+	}
+	return pairs
+}
+
+// Overlaps reports the domains matched by both lists of each conflicting pair,
+// and by two exported lists with different policies for the matching rules.
+// Only full and domain type rules are compared, using the rules of
+// router.GeoSite, so the lists must have been converted by ToProto.
+func (lm *ListInfoMap) Overlaps(conflictPairs [][2]FileName, exportLists []string) []Overlap {
+	var overlaps []Overlap
+	for _, pair := range conflictPairs {
+		a, b := (*lm)[pair[0]], (*lm)[pair[1]]
+		if a == nil || b == nil {
+			Logf(LevelNotice, "%s: no such lists to check for overlaps in the directory, skipped.", strings.ToLower(string(pair[0])+":"+string(pair[1])))
+			continue
+		}
+		for _, overlap := range overlapRules(a, b) {
+			overlap.Reason = "lists"
+			overlaps = append(overlaps, overlap)
+		}
+	}
+
+	var policyLists []*ListInfo
+	seen := make(map[FileName]bool)
+	for _, name := range exportLists {
+		listinfo := (*lm)[FileName(strings.ToUpper(name))]
+		if listinfo == nil || len(listinfo.Policy) == 0 || seen[listinfo.Name] {
+			continue
+		}
+		seen[listinfo.Name] = true
+		policyLists = append(policyLists, listinfo)
+	}
+	for i, a := range policyLists {
+		for _, b := range policyLists[i+1:] {
+			for _, overlap := range overlapRules(a, b) {
+				policyA, policyB := a.Policy.For(overlap.ruleTypes[0]), b.Policy.For(overlap.ruleTypes[1])
+				if policyA == "" || policyB == "" || policyA == policyB {
+					continue
+				}
+				overlap.Reason = "policies"
+				overlap.Policies = []string{policyA, policyB}
+				overlaps = append(overlaps, overlap)
+			}
+		}
+	}
+
+	sort.SliceStable(overlaps, func(i, j int) bool {
+		if overlaps[i].Lists != overlaps[j].Lists {
+			return overlaps[i].Lists[0]+":"+overlaps[i].Lists[1] < overlaps[j].Lists[0]+":"+overlaps[j].Lists[1]
+		}
+		return overlaps[i].Domain < overlaps[j].Domain
+	})
+	return overlaps
+}
+
+// overlapRules returns the domains of the rules of each list matched by the other list
+func overlapRules(a, b *ListInfo) []Overlap {
+	names := [2]string{strings.ToLower(string(a.Name)), strings.ToLower(string(b.Name))}
+	found := make(map[string]bool)
+	var overlaps []Overlap
+	for i, lists := range [2][2]*ListInfo{{a, b}, {b, a}} {
+		matcher := newRuleMatcher(lists[1].GeoSite.Domain)
+		for _, rule := range lists[0].GeoSite.Domain {
+			other := matcher.Match(rule)
+			if other == nil || found[rule.Value] {
+				continue
+			}
+			found[rule.Value] = true
+			rules := [2]*router.Domain{rule, other}
+			if i == 1 {
+				rules[0], rules[1] = rules[1], rules[0]
+			}
+			overlaps = append(overlaps, Overlap{
+				Domain:    rule.Value,
+				Lists:     names,
+				Rules:     [2]string{RuleString(rules[0]), RuleString(rules[1])},
+				ruleTypes: [2]router.Domain_Type{rules[0].Type, rules[1].Type},
+			})
+		}
+	}
+	return overlaps
+}
+
+// ruleMatcher looks up the full and domain type rules of a list matching a domain.
+type ruleMatcher struct {
+	full   map[string]*router.Domain
+	domain map[string]*router.Domain
+}
+
+func newRuleMatcher(rules []*router.Domain) *ruleMatcher {
+	m := &ruleMatcher{full: make(map[string]*router.Domain), domain: make(map[string]*router.Domain)}
+	for _, rule := range rules {
+		switch rule.Type {
+		case router.Domain_Full:
+			m.full[rule.Value] = rule
+		case router.Domain_RootDomain:
+			m.domain[rule.Value] = rule
+		}
+	}
+	return m
+}
+
+// Match returns a rule matching all domains matched by a full or domain type
+// rule, ie: a full rule of the same domain, or a domain rule of it or its parents.
+func (m *ruleMatcher) Match(rule *router.Domain) *router.Domain {
+	if rule.Type != router.Domain_Full && rule.Type != router.Domain_RootDomain {
+		return nil
+	}
+	if other := m.full[rule.Value]; rule.Type == router.Domain_Full && other != nil {
+		return other
+	}
+	for domain := rule.Value; domain != ""; domain = nextParentDomain(domain) {
+		if other := m.domain[domain]; other != nil {
+			return other
+		}
+	}
+	return nil
+}
+
+// GenerateOverlapReport writes overlap.txt and overlap.json into dir.
+func GenerateOverlapReport(dir string, overlaps []Overlap) error {
+	if err := MkdirAll(dir); err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %d overlaps found\n", len(overlaps))
+	for _, overlap := range overlaps {
+		sb.WriteString(overlap.String() + "\n")
+	}
+	if err := WriteFile(filepath.Join(dir, "overlap.txt"), []byte(sb.String())); err != nil {
+		return err
+	}
+
+	if overlaps == nil {
+		overlaps = []Overlap{}
+	}
+	jsonBytes, err := json.MarshalIndent(overlaps, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(filepath.Join(dir, "overlap.json"), jsonBytes); err != nil {
+		return err
+	}
+	Logf(slog.LevelInfo, "Overlap report of %d overlaps has been generated successfully in '%s'.", len(overlaps), dir)
+	return nil
+}
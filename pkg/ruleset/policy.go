@@ -0,0 +1,189 @@
+package ruleset
+
+import (
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ListPolicy maps rule types of a list to the policy used in the
+// Quantumult X, Surge, Stash and V2Ray outputs, and the sing-box route. Rule types are the ones of the data
+// syntax: "full", "domain", "keyword", "regexp", and "*" for the default.
+type ListPolicy map[string]string
+
+// surgePolicies maps policies to their Surge flavors
+var surgePolicies = map[string]string{
+	"direct":         "DIRECT",
+	"reject":         "REJECT",
+	"reject-drop":    "REJECT-DROP",
+	"reject-no-drop": "REJECT-NO-DROP",
+	"reject-img":     "REJECT-TINYGIF",
+	"reject-tinygif": "REJECT-TINYGIF",
+	// Surge has no dedicated flavors of the ones below
+	"reject-dict":  "REJECT",
+	"reject-array": "REJECT",
+	"reject-200":   "REJECT",
+	"reject-video": "REJECT",
+}
+
+// quantumultXPolicies maps policies to their Quantumult X flavors
+var quantumultXPolicies = map[string]string{
+	"reject-tinygif": "reject-img",
+	// Quantumult X has no dedicated flavors of the ones below
+	"reject-drop":    "reject",
+	"reject-no-drop": "reject",
+}
+
+// stashPolicies maps policies to their Stash flavors, the proxy policy being the
+// conventional name of the proxy group
+var stashPolicies = map[string]string{
+	"direct":         "DIRECT",
+	"proxy":          "PROXY",
+	"reject":         "REJECT",
+	"reject-drop":    "REJECT-DROP",
+	"reject-no-drop": "REJECT-NO-DROP",
+	"reject-img":     "REJECT-TINYGIF",
+	"reject-tinygif": "REJECT-TINYGIF",
+	// Stash has no dedicated flavors of the ones below
+	"reject-dict":  "REJECT",
+	"reject-array": "REJECT",
+	"reject-200":   "REJECT",
+	"reject-video": "REJECT",
+}
+
+// v2rayOutbounds maps policies to the conventional tags of the outbounds of V2Ray configs
+var v2rayOutbounds = map[string]string{
+	"reject":         "block",
+	"reject-drop":    "block",
+	"reject-no-drop": "block",
+	"reject-img":     "block",
+	"reject-tinygif": "block",
+	"reject-dict":    "block",
+	"reject-array":   "block",
+	"reject-200":     "block",
+	"reject-video":   "block",
+}
+
+// ParseListPolicies parses the -listpolicy option into a map of file names
+// and their ListPolicy, eg: `category-ads-all@full=reject-img@domain=reject-dict,cn@*=direct`.
+func ParseListPolicies(listPolicies string) map[FileName]ListPolicy {
+	policiesInFile := make(map[FileName]ListPolicy)
+	if listPolicies == "" {
+		return policiesInFile
+	}
+	for _, filenamePolicies := range strings.Split(listPolicies, ",") {
+		filenamePolicySlice := strings.Split(strings.TrimSpace(filenamePolicies), "@")
+		filename := FileName(strings.ToUpper(strings.TrimSpace(filenamePolicySlice[0])))
+		if policiesInFile[filename] == nil {
+			policiesInFile[filename] = make(ListPolicy)
+		}
+		for _, typePolicy := range filenamePolicySlice[1:] {
+			kv := strings.SplitN(typePolicy, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			ruleType := strings.ToLower(strings.TrimSpace(kv[0]))
+			if policy := strings.ToLower(strings.TrimSpace(kv[1])); policy != "" {
+				policiesInFile[filename][ruleType] = policy
+			}
+		}
+	}
+	return policiesInFile
+}
+
+// For returns the policy of the rule type, or "" if not configured.
+func (p ListPolicy) For(ruleType router.Domain_Type) string {
+	if policy := p[RuleTypeName(ruleType)]; policy != "" {
+		return policy
+	}
+	return p["*"]
+}
+
+// RuleTypeName returns the name of the rule type in the data syntax, eg: "full"
+func RuleTypeName(ruleType router.Domain_Type) string {
+	switch ruleType {
+	case router.Domain_Full:
+		return "full"
+	case router.Domain_RootDomain:
+		return "domain"
+	case router.Domain_Plain:
+		return "keyword"
+	case router.Domain_Regex:
+		return "regexp"
+	}
+	return ""
+}
+
+// surgePolicy returns the Surge flavor of the policy
+func surgePolicy(policy string) string {
+	if surge, ok := surgePolicies[policy]; ok {
+		return surge
+	}
+	return policy
+}
+
+// stashPolicy returns the Stash flavor of the policy
+func stashPolicy(policy string) string {
+	if stash, ok := stashPolicies[policy]; ok {
+		return stash
+	}
+	return policy
+}
+
+// v2rayOutbound returns the tag of the V2Ray outbound of the policy
+func v2rayOutbound(policy string) string {
+	if outbound, ok := v2rayOutbounds[policy]; ok {
+		return outbound
+	}
+	return policy
+}
+
+// singBoxAction returns the action of a sing-box route rule of the policy, and
+// the method of the reject action or the outbound of the route action
+func singBoxAction(policy string) (action, methodOrOutbound string) {
+	switch {
+	case policy == "reject-drop":
+		return "reject", "drop"
+	case policy == "reject" || strings.HasPrefix(policy, "reject-"):
+		return "reject", ""
+	}
+	return "route", policy
+}
+
+// defaultPolicy returns the policy of the lists without a configured one,
+// by the list name
+func defaultPolicy(name FileName) string {
+	switch name {
+	case "PRIVATE", "CN", "TLD-CN", "GEOLOCATION-CN", "BILIBILI":
+		return "direct"
+	}
+	return "proxy"
+}
+
+// defaultPolicy returns the default policy of the list by its name, or by the
+// name of the list a chunk is split from
+func (l *ListInfo) defaultPolicy() string {
+	if l.Chunk > 0 {
+		return defaultPolicy(l.Parent)
+	}
+	return defaultPolicy(l.Name)
+}
+
+// rulePolicy returns the policy of the rule by its `@policy=` attribute, or
+// the policy of the list for the rule type, or "" if not configured.
+func (l *ListInfo) rulePolicy(rule *router.Domain) string {
+	for _, attr := range rule.GetAttribute() {
+		if name, value := attributeNameValue(attr); name == "policy" && value != "" {
+			return value
+		}
+	}
+	return l.Policy.For(rule.Type)
+}
+
+// quantumultXPolicy returns the Quantumult X flavor of the policy
+func quantumultXPolicy(policy string) string {
+	if qx, ok := quantumultXPolicies[policy]; ok {
+		return qx
+	}
+	return policy
+}
@@ -0,0 +1,116 @@
+package ruleset
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// RuleOrigin is where a rule of a list comes from: the data file or the
+// remote list and the line of the rule, and the include rules of the lists it
+// is included through, from the list down, eg: `include:google @cn`.
+type RuleOrigin struct {
+	File string   `json:"file"`
+	Line int      `json:"line"`
+	Via  []string `json:"via,omitempty"`
+}
+
+// String returns the origin like `data/google:123 via include:google @cn`
+func (o RuleOrigin) String() string {
+	origin := o.File
+	if o.Line > 0 {
+		origin += ":" + strconv.Itoa(o.Line)
+	}
+	if len(o.Via) > 0 {
+		origin += " via " + strings.Join(o.Via, ", ")
+	}
+	return origin
+}
+
+// SourceMapEntry is a rule of a list with its origin, in the source maps
+type SourceMapEntry struct {
+	Rule string `json:"rule"`
+	RuleOrigin
+}
+
+// recordOrigin records the origin of the line being processed as the origin
+// of a rule, with TrackOrigins.
+func (l *ListInfo) recordOrigin(rule *router.Domain) {
+	if !TrackOrigins {
+		return
+	}
+	if l.origins == nil {
+		l.origins = make(map[*router.Domain]RuleOrigin)
+	}
+	if _, ok := l.origins[rule]; !ok {
+		l.origins[rule] = l.origin
+	}
+}
+
+// includeOrigins records the origins of the rules of an included list, through
+// the include rule of the list if not empty, keeping the ones recorded first.
+func (l *ListInfo) includeOrigins(included *ListInfo, rules []*router.Domain, via string) {
+	if !TrackOrigins || len(included.origins) == 0 {
+		return
+	}
+	if l.origins == nil {
+		l.origins = make(map[*router.Domain]RuleOrigin)
+	}
+	for _, rule := range rules {
+		origin, ok := included.origins[rule]
+		if _, recorded := l.origins[rule]; !ok || recorded {
+			continue
+		}
+		if via != "" {
+			origin.Via = append([]string{via}, origin.Via...)
+		}
+		l.origins[rule] = origin
+	}
+}
+
+// includeRule returns the include rule of a list with the wanted attribute,
+// eg: `include:google @cn`, or `include:google` for all rules.
+func includeRule(filename FileName, attrWanted Attribute) string {
+	rule := "include:" + strings.ToLower(string(filename))
+	if attrWanted != "@" {
+		rule += " " + string(attrWanted)
+	}
+	return rule
+}
+
+// Origin returns the origin of a rule of the list, and whether it is recorded,
+// which it is for the rules of the lists parsed with TrackOrigins.
+func (l *ListInfo) Origin(rule *router.Domain) (RuleOrigin, bool) {
+	origin, ok := l.origins[rule]
+	return origin, ok
+}
+
+// SourceMap returns the rules of the list converted by ToGeoSite with their
+// origins, the ones of unknown origins with empty files.
+func (l *ListInfo) SourceMap() []SourceMapEntry {
+	entries := make([]SourceMapEntry, 0, len(l.GeoSite.GetDomain()))
+	for _, rule := range l.GeoSite.GetDomain() {
+		origin, _ := l.Origin(rule)
+		entries = append(entries, SourceMapEntry{Rule: RuleString(rule), RuleOrigin: origin})
+	}
+	return entries
+}
+
+// WriteAnnotatedList writes the rules of the list converted by ToGeoSite in
+// the data file syntax, each with a comment of its origin, eg:
+//
+//	domain:example.com @cn  # from data/google:123 via include:google @cn
+func (l *ListInfo) WriteAnnotatedList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, entry := range l.SourceMap() {
+		bw.WriteString(entry.Rule)
+		if entry.File != "" {
+			bw.WriteString("  # from " + entry.RuleOrigin.String())
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,284 @@
+package ruleset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DeadDomainChecker finds the domains that no longer exist, answered with
+// NXDOMAIN by every server in every attempt. Timeouts and other errors are
+// inconclusive, so a domain is only reported as dead when all answers agree.
+// Servers are DNS servers like `8.8.8.8`, or DoH endpoints like
+// `https://dns.google/dns-query`.
+type DeadDomainChecker struct {
+	Servers []string
+	// Attempts is the number of times every server is asked
+	Attempts int
+	// Rate is the maximum number of queries per second, unlimited if zero
+	Rate   int
+	Client *http.Client
+}
+
+// NewDeadDomainChecker creates and returns a new DeadDomainChecker.
+func NewDeadDomainChecker(servers []string, attempts, rate int) *DeadDomainChecker {
+	return &DeadDomainChecker{
+		Servers:  servers,
+		Attempts: attempts,
+		Rate:     rate,
+		Client:   &http.Client{Timeout: resolveTimeout},
+	}
+}
+
+// Dead returns the sorted domains answered with NXDOMAIN consistently,
+// querying resolveWorkers domains concurrently.
+func (c *DeadDomainChecker) Dead(domains []string) ([]string, error) {
+	if len(c.Servers) == 0 {
+		return nil, errors.New("no DNS servers to resolve with")
+	}
+
+	// wait blocks until the next query is allowed by the rate limit
+	wait := func() {}
+	if c.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(c.Rate))
+		defer ticker.Stop()
+		wait = func() { <-ticker.C }
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var dead []string
+	for i := 0; i < resolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range jobs {
+				if c.isDead(domain, wait) {
+					mu.Lock()
+					dead = append(dead, domain)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, domain := range domains {
+		jobs <- domain
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Strings(dead)
+	return dead, nil
+}
+
+// isDead reports whether every server answers NXDOMAIN for the domain in every attempt
+func (c *DeadDomainChecker) isDead(domain string, wait func()) bool {
+	for attempt := 0; attempt < max(c.Attempts, 1); attempt++ {
+		for _, server := range c.Servers {
+			wait()
+			rcode, err := c.exchange(server, domain)
+			if err != nil {
+				Logger.Debug("inconclusive DNS answer", "domain", domain, "server", server, "error", err)
+				return false
+			}
+			if rcode != dnsmessage.RCodeNameError {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// exchange queries the A record of the domain from the server and returns the response code
+func (c *DeadDomainChecker) exchange(server, domain string) (dnsmessage.RCode, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(domain, ".") + ".")
+	if err != nil {
+		return 0, err
+	}
+	// The ID of DoH queries is 0 for HTTP caching, see RFC 8484
+	var id uint16
+	if !strings.HasPrefix(server, "https://") {
+		id = uint16(time.Now().UnixNano())
+	}
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return 0, err
+	}
+
+	var answer []byte
+	if strings.HasPrefix(server, "https://") {
+		answer, err = c.exchangeDoH(server, query)
+	} else {
+		answer, err = exchangeUDP(server, query)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(answer)
+	if err != nil {
+		return 0, err
+	}
+	if header.ID != id || !header.Response {
+		return 0, fmt.Errorf("mismatched DNS answer from %s", server)
+	}
+	return header.RCode, nil
+}
+
+// exchangeUDP sends a DNS query to a DNS server over UDP
+func exchangeUDP(server string, query []byte) ([]byte, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, 1232)
+	n, err := conn.Read(answer)
+	if err != nil {
+		return nil, err
+	}
+	return answer[:n], nil
+}
+
+// exchangeDoH sends a DNS query to a DoH endpoint, see RFC 8484
+func (c *DeadDomainChecker) exchangeDoH(url string, query []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query %s: unexpected status %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+}
+
+// DataFileDomains returns the domains of the full and domain rules of a data
+// file, without the rules of included lists, which are checked in their own files.
+func DataFileDomains(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var domains []string
+	for _, rules := range dataFileLineRules(content) {
+		for _, rule := range rules {
+			if (rule.Type == router.Domain_Full || rule.Type == router.Domain_RootDomain) && !seen[rule.Value] {
+				seen[rule.Value] = true
+				domains = append(domains, rule.Value)
+			}
+		}
+	}
+	return domains, nil
+}
+
+// PruneDataFile removes the lines of a data file whose rules are all full or
+// domain rules of the dead domains, keeping the comments and other lines as
+// they are, and returns the number of removed lines.
+func PruneDataFile(path string, dead map[string]bool) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	lineRules := dataFileLineRules(content)
+
+	var sb strings.Builder
+	removed := 0
+	for i, line := range lines {
+		if isDeadLine(lineRules[i], dead) {
+			removed++
+			continue
+		}
+		sb.WriteString(line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, WriteFile(path, []byte(sb.String()))
+}
+
+// isDeadLine reports whether the rules of a line are all full or domain rules of dead domains
+func isDeadLine(rules []*router.Domain, dead map[string]bool) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	for _, rule := range rules {
+		if (rule.Type != router.Domain_Full && rule.Type != router.Domain_RootDomain) || !dead[rule.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// dataFileLineRules returns the rules of each line of a data file, split like
+// strings.SplitAfter, converted from the hosts or Adblock Plus syntax if any.
+// Invalid lines and the lines of other directives have no rules.
+func dataFileLineRules(content []byte) [][]*router.Domain {
+	lines := strings.SplitAfter(string(content), "\n")
+	lineRules := make([][]*router.Domain, len(lines))
+	converter := new(lineConverter)
+	list := NewListInfo()
+	for i, rawLine := range lines {
+		rawLine = strings.TrimRight(rawLine, "\r\n")
+		for _, line := range converter.Convert(rawLine) {
+			line = strings.TrimSpace(removeComment(line))
+			if isEmpty(line) || isDirective(line) {
+				continue
+			}
+			rule, err := list.parseRule(line)
+			if err != nil || rule == nil {
+				continue
+			}
+			lineRules[i] = append(lineRules[i], rule)
+		}
+	}
+	return lineRules
+}
+
+// isDirective reports whether the line is an inclusion, an exclusion or an expansion instead of a rule
+func isDirective(line string) bool {
+	for _, prefix := range []string{"include:", "include-url:", "ext:", "tld:", "exclude:", "!"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
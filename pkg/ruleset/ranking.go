@@ -0,0 +1,119 @@
+package ruleset
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// Ranking is the popularity ranks of domains, like the Tranco list,
+// where 1 is the most popular domain.
+type Ranking map[string]int
+
+// rankTiers are the tiers of popularity counted in stats.json, by their lowest rank
+var rankTiers = []struct {
+	Rank int
+	Name string
+}{{1000, "top1k"}, {10000, "top10k"}, {100000, "top100k"}, {1000000, "top1m"}}
+
+// LiteSuffix is the suffix of the names of the lite variants of lists, eg: `geolocation-!cn-lite`
+const LiteSuffix = "-LITE"
+
+// ParseRanking parses a ranking in the `rank,domain` CSV format of the Tranco
+// list, or a zip archive of it like top-1m.csv.zip.
+func ParseRanking(content []byte) (Ranking, error) {
+	if bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, err
+		}
+		if len(zipReader.File) != 1 {
+			return nil, fmt.Errorf("ranking archive has %d files instead of 1", len(zipReader.File))
+		}
+		f, err := zipReader.File[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if content, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+	}
+
+	ranking := make(Ranking)
+	for idx, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rankString, domain, ok := strings.Cut(line, ",")
+		rank, err := strconv.Atoi(rankString)
+		if !ok || err != nil || rank <= 0 {
+			return nil, fmt.Errorf("ranking line %d: invalid rank and domain: %q", idx+1, line)
+		}
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if current, ok := ranking[domain]; !ok || rank < current {
+			ranking[domain] = rank
+		}
+	}
+	if len(ranking) == 0 {
+		return nil, errors.New("empty ranking")
+	}
+	return ranking, nil
+}
+
+// Rank returns the best rank of the domain or its parent domains, as the
+// Tranco list ranks the registrable domains, or 0 if none is ranked.
+func (r Ranking) Rank(domain string) int {
+	best := 0
+	for ; domain != ""; domain = nextParentDomain(domain) {
+		if rank := r[domain]; rank > 0 && (best == 0 || rank < best) {
+			best = rank
+		}
+	}
+	return best
+}
+
+// RankTier returns the name of the tier of popularity of the rank,
+// eg: "top1k" or "top1m", or "unranked".
+func RankTier(rank int) string {
+	for _, tier := range rankTiers {
+		if rank > 0 && rank <= tier.Rank {
+			return tier.Name
+		}
+	}
+	return "unranked"
+}
+
+// LiteSubList returns a lite variant of the list, named like `GEOLOCATION-!CN-LITE`,
+// with only the full and domain rules of domains ranked within maxRank, for
+// clients that cannot load a huge list.
+func (l *ListInfo) LiteSubList(ranking Ranking, maxRank int) *ListInfo {
+	subList := NewListInfo()
+	subList.Name = l.Name + LiteSuffix
+	subList.Parent = l.Name
+	subList.Policy = l.Policy
+	subList.MihomoBehavior = l.MihomoBehavior
+	subList.GeoSite = &router.GeoSite{CountryCode: string(subList.Name)}
+
+	for _, rule := range l.GeoSite.GetDomain() {
+		if rule.Type != router.Domain_Full && rule.Type != router.Domain_RootDomain {
+			continue
+		}
+		if rank := ranking.Rank(rule.GetValue()); rank > 0 && rank <= maxRank {
+			subList.GeoSite.Domain = append(subList.GeoSite.Domain, rule)
+		}
+	}
+	return subList
+}
+
+// isLite reports whether the list is a lite variant of a list
+func (l *ListInfo) isLite() bool {
+	return l.Parent != "" && l.Name == l.Parent+LiteSuffix
+}
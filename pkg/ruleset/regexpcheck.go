@@ -0,0 +1,111 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ErrInvalidRegexp is returned when a regexp rule cannot be compiled with RE2.
+var ErrInvalidRegexp = errors.New("invalid regexp")
+
+// regexpConstruct is a regexp construct that is valid in RE2 but not
+// supported by the regexp engines of some clients.
+type regexpConstruct struct {
+	pattern     *regexp.Regexp
+	description string
+	formats     []string
+}
+
+var regexpConstructs = []regexpConstruct{
+	{regexp.MustCompile(`\(\?P<`), "named group (?P<name>)", []string{"GFWList", "Surge", "Quantumult X"}},
+	{regexp.MustCompile(`\(\?[imsU]*U[imsU]*[:)]`), "ungreedy flag (?U)", []string{"GFWList", "Surge", "Quantumult X"}},
+	{regexp.MustCompile(`\(\?[imsU]+[:)]`), "inline flags (?flags)", []string{"GFWList"}},
+	{regexp.MustCompile(`\\[Az]`), `text anchor \A or \z`, []string{"GFWList"}},
+	{regexp.MustCompile(`\[\[:\^?[a-z]+:\]\]`), "POSIX class [[:name:]]", []string{"GFWList"}},
+	{regexp.MustCompile(`\\[pP]`), `Unicode class \p or \P`, []string{"GFWList"}},
+	{regexp.MustCompile(`\\Q`), `literal quoting \Q...\E`, []string{"GFWList"}},
+}
+
+// validateRegexp compiles the pattern of a regexp rule with RE2.
+func validateRegexp(pattern string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRegexp, err)
+	}
+	return nil
+}
+
+// regexpCompatibilityWarnings returns the warnings of constructs in the
+// pattern of a regexp rule that some output formats cannot handle.
+func regexpCompatibilityWarnings(pattern string) []string {
+	var warnings []string
+	for _, construct := range regexpConstructs {
+		if construct.pattern.MatchString(pattern) {
+			warnings = append(warnings, fmt.Sprintf("regexp uses %s, which is not supported by %s", construct.description, strings.Join(construct.formats, ", ")))
+		}
+	}
+	return warnings
+}
+
+// regexpDomainPrefixes are the prefixes of regexps matching a domain and its
+// subdomains, the same as a domain type rule
+var regexpDomainPrefixes = []string{`^(.*\.)?`, `^(.+\.)?`, `^([^.]+\.)*`, `(^|\.)`}
+
+// regexpLiteralDomain matches the escaped domain in a regexp, eg: `example\.com`
+var regexpLiteralDomain = regexp.MustCompile(`^[a-z0-9-]+(\\\.[a-z0-9-]+)*$`)
+
+// regexpEquivalentRule returns the full or domain type rule matching the
+// same domains as the pattern of a regexp rule, or nil if there is none,
+// eg: `^example\.com$` is `full:example.com`, and `(^|\.)example\.com$`
+// is `domain:example.com`.
+func regexpEquivalentRule(pattern string) *router.Domain {
+	if !strings.HasSuffix(pattern, "$") {
+		return nil
+	}
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	ruleType := router.Domain_Full
+	trimmed := strings.TrimPrefix(pattern, "^")
+	for _, prefix := range regexpDomainPrefixes {
+		if strings.HasPrefix(pattern, prefix) {
+			ruleType, trimmed = router.Domain_RootDomain, strings.TrimPrefix(pattern, prefix)
+			break
+		}
+	}
+	if ruleType == router.Domain_Full && trimmed == pattern {
+		return nil
+	}
+	if !regexpLiteralDomain.MatchString(trimmed) {
+		return nil
+	}
+	return &router.Domain{Type: ruleType, Value: strings.ReplaceAll(trimmed, `\.`, ".")}
+}
+
+// regexpSuffixPrefixes are the prefixes of regexps matching the subdomains of a domain
+var regexpSuffixPrefixes = []string{`^.*\.`, `^.+\.`, `.*\.`, `.+\.`, `\.`}
+
+// simplifyRegexp returns the full or domain type rule that the pattern
+// of a regexp rule can be rewritten into, or nil if there is none.
+// Besides the equivalent rules of regexpEquivalentRule, a regexp matching the
+// subdomains of a domain, eg: `^.*\.example\.com$`, becomes a domain type rule
+// also matching the domain itself. Unanchored literals, eg: `.*google.*`, are
+// kept as regexps, as keyword type rules are dropped from the outputs too.
+func simplifyRegexp(pattern string) *router.Domain {
+	if rule := regexpEquivalentRule(pattern); rule != nil {
+		return rule
+	}
+	if !strings.HasSuffix(pattern, "$") {
+		return nil
+	}
+
+	trimmed := strings.TrimSuffix(pattern, "$")
+	for _, prefix := range regexpSuffixPrefixes {
+		if domain := strings.TrimPrefix(trimmed, prefix); domain != trimmed && regexpLiteralDomain.MatchString(domain) {
+			return &router.Domain{Type: router.Domain_RootDomain, Value: strings.ReplaceAll(domain, `\.`, ".")}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ruleset
+
+import (
+	"net/http"
+	"sync"
+)
+
+// remoteLists is the cache of remote domain lists used by `include-url` rules.
+var remoteLists = NewRemoteListCache(http.DefaultClient, nil)
+
+// RemoteListCache downloads the remote domain lists of `include-url` rules.
+// Each list is downloaded only once per run, and saved as a snapshot
+// so that it can also be used in offline mode.
+type RemoteListCache struct {
+	Client    *http.Client
+	Snapshots *SnapshotStore
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// NewRemoteListCache creates and returns a new RemoteListCache.
+func NewRemoteListCache(client *http.Client, snapshots *SnapshotStore) *RemoteListCache {
+	return &RemoteListCache{
+		Client:    client,
+		Snapshots: snapshots,
+		cache:     make(map[string][]byte),
+	}
+}
+
+// Get returns the content of a remote domain list.
+func (c *RemoteListCache) Get(url string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if body, ok := c.cache[url]; ok {
+		return body, nil
+	}
+
+	var body []byte
+	var err error
+	if c.Snapshots != nil {
+		body, err = c.Snapshots.Fetch(c.Client, url)
+	} else {
+		body, err = FetchURL(c.Client, url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Snapshots != nil {
+		if err := c.Snapshots.Save(url, body); err != nil {
+			return nil, err
+		}
+	}
+
+	c.cache[url] = body
+	return body, nil
+}
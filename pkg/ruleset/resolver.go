@@ -0,0 +1,218 @@
+package ruleset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	resolveWorkers = 16
+	resolveTimeout = 5 * time.Second
+	// WidenedIPv4Bits and WidenedIPv6Bits are the prefix lengths of the
+	// networks the resolved IPs are widened to with Widen
+	WidenedIPv4Bits = 24
+	WidenedIPv6Bits = 48
+)
+
+// DNSResolver resolves the domains of a list from several DNS servers
+// and remembers every observed IP for a persistence window, so that
+// short-lived DNS answers still end up in the generated IP set.
+// The result is heuristic by nature and never as complete as published CIDRs.
+type DNSResolver struct {
+	Servers   []string
+	StatePath string
+	Window    time.Duration
+	// Offline skips DNS lookups and uses the persisted IPs as they are
+	Offline bool
+	// ReadOnly reads the persisted IPs without saving the new ones, for dry runs
+	ReadOnly bool
+	// Widen widens the resolved IPs to their /24 and /48 networks, which may
+	// include the addresses of other hosts, instead of the exact /32 and /128
+	Widen bool
+
+	// state maps list name to observed IP and the unix time it was last seen
+	state map[string]map[string]int64
+}
+
+// NewDNSResolver creates and returns a new DNS resolver.
+func NewDNSResolver(servers []string, statePath string, window time.Duration) *DNSResolver {
+	return &DNSResolver{
+		Servers:   servers,
+		StatePath: statePath,
+		Window:    window,
+	}
+}
+
+// Resolve resolves the domains from all servers, merges the answers with
+// the ones still inside the persistence window, and returns them
+// aggregated into CIDRs.
+func (r *DNSResolver) Resolve(name string, domains []string) ([]string, error) {
+	if err := r.loadState(); err != nil {
+		return nil, err
+	}
+
+	seen := r.state[name]
+	if r.Offline {
+		ips := make([]net.IP, 0, len(seen))
+		for ipString := range seen {
+			ips = append(ips, net.ParseIP(ipString))
+		}
+		return r.aggregateIPs(ips), nil
+	}
+
+	if len(r.Servers) == 0 {
+		return nil, errors.New("no DNS servers to resolve with")
+	}
+
+	now := time.Now()
+	if seen == nil {
+		seen = make(map[string]int64)
+		r.state[name] = seen
+	}
+	for _, ip := range r.lookupAll(domains) {
+		seen[ip.String()] = now.Unix()
+	}
+
+	cutoff := now.Add(-r.Window).Unix()
+	var ips []net.IP
+	for ipString, lastSeen := range seen {
+		if lastSeen < cutoff {
+			delete(seen, ipString)
+			continue
+		}
+		ips = append(ips, net.ParseIP(ipString))
+	}
+
+	if err := r.saveState(); err != nil {
+		return nil, err
+	}
+
+	return r.aggregateIPs(ips), nil
+}
+
+// lookupAll queries every domain against every server concurrently
+func (r *DNSResolver) lookupAll(domains []string) []net.IP {
+	type job struct {
+		server string
+		domain string
+	}
+
+	jobs := make(chan job)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var result []net.IP
+
+	for i := 0; i < resolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				ips, err := lookupIP(j.server, j.domain)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				result = append(result, ips...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, server := range r.Servers {
+		for _, domain := range domains {
+			jobs <- job{server: server, domain: domain}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result
+}
+
+// lookupIP resolves a domain with the given DNS server
+func lookupIP(server, domain string) ([]net.IP, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return resolver.LookupIP(ctx, "ip", domain)
+}
+
+// aggregateIPs returns the CIDRs of the exact IPs, or of their covering
+// networks with Widen
+func (r *DNSResolver) aggregateIPs(ips []net.IP) []string {
+	ipv4Bits, ipv6Bits := 32, 128
+	if r.Widen {
+		ipv4Bits, ipv6Bits = WidenedIPv4Bits, WidenedIPv6Bits
+	}
+	cidrMap := make(map[string]bool)
+	for _, ip := range ips {
+		if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+			continue
+		}
+		var ipNet net.IPNet
+		if ip4 := ip.To4(); ip4 != nil {
+			ipNet = net.IPNet{IP: ip4, Mask: net.CIDRMask(ipv4Bits, 32)}
+		} else {
+			ipNet = net.IPNet{IP: ip, Mask: net.CIDRMask(ipv6Bits, 128)}
+		}
+		ipNet.IP = ipNet.IP.Mask(ipNet.Mask)
+		cidrMap[ipNet.String()] = true
+	}
+
+	cidrs := make([]string, 0, len(cidrMap))
+	for cidr := range cidrMap {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+func (r *DNSResolver) loadState() error {
+	if r.state != nil {
+		return nil
+	}
+	r.state = make(map[string]map[string]int64)
+	if r.StatePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &r.state); err != nil {
+		return fmt.Errorf("invalid resolve state %s: %w", r.StatePath, err)
+	}
+	return nil
+}
+
+func (r *DNSResolver) saveState() error {
+	if r.StatePath == "" || r.ReadOnly {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(r.StatePath, data)
+}
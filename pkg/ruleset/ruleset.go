@@ -0,0 +1,80 @@
+// Package ruleset parses the domain lists of data directories in the syntax of
+// v2fly/domain-list-community, flattens their inclusions, and converts them into
+// geosite.dat and the rule sets of proxy clients, along with the IP sets.
+//
+// A typical use is:
+//
+//	lists, err := ruleset.Parse(ruleset.OverlayDataSources("./data"), ruleset.ConflictError)
+//	if err != nil {
+//		return err
+//	}
+//	if err := lists.Flatten(); err != nil {
+//		return err
+//	}
+//	geositeList := lists.ToProto(nil, nil)
+//	surgeList, err := lists["CN"].Export("surge")
+//
+// ToProto must be called before exporting lists in client formats,
+// as they are converted from the rules of the generated geosite entries.
+// Output formats other than the built-in ones can be added by implementing
+// Exporter and registering it with RegisterExporter.
+package ruleset
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// Options of parsing the data directories, set by the command line flags of the
+// program and shared by all lists.
+var (
+	// Lenient skips invalid regexp rules with a warning instead of failing.
+	Lenient bool
+	// KeepGoing skips the lists with errors, and the lists including them,
+	// instead of failing at the first error, with all errors of all data files
+	// returned in a *SkippedListsError.
+	KeepGoing bool
+	// SimplifyRegexps rewrites regexp rules that are effectively full or
+	// domain matches into full or domain rules.
+	SimplifyRegexps bool
+	// DomainCheck is the mode of validating full and domain rules,
+	// DomainCheckOff, DomainCheckReport or DomainCheckStrict.
+	DomainCheck = DomainCheckOff
+	// DatName is the name of the generated dat file, referenced by the V2Ray
+	// routing rules as `ext:<name>:<list>` if it is not geosite.dat.
+	DatName = "geosite.dat"
+	// TLDListURL is the URL of the IANA list of top-level domains expanded by `tld` rules.
+	TLDListURL = "https://data.iana.org/TLD/tlds-alpha-by-domain.txt"
+	// SortOrder is the order of the rules of the generated lists, in all
+	// formats: SortFullBeforeSuffix, SortSourceOrder, SortAlphabetical or
+	// SortLabelCount.
+	SortOrder = SortFullBeforeSuffix
+	// TrackOrigins records the data file and the line of each rule, and the
+	// lists it is included through, returned by ListInfo.Origin.
+	TrackOrigins bool
+)
+
+// SetRemoteSources sets the HTTP client and the snapshot store of downloading
+// the lists of `include-url`, `ext` and `tld` rules, dropping the cached ones,
+// so that they are downloaded again by the next parsing.
+func SetRemoteSources(client *http.Client, snapshots *SnapshotStore) {
+	remoteLists = NewRemoteListCache(client, snapshots)
+	extDats = &extDatCache{dats: make(map[string]*router.GeoSiteList)}
+}
+
+// Export converts the list into an output format of the name or the file
+// extension, eg: "surge" or "list". The list must have been converted by ToGeoSite.
+func (l *ListInfo) Export(format string) ([]byte, error) {
+	exporter := FindExporter(format)
+	if exporter == nil {
+		return nil, errors.New("unknown export format: " + format)
+	}
+	var buf bytes.Buffer
+	if err := exporter.Write(&buf, l); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
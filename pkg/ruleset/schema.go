@@ -0,0 +1,68 @@
+package ruleset
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Output schema versions.
+//
+// The schema version describes the layout of the publish directory and the
+// header comments of the generated files. Deprecation policy:
+//  1. A new schema version is introduced whenever an existing output file is
+//     renamed, removed, or changes its layout in an incompatible way.
+//     Adding new output files does not bump the schema version.
+//  2. The previous schema version keeps being generated on request with the
+//     -schema option and is marked as deprecated, which prints a warning.
+//  3. A deprecated schema version is removed no earlier than 90 days after
+//     it has been deprecated, after which requesting it is an error.
+const (
+	// SchemaV1 is the legacy layout without schema headers and manifest.json
+	SchemaV1 = 1
+	// SchemaV2 adds the "Schema Version" header and manifest.json
+	SchemaV2 = 2
+
+	CurrentSchemaVersion = SchemaV2
+)
+
+// deprecatedSchemas maps deprecated schema versions to the date they were deprecated
+var deprecatedSchemas = map[int]string{
+	SchemaV1: "2026-10-16",
+}
+
+// SchemaVersion is the output schema version of the headers of generated files.
+var SchemaVersion = CurrentSchemaVersion
+
+// CheckSchemaVersion checks the requested output schema version
+// and warns if it is deprecated.
+func CheckSchemaVersion(version int) error {
+	if version == CurrentSchemaVersion {
+		return nil
+	}
+	if deprecatedAt, ok := deprecatedSchemas[version]; ok {
+		Logf(slog.LevelWarn, "output schema version %d is deprecated since %s and will be removed, please upgrade to version %d.", version, deprecatedAt, CurrentSchemaVersion)
+		return nil
+	}
+	return fmt.Errorf("unsupported output schema version: %d", version)
+}
+
+// SchemaHeader returns the schema version header comment line
+// of generated text files, using the comment prefix of the format.
+func SchemaHeader(comment string) string {
+	if SchemaVersion < SchemaV2 {
+		return ""
+	}
+	return fmt.Sprintf("%s Schema Version: %d\n", comment, SchemaVersion)
+}
+
+// LastModifiedHeader returns the Last Modified header comment line of generated
+// text files, using the comment prefix and the time layout of the format, in the
+// location if not nil, unless HeaderLocation and HeaderTimeLayout are set. It
+// returns empty if TimeNow is nil in reproducible mode.
+func LastModifiedHeader(comment string, loc *time.Location, layout string) string {
+	if TimeNow == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s Last Modified: %s\n", comment, lastModified(loc, layout))
+}
@@ -0,0 +1,117 @@
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// SingBoxRouteName is the name of the file of the sing-box route referencing
+// the rule sets of the exported lists
+const SingBoxRouteName = "singbox-route.json"
+
+// SingBoxVersion is the version of the sing-box source rule sets, 1 for the
+// sing-box releases before 1.10, 2, or 3 for 1.11 and later. Version 1 rule
+// sets match the domain rules with a `domain_suffix` of `.example.com`,
+// which does not match `example.com` itself, and the domain in `domain`, while
+// the later versions match both with a `domain_suffix` of `example.com`.
+var SingBoxVersion = 2
+
+// CheckSingBoxVersion checks the version of the -singboxversion option.
+func CheckSingBoxVersion(version int) error {
+	if version < 1 || version > 3 {
+		return fmt.Errorf("unsupported sing-box rule set version: %d, want 1, 2 or 3", version)
+	}
+	return nil
+}
+
+// SingBoxDomainSuffix returns the `domain_suffix` value of a domain rule in
+// the SingBoxVersion, and whether the domain is in `domain` as well.
+func SingBoxDomainSuffix(domain string) (string, bool) {
+	if SingBoxVersion == 1 {
+		return "." + domain, true
+	}
+	return domain, false
+}
+
+// CompileSingBoxRuleSet compiles a sing-box source rule set in JSON format
+// into the binary .srs format next to it, by running the sing-box binary.
+func CompileSingBoxRuleSet(singboxPath, jsonPath string) (string, error) {
+	srsPath := strings.TrimSuffix(jsonPath, ".json") + ".srs"
+	cmd := exec.Command(singboxPath, "rule-set", "compile", "--output", srsPath, jsonPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("compile %s: %w: %s", jsonPath, err, strings.TrimSpace(string(output)))
+	}
+	return srsPath, nil
+}
+
+// SingBoxRoute returns the route of a sing-box config, with the rule sets of
+// the lists in the singbox format and a rule sending each of them to the
+// outbound of the policy of its domain rules, the rejected lists first. The rule
+// sets are downloaded from baseURL, or read from the directory of the config if
+// baseURL is empty, at the paths returned by fileName of the lowercase names of
+// the lists, eg: `cn.json`. The rules have the actions of sing-box 1.11 and
+// later with the SingBoxVersion 3, or the legacy outbounds otherwise, the
+// rejected lists being sent to the `block` outbound.
+func SingBoxRoute(lists []*ListInfo, baseURL string, fileName func(name string) string) ([]byte, error) {
+	type RuleSet struct {
+		Tag    string `json:"tag"`
+		Type   string `json:"type"`
+		Format string `json:"format"`
+		URL    string `json:"url,omitempty"`
+		Path   string `json:"path,omitempty"`
+	}
+
+	type Rule struct {
+		RuleSet  string `json:"rule_set"`
+		Action   string `json:"action,omitempty"`
+		Outbound string `json:"outbound,omitempty"`
+		Method   string `json:"method,omitempty"`
+		rejected bool
+	}
+
+	type Route struct {
+		RuleSet []RuleSet `json:"rule_set"`
+		Rules   []Rule    `json:"rules"`
+	}
+
+	route := Route{RuleSet: make([]RuleSet, 0, len(lists)), Rules: make([]Rule, 0, len(lists))}
+	for _, l := range lists {
+		name := strings.ToLower(string(l.Name))
+		file := fileName(name)
+		ruleSet := RuleSet{Tag: "geosite-" + name, Type: "remote", Format: "source", URL: baseURL + file}
+		if baseURL == "" {
+			ruleSet.Type, ruleSet.URL, ruleSet.Path = "local", "", file
+		}
+		route.RuleSet = append(route.RuleSet, ruleSet)
+
+		// Rule sets have a single policy, the one of the domain rules
+		policy := l.defaultPolicy()
+		if configured := l.Policy.For(router.Domain_RootDomain); configured != "" {
+			policy = configured
+		}
+		rule := Rule{RuleSet: ruleSet.Tag}
+		action, methodOrOutbound := singBoxAction(policy)
+		switch {
+		case SingBoxVersion < 3 && action == "reject":
+			rule.Outbound, rule.rejected = "block", true
+		case SingBoxVersion < 3:
+			rule.Outbound = methodOrOutbound
+		case action == "reject":
+			rule.Action, rule.Method, rule.rejected = action, methodOrOutbound, true
+		default:
+			rule.Action, rule.Outbound = action, methodOrOutbound
+		}
+		route.Rules = append(route.Rules, rule)
+	}
+	// Rejecting comes first, eg: for the ads domains of lists sent to other outbounds
+	sort.SliceStable(route.Rules, func(i, j int) bool {
+		return route.Rules[i].rejected && !route.Rules[j].rejected
+	})
+
+	return json.MarshalIndent(map[string]Route{"route": route}, "", "  ")
+}
@@ -0,0 +1,50 @@
+package ruleset
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSingBoxRoute(t *testing.T) {
+	cn, ads := NewListInfo(), NewListInfo()
+	cn.Name, ads.Name = "CN", "CATEGORY-ADS"
+	ads.Policy = ListPolicy{"domain": "reject-drop"}
+	version := SingBoxVersion
+	t.Cleanup(func() { SingBoxVersion = version })
+
+	for _, tt := range []struct {
+		version int
+		rules   []map[string]string
+	}{
+		{1, []map[string]string{
+			{"rule_set": "geosite-category-ads", "outbound": "block"},
+			{"rule_set": "geosite-cn", "outbound": "direct"},
+		}},
+		{2, []map[string]string{
+			{"rule_set": "geosite-category-ads", "outbound": "block"},
+			{"rule_set": "geosite-cn", "outbound": "direct"},
+		}},
+		{3, []map[string]string{
+			{"rule_set": "geosite-category-ads", "action": "reject", "method": "drop"},
+			{"rule_set": "geosite-cn", "action": "route", "outbound": "direct"},
+		}},
+	} {
+		SingBoxVersion = tt.version
+		content, err := SingBoxRoute([]*ListInfo{cn, ads}, "", func(name string) string { return name + ".json" })
+		if err != nil {
+			t.Fatal(err)
+		}
+		var route struct {
+			Route struct {
+				Rules []map[string]string `json:"rules"`
+			} `json:"route"`
+		}
+		if err := json.Unmarshal(content, &route); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(route.Route.Rules, tt.rules) {
+			t.Errorf("version %d: rules %v, want %v", tt.version, route.Route.Rules, tt.rules)
+		}
+	}
+}
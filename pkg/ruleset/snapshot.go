@@ -0,0 +1,119 @@
+package ruleset
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var snapshotNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SnapshotStore keeps last-known-good copies of remote sources on disk.
+// Snapshots are written after a successful online run, and read instead
+// of the network in offline mode for reproducible or air-gapped builds.
+type SnapshotStore struct {
+	Dir     string
+	Offline bool
+	// ReadOnly reads the snapshots without writing new ones, for dry runs
+	ReadOnly bool
+
+	mu    sync.Mutex
+	stale map[string]StaleSource
+}
+
+// StaleSource records a remote source that failed to fetch
+// and was replaced by its last-known-good snapshot.
+type StaleSource struct {
+	URL          string    `json:"url"`
+	SnapshotTime time.Time `json:"snapshot_time"`
+	Error        string    `json:"error"`
+}
+
+// NewSnapshotStore creates and returns a new SnapshotStore.
+func NewSnapshotStore(dir string, offline bool) *SnapshotStore {
+	return &SnapshotStore{
+		Dir:     dir,
+		Offline: offline,
+		stale:   make(map[string]StaleSource),
+	}
+}
+
+// Fetch returns the content of a remote source, from the snapshot
+// directory in offline mode or from the network otherwise.
+// If the network fetch fails, the last-known-good snapshot is used
+// instead and the source is recorded as stale, otherwise a *DownloadError
+// is returned.
+func (s *SnapshotStore) Fetch(client *http.Client, url string) ([]byte, error) {
+	if !s.Offline {
+		body, fetchErr := FetchURL(client, url)
+		if fetchErr == nil {
+			return body, nil
+		}
+		info, err := os.Stat(s.path(url))
+		if err != nil {
+			return nil, fetchErr
+		}
+		if body, err = os.ReadFile(s.path(url)); err != nil {
+			return nil, fetchErr
+		}
+		Logf(slog.LevelWarn, "%v, using the snapshot of %s", fetchErr, info.ModTime().UTC().Format(time.RFC1123))
+		s.mu.Lock()
+		s.stale[url] = StaleSource{URL: url, SnapshotTime: info.ModTime().UTC(), Error: fetchErr.Error()}
+		s.mu.Unlock()
+		return body, nil
+	}
+	body, err := os.ReadFile(s.path(url))
+	if os.IsNotExist(err) {
+		return nil, &DownloadError{URL: url, Err: fmt.Errorf("no snapshot of %s in offline mode", url)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot of %s: %w", url, err)
+	}
+	return body, nil
+}
+
+// Save writes the content of a validated remote source as its snapshot.
+// Nothing is written in offline or read-only mode, or for stale sources,
+// as the content came from the snapshot.
+func (s *SnapshotStore) Save(url string, body []byte) error {
+	s.mu.Lock()
+	_, isStale := s.stale[url]
+	s.mu.Unlock()
+	if s.Offline || s.ReadOnly || isStale {
+		return nil
+	}
+	if err := MkdirAll(s.Dir); err != nil {
+		return err
+	}
+	return WriteFile(s.path(url), body)
+}
+
+// StaleSources returns the sorted sources replaced by their snapshots.
+func (s *SnapshotStore) StaleSources() []StaleSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	staleSources := make([]StaleSource, 0, len(s.stale))
+	for _, source := range s.stale {
+		staleSources = append(staleSources, source)
+	}
+	sort.Slice(staleSources, func(i, j int) bool { return staleSources[i].URL < staleSources[j].URL })
+	return staleSources
+}
+
+// path returns the snapshot file path of a remote source
+func (s *SnapshotStore) path(url string) string {
+	name := url
+	if idx := strings.Index(name, "://"); idx != -1 {
+		name = name[idx+3:]
+	}
+	name = strings.Trim(snapshotNameReplacer.ReplaceAllString(name, "_"), "_")
+	return filepath.Join(s.Dir, name)
+}
@@ -0,0 +1,162 @@
+package ruleset
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// templateSuffix is the file extension of the templates of custom output formats
+const templateSuffix = ".tmpl"
+
+// TemplateList is the data of a list passed to the templates of custom output formats.
+type TemplateList struct {
+	// Name is the lowercase name of the list, eg: "geolocation-!cn"
+	Name string
+	// LastModified is the generation time in RFC 1123 format or the HeaderTimeLayout, empty in reproducible mode without SOURCE_DATE_EPOCH
+	LastModified  string
+	SchemaVersion int
+	Rules         []TemplateRule
+}
+
+// TemplateRule is a rule of a list passed to the templates of custom output formats.
+type TemplateRule struct {
+	// Type is the rule type in the data syntax, "full", "domain" or "wildcard"
+	Type string
+	// Value is the domain, or the wildcard of a wildcard rule, eg: "*.cdn.*.example.com"
+	Value      string
+	Attributes []string
+	// Policy is the policy of the rule type set by the -listpolicy option, if any
+	Policy string
+}
+
+// templateFuncs are the functions available in the templates besides the built-in ones
+var templateFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"replace":   strings.ReplaceAll,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"quote":     strconv.Quote,
+	"yaml":      yamlQuote,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// TemplateExporter is an Exporter of a custom output format defined by a
+// text/template file, named like `openwrt.conf.tmpl` for the `openwrt` format
+// of .conf files, or `openwrt.tmpl` for the same name and extension.
+// The template is executed with a TemplateList for each exported list.
+type TemplateExporter struct {
+	name      string
+	extension string
+	tmpl      *template.Template
+}
+
+// NewTemplateExporter parses the template file of a custom output format.
+func NewTemplateExporter(path string) (*TemplateExporter, error) {
+	base := strings.TrimSuffix(filepath.Base(path), templateSuffix)
+	name, extension, ok := strings.Cut(base, ".")
+	if !ok {
+		extension = name
+	}
+	name, extension = strings.ToLower(name), strings.ToLower(extension)
+	if name == "" || extension == "" {
+		return nil, errors.New("invalid template name: " + filepath.Base(path))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateExporter{name: name, extension: extension, tmpl: tmpl}, nil
+}
+
+func (e *TemplateExporter) Name() string      { return e.name }
+func (e *TemplateExporter) Extension() string { return e.extension }
+
+func (e *TemplateExporter) Write(w io.Writer, l *ListInfo) error {
+	data := TemplateList{
+		Name:          strings.ToLower(string(l.Name)),
+		LastModified:  lastModified(nil, time.RFC1123),
+		SchemaVersion: SchemaVersion,
+		Rules:         make([]TemplateRule, 0, len(l.GeoSite.Domain)),
+	}
+	for _, rule := range l.GeoSite.Domain {
+		value := strings.TrimSpace(rule.GetValue())
+		if value == "" {
+			continue
+		}
+		ruleType := RuleTypeName(rule.Type)
+		if pattern, ok := regexpToWildcard(value); rule.Type == router.Domain_Regex && ok {
+			ruleType, value = "wildcard", pattern
+		}
+		templateRule := TemplateRule{
+			Type:       ruleType,
+			Value:      value,
+			Attributes: make([]string, 0, len(rule.Attribute)),
+			Policy:     l.rulePolicy(rule),
+		}
+		for _, attr := range rule.Attribute {
+			templateRule.Attributes = append(templateRule.Attributes, AttributeString(attr))
+		}
+		data.Rules = append(data.Rules, templateRule)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := e.tmpl.Execute(bw, data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// RegisterTemplates registers the templates in the directory as custom output
+// formats. Formats already registered by an earlier call are updated with the
+// current templates, so the directory can be registered again on each run.
+func RegisterTemplates(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), templateSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		exporter, err := NewTemplateExporter(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+		if existing, ok := FindExporter(exporter.Name()).(*TemplateExporter); ok && existing.Extension() == exporter.Extension() {
+			existing.tmpl = exporter.tmpl
+			continue
+		}
+		if FindExporter(exporter.Name()) != nil || FindExporter(exporter.Extension()) != nil {
+			return fmt.Errorf("template %s: format %s or extension .%s is already registered", name, exporter.Name(), exporter.Extension())
+		}
+		RegisterExporter(exporter)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package ruleset
+
+import (
+	"sync"
+	"time"
+)
+
+// StageTiming is the total time taken by a stage of a generation, and the
+// number of times it ran, eg: the exports of a format for all lists.
+type StageTiming struct {
+	Name     string
+	Count    int
+	Duration time.Duration
+}
+
+// Timings accumulates the time taken by each stage of a generation, in the
+// order the stages first ran. It is safe for concurrent use.
+type Timings struct {
+	mu     sync.Mutex
+	stages []*StageTiming
+}
+
+// Timing is the timings of the current generation. The package records the
+// parsing, the flattening and the downloads of the remote sources in it.
+var Timing = new(Timings)
+
+// Add adds a run of a stage taking d.
+func (t *Timings) Add(stage string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.stages {
+		if s.Name == stage {
+			s.Count++
+			s.Duration += d
+			return
+		}
+	}
+	t.stages = append(t.stages, &StageTiming{Name: stage, Count: 1, Duration: d})
+}
+
+// Start starts a run of a stage, and returns the function to call when it is done.
+func (t *Timings) Start(stage string) func() {
+	started := time.Now()
+	return func() {
+		t.Add(stage, time.Since(started))
+	}
+}
+
+// Stages returns the timings of the stages, in the order they first ran.
+func (t *Timings) Stages() []StageTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stages := make([]StageTiming, len(t.stages))
+	for i, s := range t.stages {
+		stages[i] = *s
+	}
+	return stages
+}
+
+// Reset clears the timings for the next generation.
+func (t *Timings) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages = nil
+}
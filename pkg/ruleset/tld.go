@@ -0,0 +1,86 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// parseTLDExpansion adds a domain rule for each top-level domain of the IANA
+// list matching any of the comma separated patterns, eg: `tld:cn`,
+// `tld:cn,xn--fiqs8s,xn--fiqz9s @cn`, `tld:xn--*` or `tld:中*`. A pattern
+// is a path.Match pattern matching the punycode or Unicode form of a TLD.
+// The IANA list is downloaded like the lists of `include-url` rules.
+func (l *ListInfo) parseTLDExpansion(expansion string) error {
+	parts := strings.Fields(strings.TrimPrefix(strings.TrimSpace(expansion), "tld:"))
+	if len(parts) == 0 {
+		return errors.New("empty tld rule")
+	}
+
+	var attrs []*router.Domain_Attribute
+	for _, attrString := range parts[1:] {
+		attr, err := l.parseAttribute(attrString)
+		if err != nil {
+			return err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	tlds, err := ianaTLDs()
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range strings.Split(strings.ToLower(parts[0]), ",") {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid tld pattern %q", pattern)
+		}
+		matched := false
+		for _, tld := range tlds {
+			if !matchTLD(pattern, tld) {
+				continue
+			}
+			matched = true
+			l.classifyRule(&router.Domain{Type: router.Domain_RootDomain, Value: tld, Attribute: append([]*router.Domain_Attribute(nil), attrs...)})
+		}
+		if !matched {
+			return fmt.Errorf("no top-level domain matches %q in %s", pattern, TLDListURL)
+		}
+	}
+	return nil
+}
+
+// matchTLD reports whether the pattern matches the punycode or Unicode form of the TLD
+func matchTLD(pattern, tld string) bool {
+	if ok, _ := path.Match(pattern, tld); ok {
+		return true
+	}
+	if unicode := unicodeDomain(tld); unicode != "" {
+		ok, _ := path.Match(pattern, unicode)
+		return ok
+	}
+	return false
+}
+
+// ianaTLDs returns the lowercase top-level domains of the IANA list
+func ianaTLDs() ([]string, error) {
+	body, err := remoteLists.Get(TLDListURL)
+	if err != nil {
+		return nil, err
+	}
+	var tlds []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tlds = append(tlds, strings.ToLower(line))
+	}
+	if len(tlds) == 0 {
+		return nil, fmt.Errorf("no top-level domains in %s", TLDListURL)
+	}
+	return tlds, nil
+}
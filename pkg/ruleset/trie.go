@@ -0,0 +1,187 @@
+package ruleset
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// node is a node of the domain trie. The edge to a node is a run of labels,
+// so a chain of nodes with a single child each is a single node.
+type node struct {
+	// labels are the labels of the edge to the node, the top-level one first
+	labels []string
+	leaf   bool
+	// taken is whether the domain of the leaf is taken by take
+	taken bool
+	// children are the child nodes by the first label of their edges, nil for leaves
+	children map[string]*node
+}
+
+// child returns the child node whose edge starts with the label
+func (n *node) child(label string) *node {
+	return n.children[label]
+}
+
+func (n *node) addChild(child *node) {
+	if n.children == nil {
+		n.children = make(map[string]*node)
+	}
+	n.children[child.labels[0]] = child
+}
+
+// split splits the edge to the node after k labels, returning the new node of
+// the first k labels, whose child is the node with the remaining ones.
+func (n *node) split(k int) *node {
+	parent := &node{labels: n.labels[:k]}
+	n.labels = n.labels[k:]
+	parent.addChild(n)
+	return parent
+}
+
+// DomainTrie is a domain trie for domain type rules, of the labels of the
+// domains from the top-level one, with the runs of labels without branches
+// compressed into single nodes. A domain in the trie covers itself and its
+// subdomains.
+type DomainTrie struct {
+	root *node
+}
+
+// NewDomainTrie creates and returns a new domain trie.
+func NewDomainTrie() *DomainTrie {
+	return &DomainTrie{
+		root: new(node),
+	}
+}
+
+// NewDomainTrieOf returns a domain trie of the domains, inserted in the order
+// of their number of labels, so that the subdomains of the other domains are
+// skipped without being inserted first.
+func NewDomainTrieOf(domains []string) *DomainTrie {
+	sorted := append([]string(nil), domains...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(sorted[i], ".") < strings.Count(sorted[j], ".")
+	})
+	t := NewDomainTrie()
+	for _, domain := range sorted {
+		if domain != "" {
+			t.Insert(domain)
+		}
+	}
+	return t
+}
+
+// reversedLabels returns the labels of the domain, the top-level one first
+func reversedLabels(domain string) []string {
+	labels := strings.Split(domain, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+// Insert inserts a domain rule string into the domain trie
+// and return whether is inserted successfully or not.
+// A domain covered by a domain in the trie is not inserted, and the domains
+// a domain covers are removed from the trie when it is inserted.
+func (t *DomainTrie) Insert(domain string) (bool, error) {
+	if domain == "" {
+		return false, errors.New("empty domain")
+	}
+	labels := reversedLabels(domain)
+
+	n := t.root
+	for i := 0; ; {
+		if n.leaf {
+			return false, nil
+		}
+		if i == len(labels) {
+			// The domain is a parent domain of the domains under the node
+			n.leaf, n.children = true, nil
+			return true, nil
+		}
+		child := n.child(labels[i])
+		if child == nil {
+			n.addChild(&node{labels: labels[i:], leaf: true})
+			return true, nil
+		}
+		k := 1
+		for k < len(child.labels) && i+k < len(labels) && child.labels[k] == labels[i+k] {
+			k++
+		}
+		if k < len(child.labels) {
+			child = child.split(k)
+			n.addChild(child)
+		}
+		n, i = child, i+k
+	}
+}
+
+// Match returns the domain in the trie covering the domain, which is the
+// domain itself or one of its parent domains, or empty if none covers it.
+func (t *DomainTrie) Match(domain string) string {
+	if n, end := t.find(domain); n != nil {
+		return domain[end+1:]
+	}
+	return ""
+}
+
+// take reports whether the domain is itself in the trie, not only covered by
+// a parent domain, and not taken before, so that the first of the same domains
+// is the one taken.
+func (t *DomainTrie) take(domain string) bool {
+	n, end := t.find(domain)
+	if n == nil || end >= 0 || n.taken {
+		return false
+	}
+	n.taken = true
+	return true
+}
+
+// find returns the leaf of the domain covering the domain, and the index of
+// the dot before the labels of the covering domain in the domain, or -1 if it
+// is the domain itself. The labels are walked from the end of the domain,
+// without splitting it.
+func (t *DomainTrie) find(domain string) (*node, int) {
+	if domain == "" {
+		return nil, 0
+	}
+
+	n := t.root
+	// end is the end of the labels left to walk, -1 once they are all walked
+	end := len(domain)
+	for {
+		if n.leaf {
+			return n, end
+		}
+		if end < 0 {
+			return nil, 0
+		}
+		label, rest := lastLabel(domain[:end])
+		child := n.child(label)
+		if child == nil {
+			return nil, 0
+		}
+		for _, l := range child.labels[1:] {
+			if rest < 0 {
+				return nil, 0
+			}
+			if label, rest = lastLabel(domain[:rest]); label != l {
+				return nil, 0
+			}
+		}
+		n, end = child, rest
+	}
+}
+
+// lastLabel returns the last label of the domain, and the index of the dot
+// before it, or -1 if it is the only label.
+func lastLabel(domain string) (string, int) {
+	dot := strings.LastIndexByte(domain, '.')
+	return domain[dot+1:], dot
+}
+
+// Covers reports whether the domain or one of its parent domains is in the trie.
+func (t *DomainTrie) Covers(domain string) bool {
+	return t.Match(domain) != ""
+}
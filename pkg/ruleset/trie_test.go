@@ -0,0 +1,187 @@
+package ruleset
+
+import (
+	"fmt"
+	"testing"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+func TestDomainTrie(t *testing.T) {
+	trie := NewDomainTrie()
+	for _, tt := range []struct {
+		domain   string
+		inserted bool
+	}{
+		{"www.example.com", true},
+		// Splits the edge of www.example.com after com.example
+		{"mail.example.com", true},
+		{"a.b.example.org", true},
+		{"c.b.example.org", true},
+		// Ends in the middle of the edge of cdn.static.example.net
+		{"cdn.static.example.net", true},
+		{"static.example.net", true},
+		// Covered by a parent domain
+		{"img.static.example.net", false},
+		// Removes the subdomains it covers
+		{"example.com", true},
+		{"www.example.com", false},
+		{"example.com", false},
+		{"com", true},
+	} {
+		inserted, err := trie.Insert(tt.domain)
+		if err != nil {
+			t.Fatalf("Insert(%q): %v", tt.domain, err)
+		}
+		if inserted != tt.inserted {
+			t.Errorf("Insert(%q) = %v, want %v", tt.domain, inserted, tt.inserted)
+		}
+	}
+	if _, err := trie.Insert(""); err == nil {
+		t.Error("Insert(\"\"): no error")
+	}
+
+	for _, tt := range []struct {
+		domain, match string
+	}{
+		{"com", "com"},
+		{"www.example.com", "com"},
+		{"b.example.org", ""},
+		{"a.b.example.org", "a.b.example.org"},
+		{"x.c.b.example.org", "c.b.example.org"},
+		{"d.b.example.org", ""},
+		{"example.org", ""},
+		{"org", ""},
+		{"static.example.net", "static.example.net"},
+		{"cdn.static.example.net", "static.example.net"},
+		{"example.net", ""},
+		{"other.example.net", ""},
+		{"", ""},
+	} {
+		if match := trie.Match(tt.domain); match != tt.match {
+			t.Errorf("Match(%q) = %q, want %q", tt.domain, match, tt.match)
+		}
+		if covers := trie.Covers(tt.domain); covers != (tt.match != "") {
+			t.Errorf("Covers(%q) = %v", tt.domain, covers)
+		}
+	}
+}
+
+func TestNewDomainTrieOf(t *testing.T) {
+	trie := NewDomainTrieOf([]string{"a.example.com", "", "example.com", "b.example.org"})
+	for domain, match := range map[string]string{
+		"a.example.com":   "example.com",
+		"x.b.example.org": "b.example.org",
+		"example.org":     "",
+	} {
+		if got := trie.Match(domain); got != match {
+			t.Errorf("Match(%q) = %q, want %q", domain, got, match)
+		}
+	}
+}
+
+// benchmarkDomains returns n domains of 2 to 4 labels sharing parent domains,
+// like the domain rules of a large list.
+func benchmarkDomains(n int) []string {
+	domains := make([]string, n)
+	for i := range domains {
+		switch i % 3 {
+		case 0:
+			domains[i] = fmt.Sprintf("site%d.tld%d", i, i%50)
+		case 1:
+			domains[i] = fmt.Sprintf("www.site%d.tld%d", i/3, i%50)
+		default:
+			domains[i] = fmt.Sprintf("cdn%d.static.site%d.tld%d", i%7, i, i%50)
+		}
+	}
+	return domains
+}
+
+func BenchmarkDomainTrieInsert(b *testing.B) {
+	domains := benchmarkDomains(200000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewDomainTrieOf(domains)
+	}
+}
+
+func BenchmarkDomainTrieMatch(b *testing.B) {
+	domains := benchmarkDomains(200000)
+	trie := NewDomainTrieOf(domains)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Match("img." + domains[i%len(domains)])
+	}
+}
+
+func TestFlattenDropsCoveredRules(t *testing.T) {
+	l := NewListInfo()
+	for _, rule := range []*router.Domain{
+		{Type: router.Domain_RootDomain, Value: "www.example.com"},
+		{Type: router.Domain_RootDomain, Value: "example.com"},
+		{Type: router.Domain_RootDomain, Value: "example.com"},
+		{Type: router.Domain_RootDomain, Value: "example.org"},
+	} {
+		l.DomainTypeList = append(l.DomainTypeList, rule)
+	}
+	ads := []*router.Domain_Attribute{{Key: "ads", TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true}}}
+	l.FullTypeList = []*router.Domain{
+		{Type: router.Domain_Full, Value: "example.com"},
+		{Type: router.Domain_Full, Value: "mail.example.org"},
+		{Type: router.Domain_Full, Value: "example.net"},
+	}
+	l.AttributeRuleUniqueList = []*router.Domain{
+		{Type: router.Domain_RootDomain, Value: "ads.example.net", Attribute: ads},
+		{Type: router.Domain_RootDomain, Value: "cdn.ads.example.net", Attribute: ads},
+		{Type: router.Domain_Full, Value: "img.ads.example.net", Attribute: ads},
+		{Type: router.Domain_Full, Value: "example.net", Attribute: ads},
+	}
+	if err := l.Flatten(&ListInfoMap{}); err != nil {
+		t.Fatal(err)
+	}
+
+	values := func(rules []*router.Domain) []string {
+		var values []string
+		for _, rule := range rules {
+			values = append(values, rule.GetValue())
+		}
+		return values
+	}
+	for _, tt := range []struct {
+		name  string
+		rules []*router.Domain
+		want  []string
+	}{
+		{"domain", l.DomainTypeUniqueList, []string{"example.com", "example.org"}},
+		{"full", l.FullTypeList, []string{"example.net"}},
+		{"attribute", l.AttributeRuleUniqueList, []string{"ads.example.net", "example.net"}},
+	} {
+		if got := fmt.Sprint(values(tt.rules)); got != fmt.Sprint(tt.want) {
+			t.Errorf("%s rules = %s, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	domains := benchmarkDomains(200000)
+	rules := make([]*router.Domain, len(domains))
+	for i, domain := range domains {
+		rules[i] = &router.Domain{Type: router.Domain_RootDomain, Value: domain}
+	}
+	full := make([]*router.Domain, 0, len(domains)/4)
+	for i := 0; i < len(domains); i += 4 {
+		full = append(full, &router.Domain{Type: router.Domain_Full, Value: "img." + domains[i]})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := NewListInfo()
+		l.DomainTypeList = append(l.DomainTypeList, rules...)
+		l.FullTypeList = append(l.FullTypeList, full...)
+		if err := l.Flatten(&ListInfoMap{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package ruleset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// exportedRuleTypes are the rule types represented in each built-in format.
+// Keyword rules, and regexp rules other than wildcards, are not converted
+// into geosite entries, so they are dropped from all formats as documented.
+var exportedRuleTypes = map[string][]router.Domain_Type{
+	"text":        {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"surge":       {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"mihomo":      {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"mihomotext":  {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"singbox":     {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"quantumultx": {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"stash":       {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"v2ray":       {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"egern":       {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+	"dat":         {router.Domain_Full, router.Domain_RootDomain, router.Domain_Regex},
+}
+
+// errUnknownRule is the error of a line of a generated file not in the syntax of its format
+var errUnknownRule = errors.New("unknown rule")
+
+// fieldSafeFormats are the formats of comma separated fields, dropping the
+// rules whose values cannot be represented in a field.
+var fieldSafeFormats = map[string]bool{"surge": true, "quantumultx": true}
+
+// labelWildcardFormats are the formats whose wildcards are whole labels,
+// dropping the other wildcard rules.
+var labelWildcardFormats = map[string]bool{"mihomo": true, "mihomotext": true, "stash": true}
+
+// VerifyResult is the result of verifying the rules of a generated file of a
+// list against the rules parsed from the data directories.
+type VerifyResult struct {
+	// Missing is the rules of the list not represented in the file
+	Missing []string
+	// Unexpected is the rules in the file not in the list
+	Unexpected []string
+	// Dropped is the number of rules dropped as documented by the reason,
+	// the rule type like "keyword" for the types not supported by the format,
+	// "excluded" for the rules of excluded attributes, "covered" for the rules
+	// covered by a domain rule, and "unrepresentable" for the values not
+	// allowed in the fields of the format.
+	Dropped map[string]int
+}
+
+// CanVerify reports whether the files of a format can be parsed back by VerifyExported.
+func CanVerify(format string) bool {
+	return exportedRuleTypes[format] != nil
+}
+
+// VerifyExported parses back the rules of the file of the list in a built-in
+// format, and checks that they are the rules of the flattened list, besides
+// the ones dropped as documented. The attributes are only compared in the
+// text and dat formats, which keep them.
+func (l *ListInfo) VerifyExported(format string, content []byte, excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) (*VerifyResult, error) {
+	if !CanVerify(format) {
+		return nil, fmt.Errorf("format %s cannot be verified", format)
+	}
+	parsed, err := ParseExported(format, content)
+	if err != nil {
+		return nil, err
+	}
+	// The classical behavior of Mihomo has the regexps of all wildcards
+	labelWildcard := labelWildcardFormats[format] && !(strings.HasPrefix(format, "mihomo") && l.MihomoBehavior == MihomoClassical)
+	return l.verifyRules(parsed, exportedRuleTypes[format], format == "text" || format == "dat", fieldSafeFormats[format], labelWildcard, excludeAttrs, includeAttrs), nil
+}
+
+// VerifyGeoSite checks that the rules of the entry of the list in a dat file,
+// with their attributes, are the rules of the flattened list, besides the
+// ones dropped as documented.
+func (l *ListInfo) VerifyGeoSite(geosite *router.GeoSite, excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) *VerifyResult {
+	return l.verifyRules(geosite.GetDomain(), exportedRuleTypes["text"], true, false, false, excludeAttrs, includeAttrs)
+}
+
+func (l *ListInfo) verifyRules(parsed []*router.Domain, ruleTypes []router.Domain_Type, withAttrs, fieldSafe, labelWildcard bool, excludeAttrs, includeAttrs map[FileName]map[Attribute]bool) *VerifyResult {
+	represented := make(map[router.Domain_Type]bool)
+	for _, ruleType := range ruleTypes {
+		represented[ruleType] = true
+	}
+	inFile := make(map[string]bool, len(parsed))
+	var suffixes []string
+	for _, rule := range parsed {
+		inFile[verifyKey(rule, withAttrs)] = true
+		if rule.Type == router.Domain_RootDomain {
+			suffixes = append(suffixes, rule.GetValue())
+		}
+	}
+	// The domain rules of the file, covering the domain rules of subdomains and the full rules
+	covering := NewDomainTrieOf(suffixes)
+
+	// The sub-lists of attributes have no rules but the converted ones
+	rules := l.rules()
+	if len(rules) == 0 {
+		rules = l.GeoSite.GetDomain()
+	}
+
+	result := &VerifyResult{Dropped: make(map[string]int)}
+	inList := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		value := strings.TrimSpace(rule.GetValue())
+		if value == "" {
+			continue
+		}
+		key := verifyKey(rule, withAttrs)
+		inList[key] = true
+		pattern, isWildcard := regexpToWildcard(value)
+		switch {
+		case inFile[key]:
+		case !represented[rule.Type] || (rule.Type == router.Domain_Regex && !isWildcard):
+			result.Dropped[RuleTypeName(rule.Type)]++
+		case !keepAttributeRule(rule, excludeAttrs[l.Name], includeAttrs[l.Name]):
+			result.Dropped["excluded"]++
+		case fieldSafe && !isListFieldSafe(value), labelWildcard && isWildcard && !isLabelWildcard(pattern):
+			result.Dropped["unrepresentable"]++
+		case (rule.Type == router.Domain_Full && covering.Covers(value)) || (rule.Type == router.Domain_RootDomain && covering.Covers(nextParentDomain(value))):
+			result.Dropped["covered"]++
+		default:
+			result.Missing = append(result.Missing, key)
+		}
+	}
+	for _, rule := range parsed {
+		if key := verifyKey(rule, withAttrs); !inList[key] {
+			result.Unexpected = append(result.Unexpected, key)
+		}
+	}
+	sort.Strings(result.Missing)
+	sort.Strings(result.Unexpected)
+	return result
+}
+
+// verifyKey returns a rule in the data syntax, eg: "domain:example.com",
+// followed by its sorted attributes like "@ads@cn" if withAttrs is true.
+func verifyKey(rule *router.Domain, withAttrs bool) string {
+	key := ruleTypeValue(&router.Domain{Type: rule.Type, Value: strings.TrimSpace(rule.GetValue())})
+	if withAttrs {
+		key += ruleAttributes(rule)
+	}
+	return key
+}
+
+// ParseExported returns the rules of the content of a file in a built-in
+// format, with their attributes in the text format.
+func ParseExported(format string, content []byte) ([]*router.Domain, error) {
+	rules, _, err := parseExported(format, content, false)
+	return rules, err
+}
+
+// ParseRuleFile returns the domain rules of a rule file of a client in a
+// built-in format, like ParseExported, skipping the other rules like `IP-CIDR`
+// or the `ip_cidr_set` of Egern, and returns the number of skipped rules.
+func ParseRuleFile(format string, content []byte) ([]*router.Domain, int, error) {
+	if !CanVerify(format) {
+		return nil, 0, fmt.Errorf("format %s cannot be parsed", format)
+	}
+	return parseExported(format, content, true)
+}
+
+// parseExported returns the rules of the content of a file in a built-in
+// format and the number of the rules skipped as unknown if skipUnknown is set.
+func parseExported(format string, content []byte, skipUnknown bool) ([]*router.Domain, int, error) {
+	switch format {
+	case "singbox":
+		rules, err := parseSingBoxExported(content)
+		return rules, 0, err
+	case "v2ray":
+		return parseV2RayExported(content, skipUnknown)
+	case "dat":
+		rules, err := parseDatExported(content)
+		return rules, 0, err
+	}
+
+	var rules []*router.Domain
+	skipped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	lineNumber := 0
+	// inPayload is whether the lines of a Stash override are in the payload of the rule provider
+	inPayload := false
+	// egernType is the rule type of the set of the lines of an Egern rule set,
+	// and egernSkipped is whether the set is skipped as unknown
+	var egernType router.Domain_Type
+	egernSkipped := false
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || (format == "mihomo" && line == "payload:") {
+			continue
+		}
+		lineFormat := format
+		if format == "stash" {
+			// The rules are the items of the payload, the other lines are the metadata
+			if !strings.HasPrefix(line, "- ") {
+				inPayload = line == "payload:"
+				continue
+			}
+			if !inPayload {
+				continue
+			}
+			lineFormat = "mihomo"
+		}
+		if format == "egern" {
+			if !strings.HasPrefix(line, "- ") {
+				key, _, _ := strings.Cut(line, ":")
+				egernSkipped = false
+				switch key {
+				case "domain_set":
+					egernType = router.Domain_Full
+				case "domain_suffix_set":
+					egernType = router.Domain_RootDomain
+				case "domain_wildcard_set":
+					egernType = router.Domain_Regex
+				default:
+					if !skipUnknown {
+						return nil, skipped, fmt.Errorf("line %d: %w: %q", lineNumber, errUnknownRule, line)
+					}
+					egernSkipped = true
+				}
+				continue
+			}
+			if egernSkipped {
+				skipped++
+				continue
+			}
+			value, err := yamlUnquote(strings.TrimSpace(strings.TrimPrefix(line, "- ")))
+			if err != nil {
+				return nil, skipped, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if egernType == router.Domain_Regex {
+				value = wildcardToRegexp(value)
+			}
+			rules = append(rules, &router.Domain{Type: egernType, Value: value})
+			continue
+		}
+		rule, err := parseExportedLine(lineFormat, line)
+		if skipUnknown && errors.Is(err, errUnknownRule) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, skipped, fmt.Errorf("line %d: %w: %q", lineNumber, err, line)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, skipped, scanner.Err()
+}
+
+// exportedRuleNames are the rule types of the lines of the text, Surge and Quantumult X formats
+var exportedRuleNames = map[string]router.Domain_Type{
+	"full":            router.Domain_Full,
+	"domain":          router.Domain_RootDomain,
+	"keyword":         router.Domain_Plain,
+	"regexp":          router.Domain_Regex,
+	"wildcard":        router.Domain_Regex,
+	"DOMAIN":          router.Domain_Full,
+	"DOMAIN-SUFFIX":   router.Domain_RootDomain,
+	"DOMAIN-KEYWORD":  router.Domain_Plain,
+	"DOMAIN-WILDCARD": router.Domain_Regex,
+	"host":            router.Domain_Full,
+	"host-suffix":     router.Domain_RootDomain,
+	"host-keyword":    router.Domain_Plain,
+	"host-wildcard":   router.Domain_Regex,
+}
+
+// exportedWildcardNames are the rule types of the lines of wildcard rules,
+// whose values are the wildcards instead of the regexps
+var exportedWildcardNames = map[string]bool{"wildcard": true, "DOMAIN-WILDCARD": true, "host-wildcard": true}
+
+func parseExportedLine(format, line string) (*router.Domain, error) {
+	switch format {
+	case "text":
+		// Output format is: type:domain.tld:@attr1,@attr2
+		rule := new(router.Domain)
+		if idx := strings.LastIndex(line, ":@"); idx != -1 {
+			for _, attr := range strings.Split(line[idx+1:], ",") {
+				rule.Attribute = append(rule.Attribute, &router.Domain_Attribute{Key: strings.TrimPrefix(strings.TrimSpace(attr), "@")})
+			}
+			line = line[:idx]
+		}
+		ruleType, value, _ := strings.Cut(line, ":")
+		switch ruleType {
+		case "full", "domain", "keyword", "regexp":
+		case "wildcard":
+			value = wildcardToRegexp(value)
+		default:
+			return nil, errUnknownRule
+		}
+		rule.Type, rule.Value = exportedRuleNames[ruleType], value
+		return rule, nil
+
+	case "surge", "quantumultx":
+		fields := strings.Split(line, ",")
+		ruleType, ok := exportedRuleNames[strings.TrimSpace(fields[0])]
+		if len(fields) < 2 || !ok {
+			return nil, errUnknownRule
+		}
+		value := strings.TrimSpace(fields[1])
+		if exportedWildcardNames[strings.TrimSpace(fields[0])] {
+			value = wildcardToRegexp(value)
+		}
+		return &router.Domain{Type: ruleType, Value: value}, nil
+
+	case "mihomo":
+		value, ok := strings.CutPrefix(line, "- ")
+		if !ok {
+			return nil, errUnknownRule
+		}
+		value, err := yamlUnquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		return parseMihomoRule(value)
+
+	case "mihomotext":
+		return parseMihomoRule(line)
+	}
+	return nil, fmt.Errorf("unknown format %s", format)
+}
+
+// parseMihomoRule parses a rule of a Mihomo rule provider of the domain or the
+// classical behavior. The values of the domain behavior have no escaping
+// syntax, so a comma is only the separator of the classical behavior after a
+// known rule type.
+func parseMihomoRule(value string) (*router.Domain, error) {
+	if ruleType, rule, ok := strings.Cut(value, ","); ok {
+		ruleVal, _, _ := strings.Cut(rule, ",")
+		switch ruleType {
+		case "DOMAIN":
+			return &router.Domain{Type: router.Domain_Full, Value: ruleVal}, nil
+		case "DOMAIN-SUFFIX":
+			return &router.Domain{Type: router.Domain_RootDomain, Value: ruleVal}, nil
+		case "DOMAIN-KEYWORD":
+			return &router.Domain{Type: router.Domain_Plain, Value: ruleVal}, nil
+		case "DOMAIN-REGEX":
+			return &router.Domain{Type: router.Domain_Regex, Value: ruleVal}, nil
+		}
+	}
+	if domain, ok := strings.CutPrefix(value, "+."); ok {
+		return &router.Domain{Type: router.Domain_RootDomain, Value: domain}, nil
+	}
+	if strings.Contains(value, "*") {
+		return &router.Domain{Type: router.Domain_Regex, Value: wildcardToRegexp(value)}, nil
+	}
+	return &router.Domain{Type: router.Domain_Full, Value: value}, nil
+}
+
+// yamlUnquote returns the value of a YAML scalar quoted by yamlQuote
+func yamlUnquote(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case len(s) >= 2 && s[0] == '"':
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+func parseSingBoxExported(content []byte) ([]*router.Domain, error) {
+	var ruleSet struct {
+		Rules []struct {
+			Domain        []string `json:"domain"`
+			DomainSuffix  []string `json:"domain_suffix"`
+			DomainKeyword []string `json:"domain_keyword"`
+			DomainRegex   []string `json:"domain_regex"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal(content, &ruleSet); err != nil {
+		return nil, err
+	}
+
+	var rules []*router.Domain
+	for _, rule := range ruleSet.Rules {
+		// The domains of the `.example.com` suffixes of version 1 in `domain`
+		// are the domain rules of the suffixes
+		dotted := make(map[string]bool)
+		for _, suffix := range rule.DomainSuffix {
+			if strings.HasPrefix(suffix, ".") {
+				dotted[suffix[1:]] = true
+			}
+		}
+		for _, domain := range rule.Domain {
+			if !dotted[domain] {
+				rules = append(rules, &router.Domain{Type: router.Domain_Full, Value: domain})
+			}
+		}
+		for _, suffix := range rule.DomainSuffix {
+			rules = append(rules, &router.Domain{Type: router.Domain_RootDomain, Value: strings.TrimPrefix(suffix, ".")})
+		}
+		for _, keyword := range rule.DomainKeyword {
+			rules = append(rules, &router.Domain{Type: router.Domain_Plain, Value: keyword})
+		}
+		for _, regexp := range rule.DomainRegex {
+			rules = append(rules, &router.Domain{Type: router.Domain_Regex, Value: regexp})
+		}
+	}
+	return rules, nil
+}
+
+// parseV2RayExported returns the rules of the inline routing rules of the V2Ray
+// format, and the number of the rules skipped as unknown if skipUnknown is set
+func parseV2RayExported(content []byte, skipUnknown bool) ([]*router.Domain, int, error) {
+	var snippet struct {
+		Inline []struct {
+			Domain []string `json:"domain"`
+		} `json:"inline"`
+	}
+	if err := json.Unmarshal(content, &snippet); err != nil {
+		return nil, 0, err
+	}
+
+	var rules []*router.Domain
+	skipped := 0
+	for _, rule := range snippet.Inline {
+		for _, domain := range rule.Domain {
+			ruleType, value, _ := strings.Cut(domain, ":")
+			switch ruleType {
+			case "full", "domain", "keyword", "regexp":
+			default:
+				if skipUnknown {
+					skipped++
+					continue
+				}
+				return nil, 0, fmt.Errorf("%w: %q", errUnknownRule, domain)
+			}
+			rules = append(rules, &router.Domain{Type: exportedRuleNames[ruleType], Value: value})
+		}
+	}
+	return rules, skipped, nil
+}
@@ -0,0 +1,124 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidWildcard is the error of a wildcard rule with an invalid pattern
+var ErrInvalidWildcard = errors.New("invalid wildcard")
+
+// Wildcard rules, eg: `wildcard:*.cdn.*.example.com`, are regexp rules
+// in the outputs, converted by wildcardToRegexp, where `*` matches any
+// characters within a label and `?` a single one. They are the only regexp
+// rules kept in the dat file and the formats, and are written back as
+// wildcards in the formats supporting them.
+
+// validateWildcard checks that the pattern of a wildcard rule is labels of
+// letters, digits, `-`, `_`, `*` and `?`, with at least one `*` or `?`.
+func validateWildcard(pattern string) error {
+	if !strings.ContainsAny(pattern, "*?") {
+		return fmt.Errorf("%w: no * or ? in %s, use a full or domain rule instead", ErrInvalidWildcard, pattern)
+	}
+	for _, label := range strings.Split(pattern, ".") {
+		if label == "" {
+			return fmt.Errorf("%w: empty label in %s", ErrInvalidWildcard, pattern)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '*' || r == '?') {
+				return fmt.Errorf("%w: invalid character %q in %s", ErrInvalidWildcard, r, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// wildcardToRegexp returns the regexp of the pattern of a wildcard rule,
+// eg: `^[^.]*\.cdn\.[^.]*\.example\.com$` of `*.cdn.*.example.com`.
+func wildcardToRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(`[^.]*`)
+		case '?':
+			sb.WriteString(`[^.]`)
+		case '.':
+			sb.WriteString(`\.`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// regexpToWildcard returns the pattern of the regexp of a wildcard rule
+// converted by wildcardToRegexp, and false for other regexps.
+func regexpToWildcard(value string) (string, bool) {
+	value, ok := strings.CutPrefix(value, "^")
+	if !ok {
+		return "", false
+	}
+	if value, ok = strings.CutSuffix(value, "$"); !ok {
+		return "", false
+	}
+
+	var sb strings.Builder
+	for value != "" {
+		switch {
+		case strings.HasPrefix(value, `[^.]*`):
+			sb.WriteByte('*')
+			value = value[len(`[^.]*`):]
+		case strings.HasPrefix(value, `[^.]`):
+			sb.WriteByte('?')
+			value = value[len(`[^.]`):]
+		case strings.HasPrefix(value, `\.`):
+			sb.WriteByte('.')
+			value = value[len(`\.`):]
+		default:
+			r := value[0]
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return "", false
+			}
+			sb.WriteByte(r)
+			value = value[1:]
+		}
+	}
+	pattern := sb.String()
+	if validateWildcard(pattern) != nil {
+		return "", false
+	}
+	return pattern, true
+}
+
+// isLabelWildcard reports whether each `*` of the pattern is a whole label,
+// without `?`, as supported by the domain rule sets of Mihomo and Stash.
+func isLabelWildcard(pattern string) bool {
+	if strings.Contains(pattern, "?") {
+		return false
+	}
+	for _, label := range strings.Split(pattern, ".") {
+		if strings.Contains(label, "*") && label != "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// mihomoWildcard returns the pattern of the regexp of a wildcard rule for the
+// domain rule sets of Mihomo and Stash, where `*` is a whole label, and skips
+// the other wildcards with a notice.
+func mihomoWildcard(name FileName, format, value string) (string, bool) {
+	pattern, ok := regexpToWildcard(value)
+	if !ok {
+		return "", false
+	}
+	if !isLabelWildcard(pattern) {
+		Logf(LevelNotice, "%s: rule %q cannot be represented in %s format, skipped.", name, "wildcard:"+pattern, format)
+		return "", false
+	}
+	return pattern, true
+}
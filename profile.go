@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// The profiling flags shared by all commands
+var (
+	cpuProfile string
+	memProfile string
+	traceFile  string
+	timing     bool
+)
+
+// addProfileFlags adds the profiling flags to the flags of a command
+func addProfileFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cpuProfile, "cpuprofile", "", "Write a CPU profile of the command to the file, to be read by go tool pprof")
+	fs.StringVar(&memProfile, "memprofile", "", "Write a heap profile to the file when the command finishes, to be read by go tool pprof")
+	fs.StringVar(&traceFile, "trace", "", "Write an execution trace of the command to the file, to be read by go tool trace")
+	fs.BoolVar(&timing, "timing", false, "Log the time taken by each stage of the generation: parsing, flattening, the export of each format, the downloads and the other outputs")
+}
+
+// startProfiling starts the CPU profile and the execution trace of the
+// profiling flags, and returns the function stopping them and writing the
+// heap profile, to be called when the command finishes.
+func startProfiling() (stop func() error, err error) {
+	var stops []func() error
+	stop = func() error {
+		var errs []error
+		for i := len(stops) - 1; i >= 0; i-- {
+			errs = append(errs, stops[i]())
+		}
+		return errors.Join(errs...)
+	}
+
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+
+	if memProfile != "" {
+		stops = append(stops, func() error {
+			f, err := os.Create(memProfile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// Collect the garbage first for the up-to-date statistics of the live heap
+			runtime.GC()
+			return pprof.WriteHeapProfile(f)
+		})
+	}
+	return stop, nil
+}
+
+// logTimings logs the timings of the stages of the generation with -timing.
+// The downloads run during the parsing and the IP sets, so they are included
+// in the time of these stages as well.
+func logTimings(total time.Duration) {
+	if !timing {
+		return
+	}
+	for _, stage := range ruleset.Timing.Stages() {
+		ruleset.Logger.Info("stage timing", "stage", stage.Name, "runs", stage.Count, "duration", stage.Duration.Round(time.Microsecond))
+	}
+	ruleset.Logf(slog.LevelInfo, "Generated in %s.", total.Round(time.Millisecond))
+}
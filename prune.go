@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	pruneFlags     = flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneDataPath  = pruneFlags.String("datapath", "./data", "Path to the 'data' directory to be checked, separated by ',' comma for overlay directories, same as the generate command")
+	pruneLists     = pruneFlags.String("lists", "", "Lists to be checked, separated by ',' comma, or all lists if empty")
+	pruneResolvers = pruneFlags.String("resolvers", "8.8.8.8,1.1.1.1", "DNS servers or DoH endpoints to resolve with, separated by ',' comma. Example: 8.8.8.8,https://dns.google/dns-query")
+	pruneAttempts  = pruneFlags.Int("attempts", 2, "Number of times every resolver is asked, a domain is dead only if all answers are NXDOMAIN")
+	pruneRate      = pruneFlags.Int("rate", 20, "Maximum number of DNS queries per second, or unlimited if 0")
+	pruneWrite     = pruneFlags.Bool("write", false, "Remove the rules of the dead domains from the data files instead of only reporting them")
+)
+
+// runPrune resolves the full and domain rules of the data files of the lists,
+// and reports the dead domains consistently answered with NXDOMAIN, or
+// removes them from the data files with -write.
+func runPrune() error {
+	wanted := make(map[string]bool)
+	for _, list := range strings.Split(*pruneLists, ",") {
+		if list = strings.TrimSpace(list); list != "" {
+			wanted[strings.ToLower(list)] = true
+		}
+	}
+
+	var paths []string
+	for _, source := range ruleset.OverlayDataSources(*pruneDataPath) {
+		if err := filepath.Walk(source.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (len(wanted) == 0 || wanted[strings.ToLower(info.Name())]) {
+				paths = append(paths, path)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("prune: no lists to check in '%s'", *pruneDataPath)
+	}
+
+	domainsOfFile := make(map[string][]string, len(paths))
+	seen := make(map[string]bool)
+	var domains []string
+	for _, path := range paths {
+		fileDomains, err := ruleset.DataFileDomains(path)
+		if err != nil {
+			return err
+		}
+		domainsOfFile[path] = fileDomains
+		for _, domain := range fileDomains {
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+
+	var servers []string
+	for _, server := range strings.Split(*pruneResolvers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	ruleset.Logf(slog.LevelInfo, "Resolving %d domains of %d lists...", len(domains), len(paths))
+	dead, err := ruleset.NewDeadDomainChecker(servers, *pruneAttempts, *pruneRate).Dead(domains)
+	if err != nil {
+		return err
+	}
+	deadSet := make(map[string]bool, len(dead))
+	for _, domain := range dead {
+		deadSet[domain] = true
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, domain := range domainsOfFile[path] {
+			if deadSet[domain] {
+				fmt.Printf("%s: %s\n", path, domain)
+			}
+		}
+		if !*pruneWrite {
+			continue
+		}
+		removed, err := ruleset.PruneDataFile(path, deadSet)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			ruleset.Logf(slog.LevelInfo, "%s: %d lines of dead domains have been removed.", path, removed)
+		}
+	}
+	ruleset.Logf(slog.LevelInfo, "%d of %d domains are dead.", len(dead), len(domains))
+	return nil
+}
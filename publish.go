@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// publishContentTypes maps the extensions of generated files to their content types,
+// as most of them are unknown to the mime package or vary between systems.
+var publishContentTypes = map[string]string{
+	".dat":        "application/octet-stream",
+	".srs":        "application/octet-stream",
+	".json":       "application/json; charset=utf-8",
+	".yaml":       "application/yaml; charset=utf-8",
+	".html":       "text/html; charset=utf-8",
+	".txt":        "text/plain; charset=utf-8",
+	".list":       "text/plain; charset=utf-8",
+	".snippet":    "text/plain; charset=utf-8",
+	".stoverride": "application/yaml; charset=utf-8",
+	".sgmodule":   "text/plain; charset=utf-8",
+	".nft":        "text/plain; charset=utf-8",
+	".sha256":     "text/plain; charset=utf-8",
+	".minisig":    "text/plain; charset=utf-8",
+	".asc":        "text/plain; charset=utf-8",
+	".gz":         "application/gzip",
+	".zst":        "application/zstd",
+}
+
+// PublishHandler serves the files of the publish directory with their content
+// types, ETag and Last-Modified for conditional GETs, and gzip encoding.
+type PublishHandler struct {
+	dir   string
+	files http.Handler
+
+	mu    sync.Mutex
+	etags map[string]publishETag
+}
+
+// publishETag is the ETag of a file, valid while its size and modification time are unchanged
+type publishETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// NewPublishHandler creates and returns a new PublishHandler of the directory.
+func NewPublishHandler(dir string) *PublishHandler {
+	return &PublishHandler{
+		dir:   dir,
+		files: http.FileServer(http.Dir(dir)),
+		etags: make(map[string]publishETag),
+	}
+}
+
+func (h *PublishHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	ext := path.Ext(name)
+	if contentType, ok := publishContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// http.FileServer answers If-None-Match with the ETag header set here
+	if etag := h.etag(name); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	if ext == ".gz" || ext == ".zst" || ext == ".dat" || ext == ".srs" || r.Header.Get("Range") != "" {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	gzipWriter := &gzipResponseWriter{ResponseWriter: w}
+	defer gzipWriter.Close()
+	h.files.ServeHTTP(gzipWriter, r)
+}
+
+// etag returns the weak ETag of a file, as it is the same for gzip encoded responses,
+// or empty if it is not a regular file.
+func (h *PublishHandler) etag(name string) string {
+	filename := filepath.Join(h.dir, filepath.FromSlash(name))
+	info, err := os.Stat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cached, ok := h.etags[name]; ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag
+	}
+	hash, err := fileHash(filename)
+	if err != nil {
+		return ""
+	}
+	etag := `W/"` + hash[:32] + `"`
+	h.etags[name] = publishETag{size: info.Size(), modTime: info.ModTime(), etag: etag}
+	return etag
+}
+
+// acceptsGzip reports whether the client accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter gzip encodes the body of successful responses,
+// leaving the other responses, eg: 304 Not Modified, as is.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gzip        *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusOK {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.gzip = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gzip == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gzip.Write(b)
+}
+
+// Close flushes the gzip encoded body
+func (w *gzipResponseWriter) Close() error {
+	if w.gzip == nil {
+		return nil
+	}
+	return w.gzip.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// loadRanking loads the -tranco ranking of domains by popularity, from a
+// local path or downloaded from a URL and saved as a snapshot, or returns
+// nil if it is not set.
+func loadRanking(client *http.Client, snapshots *ruleset.SnapshotStore) (ruleset.Ranking, error) {
+	if *tranco == "" {
+		return nil, nil
+	}
+	defer ruleset.Timing.Start("ranking")()
+
+	var body []byte
+	var err error
+	isURL := strings.HasPrefix(*tranco, "http://") || strings.HasPrefix(*tranco, "https://")
+	if isURL {
+		body, err = snapshots.Fetch(client, *tranco)
+	} else {
+		body, err = os.ReadFile(*tranco)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ranking, err := ruleset.ParseRanking(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", *tranco, err)
+	}
+	if isURL {
+		if err := snapshots.Save(*tranco, body); err != nil {
+			return nil, fmt.Errorf("save snapshot of %s: %w", *tranco, err)
+		}
+	}
+	ruleset.Logger.Debug("loaded ranking", "source", *tranco, "domains", len(ranking))
+	return ranking, nil
+}
+
+// liteSubLists returns the lite variants of the -litelists lists, named like
+// `geolocation-!cn-lite`, with only the rules ranked within -literank.
+func liteSubLists(listInfoMap ruleset.ListInfoMap, ranking ruleset.Ranking) ([]*ruleset.ListInfo, error) {
+	lists := splitExportLists(*liteLists)
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	if ranking == nil {
+		return nil, errors.New("-litelists requires the ranking of -tranco")
+	}
+
+	var subLists []*ruleset.ListInfo
+	for _, name := range lists {
+		listinfo := listInfoMap[ruleset.FileName(strings.ToUpper(name))]
+		if listinfo == nil {
+			ruleset.Logf(ruleset.LevelNotice, "%s: no such list to export the lite variant of in the directory, skipped.", name)
+			continue
+		}
+		subList := listinfo.LiteSubList(ranking, *liteRank)
+		ruleset.Logf(slog.LevelInfo, "%s: %d of %d rules are in the top %d domains.", strings.ToLower(string(subList.Name)), len(subList.GeoSite.GetDomain()), len(listinfo.GeoSite.GetDomain()), *liteRank)
+		subLists = append(subLists, subList)
+	}
+	return subLists, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// The exit codes of the commands, for CI wrappers to tell the failures apart.
+// The flag package exits with 2 on invalid flags.
+const (
+	exitFailure  = 1
+	exitParse    = 3
+	exitDownload = 4
+	exitWrite    = 5
+)
+
+// dataError is an error of the data directories other than an invalid rule,
+// like an unknown included list or an include cycle.
+type dataError struct {
+	err error
+}
+
+func (e *dataError) Error() string { return e.err.Error() }
+
+func (e *dataError) Unwrap() error { return e.err }
+
+// skippedError is the error failing a generation in -keepgoing mode, with the
+// report of all errors of the skipped lists.
+type skippedError struct {
+	msg  string
+	errs []error
+	// lines are the sorted messages of the errors, one per line
+	lines []string
+}
+
+func (e *skippedError) Error() string { return e.msg }
+
+func (e *skippedError) Unwrap() []error { return e.errs }
+
+// exitCode returns the exit code of the error of a command: exitDownload for
+// remote sources failing without a snapshot, exitParse for invalid data files,
+// exitWrite for output files failing to be written, exitFailure otherwise,
+// including input files failing to be read.
+func exitCode(err error) int {
+	var (
+		downloadErr *ruleset.DownloadError
+		parseErr    *ruleset.ParseError
+		skippedErr  *ruleset.SkippedListsError
+		dataErr     *dataError
+		writeErr    *ruleset.WriteError
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &downloadErr):
+		return exitDownload
+	case errors.As(err, &parseErr), errors.As(err, &skippedErr), errors.As(err, &dataErr):
+		return exitParse
+	case errors.As(err, &writeErr):
+		return exitWrite
+	}
+	return exitFailure
+}
+
+// RunReport is the report of a generation written to -runreport, for CI
+// wrappers to react to without parsing the logs.
+type RunReport struct {
+	// Status is "ok" or "failed"
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	Started  string `json:"started"`
+	Duration string `json:"duration"`
+	// Lists and Files are the exported lists and all files in the output path
+	Lists []string `json:"lists"`
+	Files []string `json:"files"`
+	// Skipped is the errors of the lists skipped in -keepgoing mode
+	Skipped  []string `json:"skipped"`
+	Warnings []string `json:"warnings"`
+	// Errors is the error failing the generation, if any, followed by the
+	// errors that did not fail it
+	Errors []string `json:"errors"`
+}
+
+// newRunReport returns the report of a generation of the summary and the error
+// failing it, with the warnings logged during it.
+func newRunReport(summary *BuildSummary, err error, warnings []string) *RunReport {
+	report := &RunReport{
+		Status:   "ok",
+		ExitCode: exitCode(err),
+		Started:  summary.Started,
+		Duration: summary.Duration,
+		Lists:    make([]string, 0),
+		Files:    make([]string, 0),
+		Skipped:  make([]string, 0),
+		Warnings: append(make([]string, 0, len(warnings)), warnings...),
+		Errors:   make([]string, 0, len(summary.Errors)+1),
+	}
+	var skipped *skippedError
+	switch {
+	case errors.As(err, &skipped):
+		report.Status = "failed"
+		report.Skipped = append(report.Skipped, skipped.lines...)
+	case err != nil:
+		report.Status = "failed"
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.Errors = append(report.Errors, summary.Errors...)
+
+	if summary.stats != nil {
+		lists := make(map[string]bool)
+		for _, file := range summary.stats.Files {
+			report.Files = append(report.Files, file.Name)
+			// The files of several lists, like the dat file, are not of an exported list
+			if len(file.Lists) == 1 {
+				lists[file.Lists[0]] = true
+			}
+		}
+		for list := range lists {
+			report.Lists = append(report.Lists, list)
+		}
+		sort.Strings(report.Lists)
+	}
+	return report
+}
+
+// writeRunReport writes the report as indented JSON to the path
+func writeRunReport(path string, report *RunReport) error {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ruleset.WriteFile(path, append(reportBytes, '\n'))
+}
+
+// warningRecorder is a log handler recording the messages of the warnings,
+// passing all records to the wrapped handler.
+type warningRecorder struct {
+	slog.Handler
+	mu       *sync.Mutex
+	warnings *[]string
+}
+
+// recordWarnings wraps the logger to record its warnings, until the returned
+// function restores it and returns them.
+func recordWarnings() func() []string {
+	logger := ruleset.Logger
+	recorder := &warningRecorder{Handler: logger.Handler(), mu: new(sync.Mutex), warnings: new([]string)}
+	ruleset.Logger = slog.New(recorder)
+	return func() []string {
+		ruleset.Logger = logger
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return *recorder.warnings
+	}
+}
+
+func (h *warningRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn && r.Level < slog.LevelError {
+		h.mu.Lock()
+		*h.warnings = append(*h.warnings, strings.TrimSpace(r.Message))
+		h.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *warningRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningRecorder{Handler: h.Handler.WithAttrs(attrs), mu: h.mu, warnings: h.warnings}
+}
+
+func (h *warningRecorder) WithGroup(name string) slog.Handler {
+	return &warningRecorder{Handler: h.Handler.WithGroup(name), mu: h.mu, warnings: h.warnings}
+}
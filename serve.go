@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// CompareResult is the response of the compare API, listing the lists
+// a domain belongs to with the base and the staging data directories,
+// and the rules matching it with their origins.
+type CompareResult struct {
+	Domain      string      `json:"domain"`
+	Before      []string    `json:"before"`
+	After       []string    `json:"after"`
+	Added       []string    `json:"added"`
+	Removed     []string    `json:"removed"`
+	BeforeRules []RuleMatch `json:"before_rules"`
+	AfterRules  []RuleMatch `json:"after_rules"`
+}
+
+// RuleMatch is a rule of a list matching a domain, with its attributes and
+// the data file, line and include chain it comes from.
+type RuleMatch struct {
+	List       string   `json:"list"`
+	Rule       string   `json:"rule"`
+	Attributes []string `json:"attributes,omitempty"`
+	ruleset.RuleOrigin
+}
+
+var (
+	serveFlags        = flag.NewFlagSet("serve", flag.ExitOnError)
+	serveListen       = serveFlags.String("listen", "127.0.0.1:8080", "Address to listen on")
+	servePublishPath  = serveFlags.String("publishpath", "", "Path to the generated files to be served, leave empty to skip")
+	serveMetrics      = serveFlags.Bool("metrics", false, "Track in-memory request counts and User-Agents of served files, exposed via /metrics")
+	serveBasePath     = serveFlags.String("datapath", "./data", "Path to the base 'data' directory, separated by ',' comma for overlay directories, same as the generate command")
+	serveStagingPath  = serveFlags.String("staging", "", "Path to the 'data' directory with the proposed changes, eg: a PR checkout")
+	serveExcludeAttrs = serveFlags.String("excludeattrs", defaultExcludeAttrs, "Exclude rules with certain attributes in certain lists, same as the generate command")
+	serveIncludeAttrs = serveFlags.String("includeattrs", "", "Keep only rules with certain attributes in certain lists, same as the generate command")
+	serveRegenerate   = serveFlags.Bool("regenerate", false, "Expose POST /api/regenerate, which generates the files of -datapath into -publishpath again")
+	serveToken        = serveFlags.String("token", "", "Bearer token required by POST /api/regenerate, which is not exposed without it")
+)
+
+func init() {
+	// The regeneration accepts the flags of the generate command not defined by the serve command
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if serveFlags.Lookup(f.Name) == nil {
+			serveFlags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+// runServe runs the read-only HTTP server of the serve command.
+func runServe() error {
+	if *servePublishPath == "" && *serveStagingPath == "" {
+		return errors.New("serve: nothing to serve, set -publishpath and/or -staging")
+	}
+	if *serveRegenerate && *serveToken == "" {
+		return errors.New("serve: -regenerate requires -token, not to let any client trigger a generation")
+	}
+
+	mux := http.NewServeMux()
+
+	if *servePublishPath != "" {
+		var handler http.Handler = NewPublishHandler(*servePublishPath)
+		if *serveMetrics {
+			metrics := NewArtifactMetrics()
+			handler = metrics.Middleware(handler)
+			mux.Handle("/metrics", metrics)
+		}
+		mux.Handle("/", handler)
+		ruleset.Logf(slog.LevelInfo, "Serving files in '%s' on http://%s", *servePublishPath, *serveListen)
+
+		if *serveRegenerate {
+			mux.Handle("/api/regenerate", &regenerateHandler{token: *serveToken})
+		}
+	}
+
+	if *serveStagingPath != "" {
+		setRulesetOptions()
+		ruleset.TrackOrigins = true
+		exclude, include := ruleset.ParseExcludeAttrs(*serveExcludeAttrs), ruleset.ParseExcludeAttrs(*serveIncludeAttrs)
+		base, err := ruleset.LoadListInfoMap(ruleset.OverlayDataSources(*serveBasePath), ruleset.ConflictError)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", *serveBasePath, err)
+		}
+		base.ToProto(exclude, include)
+		staging, err := ruleset.LoadListInfoMap(ruleset.OverlayDataSources(*serveStagingPath), ruleset.ConflictError)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", *serveStagingPath, err)
+		}
+		staging.ToProto(exclude, include)
+
+		mux.HandleFunc("/api/compare", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			domain := r.URL.Query().Get("domain")
+			if domain == "" {
+				http.Error(w, "missing domain", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(compareMembership(domain, base, staging))
+		})
+		ruleset.Logf(slog.LevelInfo, "Serving comparison of '%s' and '%s' on http://%s", *serveBasePath, *serveStagingPath, *serveListen)
+	}
+
+	return http.ListenAndServe(*serveListen, mux)
+}
+
+// compareMembership compares the lists a domain belongs to between two ListInfoMaps
+func compareMembership(domain string, before, after ruleset.ListInfoMap) *CompareResult {
+	result := &CompareResult{
+		Domain:      domain,
+		Before:      before.MatchLists(domain),
+		After:       after.MatchLists(domain),
+		Added:       make([]string, 0),
+		Removed:     make([]string, 0),
+		BeforeRules: matchRules(domain, before),
+		AfterRules:  matchRules(domain, after),
+	}
+
+	beforeMap := make(map[string]bool)
+	for _, name := range result.Before {
+		beforeMap[name] = true
+	}
+	afterMap := make(map[string]bool)
+	for _, name := range result.After {
+		afterMap[name] = true
+		if !beforeMap[name] {
+			result.Added = append(result.Added, name)
+		}
+	}
+	for _, name := range result.Before {
+		if !afterMap[name] {
+			result.Removed = append(result.Removed, name)
+		}
+	}
+	return result
+}
+
+// matchRules returns the rules of the lists matching a domain with their origins
+func matchRules(domain string, listInfoMap ruleset.ListInfoMap) []RuleMatch {
+	matches := make([]RuleMatch, 0)
+	for _, name := range listInfoMap.MatchLists(domain) {
+		listinfo := listInfoMap[ruleset.FileName(name)]
+		for _, rule := range listinfo.Match(domain) {
+			match := RuleMatch{List: name, Rule: ruleset.RuleString(rule)}
+			for _, attr := range rule.Attribute {
+				match.Attributes = append(match.Attributes, ruleset.AttributeString(attr))
+			}
+			match.RuleOrigin, _ = listinfo.Origin(rule)
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// regenerateHandler runs the generate command with the data directory and the
+// publish directory of the serve command, one run at a time, for the clients
+// with the token.
+type regenerateHandler struct {
+	token string
+	mu    sync.Mutex
+}
+
+func (h *regenerateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.mu.TryLock() {
+		http.Error(w, "regeneration already running", http.StatusConflict)
+		return
+	}
+	defer h.mu.Unlock()
+
+	*dataPath, *outputPath = *serveBasePath, *servePublishPath
+	*excludeAttrs, *includeAttrs = *serveExcludeAttrs, *serveIncludeAttrs
+	start := time.Now()
+	err := runGenerate()
+
+	result := map[string]string{"status": "ok", "duration": time.Since(start).Round(time.Millisecond).String()}
+	status := http.StatusOK
+	if err != nil {
+		result["status"], result["error"] = "failed", err.Error()
+		status = http.StatusInternalServerError
+		ruleset.Logf(slog.LevelError, "%v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
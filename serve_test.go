@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// TestCompareMembership checks the lists a domain is added to by the staging
+// data directory, and the attributes, file, line and include chain of the
+// rules matching it.
+func TestCompareMembership(t *testing.T) {
+	trackOrigins := ruleset.TrackOrigins
+	ruleset.TrackOrigins = true
+	t.Cleanup(func() { ruleset.TrackOrigins = trackOrigins })
+
+	load := func(files map[string]string) (ruleset.ListInfoMap, string) {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		listInfoMap, err := ruleset.LoadListInfoMap(ruleset.OverlayDataSources(dir), ruleset.ConflictError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listInfoMap.ToProto(nil, nil)
+		return listInfoMap, dir
+	}
+	before, _ := load(map[string]string{
+		"google":          "domain:google.com\n",
+		"geolocation-!cn": "include:google\n",
+	})
+	after, dir := load(map[string]string{
+		"google":          "domain:google.com\n# Maps\nfull:maps.google.cn @cn @policy=direct\n",
+		"alphabet":        "include:google\n",
+		"geolocation-!cn": "include:alphabet\n",
+		"cn":              "domain:cn\ninclude:google @cn\n",
+	})
+
+	result := compareMembership("maps.google.cn", before, after)
+	if len(result.Before) != 0 || len(result.BeforeRules) != 0 {
+		t.Errorf("before = %v, %v, want no lists", result.Before, result.BeforeRules)
+	}
+	if want := []string{"ALPHABET", "CN", "GEOLOCATION-!CN", "GOOGLE"}; !reflect.DeepEqual(result.Added, want) {
+		t.Errorf("added = %v, want %v", result.Added, want)
+	}
+
+	google, cn := filepath.Join(dir, "google"), filepath.Join(dir, "cn")
+	maps := func(list string, via ...string) RuleMatch {
+		return RuleMatch{
+			List:       list,
+			Rule:       "full:maps.google.cn @cn @policy=direct",
+			Attributes: []string{"cn", "policy=direct"},
+			RuleOrigin: ruleset.RuleOrigin{File: google, Line: 3, Via: via},
+		}
+	}
+	want := []RuleMatch{
+		maps("ALPHABET", "include:google"),
+		maps("CN", "include:google @cn"),
+		{List: "CN", Rule: "domain:cn", RuleOrigin: ruleset.RuleOrigin{File: cn, Line: 1}},
+		maps("GEOLOCATION-!CN", "include:alphabet", "include:google"),
+		maps("GOOGLE"),
+	}
+	if !reflect.DeepEqual(result.AfterRules, want) {
+		t.Errorf("after rules =\n%#v\nwant\n%#v", result.AfterRules, want)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Signer signs the generated files with detached signatures.
+type Signer interface {
+	// Extension is the file extension of the signatures, eg: ".minisig"
+	Extension() string
+	// Sign returns the detached signature of the content of a file.
+	Sign(name string, content []byte) ([]byte, error)
+}
+
+// SignFiles writes a detached signature next to every file in the output
+// directory, for each of the signers.
+func SignFiles(outputDir string, signers ...Signer) error {
+	if len(signers) == 0 {
+		return nil
+	}
+	files, err := outputFiles(outputDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, name := range files {
+		if !isVerificationFile(name) || name == checksumFileName {
+			names = append(names, name)
+		}
+	}
+
+	for _, signer := range signers {
+		for _, name := range names {
+			content, err := os.ReadFile(filepath.Join(outputDir, name))
+			if err != nil {
+				return err
+			}
+			signature, err := signer.Sign(name, content)
+			if err != nil {
+				return fmt.Errorf("sign %s: %w", name, err)
+			}
+			if err := ruleset.WriteFile(filepath.Join(outputDir, name+signer.Extension()), signature); err != nil {
+				return err
+			}
+		}
+		ruleset.Logf(slog.LevelInfo, "%d files have been signed successfully with %s signatures in '%s'.", len(names), signer.Extension(), outputDir)
+	}
+	return nil
+}
+
+// MinisignSigner signs files with a minisign secret key, producing
+// signatures of the prehashed variant verifiable by `minisign -V`.
+type MinisignSigner struct {
+	keyID     [8]byte
+	secretKey ed25519.PrivateKey
+}
+
+// NewMinisignSigner decrypts a minisign secret key file with the password,
+// which may be empty for keys generated without one.
+func NewMinisignSigner(keyFile []byte, password string) (*MinisignSigner, error) {
+	lines := strings.Split(strings.TrimSpace(string(keyFile)), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return nil, errors.New("invalid minisign secret key: no untrusted comment")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid minisign secret key: %w", err)
+	}
+	// sig_alg(2) kdf_alg(2) cksum_alg(2) kdf_salt(32) kdf_opslimit(8) kdf_memlimit(8)
+	// and the encrypted key_id(8) secret_key(64) checksum(32)
+	if len(key) != 158 || string(key[:2]) != "Ed" || string(key[4:6]) != "B2" {
+		return nil, errors.New("invalid minisign secret key: unsupported algorithms")
+	}
+
+	keynum := append([]byte{}, key[54:]...)
+	switch string(key[2:4]) {
+	case "Sc":
+		n, r, p := scryptParams(binary.LittleEndian.Uint64(key[38:46]), binary.LittleEndian.Uint64(key[46:54]))
+		stream, err := scrypt.Key([]byte(password), key[6:38], n, r, p, len(keynum))
+		if err != nil {
+			return nil, err
+		}
+		subtle.XORBytes(keynum, keynum, stream)
+	case "\x00\x00":
+	default:
+		return nil, errors.New("invalid minisign secret key: unsupported key derivation")
+	}
+
+	checksum := blake2b.Sum256(append(append([]byte("Ed"), keynum[:8]...), keynum[8:72]...))
+	if subtle.ConstantTimeCompare(checksum[:], keynum[72:]) != 1 {
+		return nil, errors.New("invalid minisign secret key: wrong password or corrupted key")
+	}
+
+	signer := &MinisignSigner{secretKey: ed25519.PrivateKey(keynum[8:72])}
+	copy(signer.keyID[:], keynum[:8])
+	return signer, nil
+}
+
+func (s *MinisignSigner) Extension() string { return ".minisig" }
+
+func (s *MinisignSigner) Sign(name string, content []byte) ([]byte, error) {
+	hash := blake2b.Sum512(content)
+	signature := append(append([]byte("ED"), s.keyID[:]...), ed25519.Sign(s.secretKey, hash[:])...)
+
+	trustedComment := "file:" + name + "\thashed"
+	if ruleset.TimeNow != nil {
+		trustedComment = fmt.Sprintf("timestamp:%d\t%s", ruleset.TimeNow().Unix(), trustedComment)
+	}
+	globalSignature := ed25519.Sign(s.secretKey, append(append([]byte{}, signature[10:]...), trustedComment...))
+
+	var buf bytes.Buffer
+	buf.WriteString("untrusted comment: signature from rule-set secret key\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(signature) + "\n")
+	buf.WriteString("trusted comment: " + trustedComment + "\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(globalSignature) + "\n")
+	return buf.Bytes(), nil
+}
+
+// scryptParams returns the scrypt parameters of the libsodium opslimit and
+// memlimit of minisign secret keys, the same as pickparams of libsodium.
+func scryptParams(opsLimit, memLimit uint64) (n, r, p int) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+	r = 8
+	var logN uint
+	if opsLimit < memLimit/32 {
+		p = 1
+		maxN := opsLimit / (uint64(r) * 4)
+		for logN = 1; logN < 63; logN++ {
+			if uint64(1)<<logN > maxN/2 {
+				break
+			}
+		}
+	} else {
+		maxN := memLimit / (uint64(r) * 128)
+		for logN = 1; logN < 63; logN++ {
+			if uint64(1)<<logN > maxN/2 {
+				break
+			}
+		}
+		maxRP := (opsLimit / 4) / (uint64(1) << logN)
+		if maxRP > 0x3fffffff {
+			maxRP = 0x3fffffff
+		}
+		p = int(maxRP) / r
+	}
+	return 1 << logN, r, p
+}
+
+// PGPSigner signs files with the gpg command and a key in its keyring,
+// producing ASCII armored signatures verifiable by `gpg --verify`.
+// The key must be usable without a passphrase prompt, eg: via gpg-agent.
+type PGPSigner struct {
+	KeyID string
+}
+
+func (s *PGPSigner) Extension() string { return ".asc" }
+
+func (s *PGPSigner) Sign(name string, content []byte) ([]byte, error) {
+	cmd := exec.Command("gpg", "--batch", "--yes", "--armor", "--detach-sign", "--local-user", s.KeyID, "--output", "-")
+	cmd.Stdin = bytes.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	signature, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return signature, nil
+}
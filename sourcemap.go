@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// sourceMapFileName is the name of the source map of the lists in the debug directory
+const sourceMapFileName = "sourcemap.json"
+
+// GenerateSourceMap writes the annotated lists, `<list>.txt` with the origin
+// of each rule in a comment, and sourcemap.json of the origins of the rules of
+// all lists, into the debug directory. The lists are the ones parsed from the
+// data directories, converted by ToGeoSite with TrackOrigins.
+func GenerateSourceMap(debugDir string, listInfoMap ruleset.ListInfoMap) error {
+	if err := ruleset.MkdirAll(debugDir); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(listInfoMap))
+	for name, listinfo := range listInfoMap {
+		if listinfo.GeoSite != nil && listinfo.Parent == "" {
+			names = append(names, strings.ToLower(string(name)))
+		}
+	}
+	sort.Strings(names)
+
+	sourceMap := make(map[string][]ruleset.SourceMapEntry, len(names))
+	for _, name := range names {
+		listinfo := listInfoMap[ruleset.FileName(strings.ToUpper(name))]
+		if _, err := writeOutputFile(filepath.Join(debugDir, name+".txt"), true, func(w io.Writer) error {
+			return listinfo.WriteAnnotatedList(w)
+		}); err != nil {
+			return err
+		}
+		sourceMap[name] = listinfo.SourceMap()
+	}
+
+	sourceMapBytes, err := json.MarshalIndent(sourceMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ruleset.WriteFile(filepath.Join(debugDir, sourceMapFileName), sourceMapBytes); err != nil {
+		return err
+	}
+	ruleset.Logf(slog.LevelInfo, "%d annotated lists and %s have been generated successfully in '%s'.", len(names), sourceMapFileName, debugDir)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+const statsFileName = "stats.json"
+
+// Stats describes the generated files in the publish directory, with the
+// counts of the rules in the files generated from lists.
+type Stats struct {
+	GeneratedAt *time.Time  `json:"generated_at,omitempty"`
+	Files       []FileStats `json:"files"`
+}
+
+// FileStats describes a generated file.
+type FileStats struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// ModifiedAt is the generation time, or the modification time of the files
+	// of the lists unchanged since the last run in incremental mode
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	// Lists are the names of the lists the file is generated from
+	Lists []string `json:"lists,omitempty"`
+	// Rules and Attributes are the counts of the rules by type and by attribute
+	Rules      map[string]int `json:"rules,omitempty"`
+	Attributes map[string]int `json:"attributes,omitempty"`
+	// Popularity is the counts of the full and domain rules by the tier of their
+	// rank in the -tranco list, eg: "top1k", "top1m" or "unranked"
+	Popularity map[string]int `json:"popularity,omitempty"`
+}
+
+// GenerateStats writes stats.json describing all files in the output directory,
+// where listsOfFile maps the names of files to the lists they are generated from,
+// unchanged are the files not generated again in this run, and ranking is the
+// -tranco ranking of the domains, if any.
+func GenerateStats(outputDir string, listsOfFile map[string][]*ruleset.ListInfo, unchanged map[string]bool, ranking ruleset.Ranking) (*Stats, error) {
+	files, err := outputFiles(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := Stats{Files: make([]FileStats, 0, len(files))}
+	if ruleset.TimeNow != nil {
+		generatedAt := ruleset.TimeNow().UTC()
+		stats.GeneratedAt = &generatedAt
+	}
+	for _, name := range files {
+		if name == manifestFileName || name == statsFileName || name == indexFileName || name == indexJSONFileName || isVerificationFile(name) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(outputDir, name))
+		if err != nil {
+			return nil, err
+		}
+		hash, err := fileHash(filepath.Join(outputDir, name))
+		if err != nil {
+			return nil, err
+		}
+		fileStats := FileStats{Name: name, Size: info.Size(), SHA256: hash, ModifiedAt: stats.GeneratedAt}
+		if unchanged[name] && stats.GeneratedAt != nil {
+			modifiedAt := info.ModTime().UTC()
+			fileStats.ModifiedAt = &modifiedAt
+		}
+		for _, listinfo := range listsOfFile[name] {
+			fileStats.addList(listinfo, ranking)
+		}
+		stats.Files = append(stats.Files, fileStats)
+	}
+
+	statsBytes, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ruleset.WriteFile(filepath.Join(outputDir, statsFileName), statsBytes); err != nil {
+		return nil, err
+	}
+	ruleset.Logf(slog.LevelInfo, "%s has been generated successfully in '%s'.", statsFileName, outputDir)
+	return &stats, nil
+}
+
+// addList adds the name and the counts of the rules of a list
+func (s *FileStats) addList(listinfo *ruleset.ListInfo, ranking ruleset.Ranking) {
+	if listinfo == nil || listinfo.GeoSite == nil {
+		return
+	}
+	if s.Rules == nil {
+		s.Rules = make(map[string]int)
+		s.Attributes = make(map[string]int)
+	}
+	s.Lists = append(s.Lists, strings.ToLower(string(listinfo.Name)))
+	for _, rule := range listinfo.GeoSite.Domain {
+		s.Rules[ruleset.RuleTypeName(rule.Type)]++
+		for _, attr := range rule.Attribute {
+			s.Attributes[ruleset.AttributeString(attr)]++
+		}
+		if ranking != nil && (rule.Type == router.Domain_Full || rule.Type == router.Domain_RootDomain) {
+			if s.Popularity == nil {
+				s.Popularity = make(map[string]int)
+			}
+			s.Popularity[ruleset.RankTier(ranking.Rank(rule.GetValue()))]++
+		}
+	}
+}
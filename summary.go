@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+// listSummary is a row of the summary table, the files generated from a list
+type listSummary struct {
+	Name  string
+	Rules map[string]int
+	Files int
+	Bytes int64
+}
+
+// summaryRuleTypes are the rule types of the columns of the summary table
+var summaryRuleTypes = []string{"full", "domain", "regexp"}
+
+// printSummary prints a table of the exported lists at the end of a
+// generation, with the rules of each type and the files generated from each
+// list and their size, followed by the totals of all files in the output
+// path. It is logged as a message per list with -logformat json.
+func printSummary(stats *Stats, elapsed time.Duration) {
+	if stats == nil {
+		return
+	}
+	lists := make(map[string]*listSummary)
+	var totalBytes int64
+	for _, file := range stats.Files {
+		totalBytes += file.Size
+		if len(file.Lists) == 0 {
+			continue
+		}
+		// Files of several lists, like gfwlist.txt, are counted in the first one
+		list := lists[file.Lists[0]]
+		if list == nil {
+			list = &listSummary{Name: file.Lists[0], Rules: file.Rules}
+			lists[file.Lists[0]] = list
+		}
+		list.Files++
+		list.Bytes += file.Size
+	}
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if logFormat == ruleset.LogFormatJSON {
+		for _, name := range names {
+			list := lists[name]
+			ruleset.Logger.Info("list summary", "list", name, "rules", list.Rules, "files", list.Files, "bytes", list.Bytes)
+		}
+		ruleset.Logger.Info("summary", "lists", len(names), "files", len(stats.Files), "bytes", totalBytes, "duration", elapsed.Round(time.Millisecond))
+		return
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIST\tFULL\tDOMAIN\tREGEXP\tFILES\tSIZE")
+	for _, name := range names {
+		list := lists[name]
+		fmt.Fprintf(tw, "%s\t", name)
+		for _, ruleType := range summaryRuleTypes {
+			fmt.Fprintf(tw, "%d\t", list.Rules[ruleType])
+		}
+		fmt.Fprintf(tw, "%d\t%s\n", list.Files, formatSize(list.Bytes))
+	}
+	tw.Flush()
+	fmt.Printf("%d lists, %d files of %s in total, generated in %s.\n", len(names), len(stats.Files), formatSize(totalBytes), elapsed.Round(time.Millisecond))
+}
+
+// formatSize returns the size in bytes in a human readable unit, eg: "1.5 MiB"
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, suffix := float64(size)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	syncFlags        = flag.NewFlagSet("sync", flag.ExitOnError)
+	syncUpstream     = syncFlags.String("upstream", "https://codeload.github.com/v2fly/domain-list-community/tar.gz/refs/heads/master", "URL of the tar.gz archive of the upstream domain-list-community repository")
+	syncUpstreamPath = syncFlags.String("upstreampath", filepath.Join("./", "upstream", "data"), "Path to extract the upstream 'data' directory to, reused as is in offline mode")
+)
+
+func init() {
+	// The sync command generates after syncing, so it accepts all flags of the generate command
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if syncFlags.Lookup(f.Name) == nil {
+			syncFlags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+// runSync downloads the upstream data directory, then generates with
+// the local data directories overlaying the upstream one.
+func runSync() error {
+	if *offline {
+		if _, err := os.Stat(*syncUpstreamPath); err != nil {
+			return fmt.Errorf("no upstream data directory in offline mode: %w", err)
+		}
+		ruleset.Logf(slog.LevelInfo, "Use the upstream data directory '%s' in offline mode.", *syncUpstreamPath)
+	} else {
+		client, err := NewHTTPClient(*proxy)
+		if err != nil {
+			return err
+		}
+		body, err := ruleset.FetchURL(client, *syncUpstream)
+		if err != nil {
+			return err
+		}
+		if err := extractDataDir(body, *syncUpstreamPath); err != nil {
+			return fmt.Errorf("extract %s: %w", *syncUpstream, err)
+		}
+		ruleset.Logf(slog.LevelInfo, "Upstream data directory has been synced to '%s'.", *syncUpstreamPath)
+	}
+
+	*dataPath = *syncUpstreamPath + "," + *dataPath
+	return runGenerate()
+}
+
+// extractDataDir extracts the files in the `data` directory of a tar.gz
+// repository archive into dir, replacing its previous content.
+func extractDataDir(archive []byte, dir string) error {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	if err := ruleset.MkdirAll(filepath.Dir(filepath.Clean(dir))); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(dir)), ".sync-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	var files int
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Archive entries are like `domain-list-community-master/data/google`
+		parts := strings.SplitN(path.Clean(header.Name), "/", 3)
+		if len(parts) != 3 || parts[1] != "data" || strings.HasPrefix(parts[2], "..") {
+			continue
+		}
+
+		target := filepath.Join(tmpDir, filepath.FromSlash(parts[2]))
+		if err := ruleset.MkdirAll(filepath.Dir(target)); err != nil {
+			return err
+		}
+		file, err := os.Create(target)
+		if err != nil {
+			return &ruleset.WriteError{Err: err}
+		}
+		if _, err := io.Copy(file, tarReader); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		files++
+	}
+	if files == 0 {
+		return errors.New("no data directory in the archive")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return &ruleset.WriteError{Err: err}
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return &ruleset.WriteError{Err: err}
+	}
+	return nil
+}
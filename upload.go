@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+)
+
+var (
+	uploadFlags        = flag.NewFlagSet("publish", flag.ExitOnError)
+	uploadPath         = uploadFlags.String("path", "./publish", "Path to the publish directory to be uploaded")
+	uploadTarget       = uploadFlags.String("target", "", "Where to upload the files, s3://bucket/prefix for S3 or S3-compatible storages like R2, or github-release")
+	uploadEndpoint     = uploadFlags.String("endpoint", "", "Endpoint of S3-compatible storages, eg: https://<account>.r2.cloudflarestorage.com, leave empty for AWS S3")
+	uploadRegion       = uploadFlags.String("region", "", "Region of the S3 bucket, defaults to the AWS_REGION env, or us-east-1, or auto with -endpoint")
+	uploadCacheControl = uploadFlags.String("cachecontrol", "public, max-age=3600", "Cache-Control header of the files uploaded to S3")
+	uploadRepo         = uploadFlags.String("repo", "", "GitHub repository of the release, eg: owner/rule-set, defaults to the GITHUB_REPOSITORY env")
+	uploadTag          = uploadFlags.String("tag", "latest", "Tag of the GitHub release, created if it does not exist")
+)
+
+// Uploader uploads the generated files to a storage.
+type Uploader interface {
+	// Upload uploads a file, replacing the existing one of the same name.
+	Upload(name, contentType string, content []byte) error
+}
+
+// runUpload uploads the files of the publish directory to the target,
+// with their content types and cache headers.
+func runUpload() error {
+	var uploader Uploader
+	var err error
+	switch {
+	case strings.HasPrefix(*uploadTarget, "s3://"):
+		uploader, err = NewS3Uploader(*uploadTarget, *uploadEndpoint, *uploadRegion, *uploadCacheControl)
+	case *uploadTarget == "github-release":
+		uploader, err = NewGitHubReleaseUploader(*uploadRepo, *uploadTag)
+	case *uploadTarget == "":
+		err = errors.New("publish: -target is required, s3://bucket/prefix or github-release")
+	default:
+		err = errors.New("publish: unsupported target: " + *uploadTarget)
+	}
+	if err != nil {
+		return err
+	}
+
+	names, err := outputFiles(*uploadPath)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("publish: no files in '%s'", *uploadPath)
+	}
+
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(*uploadPath, name))
+		if err != nil {
+			return err
+		}
+		contentType, ok := publishContentTypes[path.Ext(name)]
+		if !ok {
+			contentType = "application/octet-stream"
+		}
+		if err := uploader.Upload(name, contentType, content); err != nil {
+			return fmt.Errorf("publish %s: %w", name, err)
+		}
+		ruleset.Logf(slog.LevelInfo, "%s has been uploaded successfully to '%s'.", name, *uploadTarget)
+	}
+	return nil
+}
+
+// S3Uploader uploads files to an S3 bucket, or a bucket of S3-compatible
+// storages like Cloudflare R2, signing the requests with AWS Signature Version 4.
+// The credentials are the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// optional AWS_SESSION_TOKEN env.
+type S3Uploader struct {
+	client       *http.Client
+	baseURL      *url.URL
+	prefix       string
+	region       string
+	cacheControl string
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// NewS3Uploader creates an S3Uploader of a target like s3://bucket/prefix.
+// Buckets of AWS S3 are addressed by virtual-hosted-style URLs,
+// and buckets of other endpoints by path-style URLs.
+func NewS3Uploader(target, endpoint, region, cacheControl string) (*S3Uploader, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+	if bucket == "" {
+		return nil, errors.New("publish: no bucket in target: " + target)
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+		if endpoint != "" {
+			region = "auto"
+		}
+	}
+
+	rawURL := "https://" + bucket + ".s3." + region + ".amazonaws.com/"
+	if endpoint != "" {
+		rawURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/"
+	}
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("publish: invalid endpoint %s: %w", endpoint, err)
+	}
+
+	u := &S3Uploader{
+		baseURL:         baseURL,
+		prefix:          strings.Trim(prefix, "/"),
+		region:          region,
+		cacheControl:    cacheControl,
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if u.accessKeyID == "" || u.secretAccessKey == "" {
+		return nil, errors.New("publish: no credentials, set the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY env")
+	}
+	if u.client, err = NewHTTPClient(""); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *S3Uploader) Upload(name, contentType string, content []byte) error {
+	key := name
+	if u.prefix != "" {
+		key = u.prefix + "/" + name
+	}
+	req, err := http.NewRequest(http.MethodPut, u.baseURL.String()+s3EscapePath(key), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if u.cacheControl != "" {
+		req.Header.Set("Cache-Control", u.cacheControl)
+	}
+	u.sign(req, content, time.Now().UTC())
+	return doUploadRequest(u.client, req, nil)
+}
+
+// sign signs a request with AWS Signature Version 4, with all its headers signed
+func (u *S3Uploader) sign(req *http.Request, content []byte, now time.Time) {
+	payloadHash := sha256.Sum256(content)
+	date := now.Format("20060102")
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+
+	headerNames := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		headerNames = append(headerNames, strings.ToLower(name))
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+	req.Header.Del("Host")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + u.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := []byte("AWS4" + u.secretAccessKey)
+	for _, part := range []string{date, u.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+u.accessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes an object key for the URL path, the same as the
+// URI encoding of AWS Signature Version 4, keeping the '/' separators.
+func s3EscapePath(key string) string {
+	var sb strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// GitHubReleaseUploader uploads files as the assets of a GitHub release,
+// replacing the existing assets of the same names. The token is the
+// GITHUB_TOKEN env, which needs the permission to write contents.
+type GitHubReleaseUploader struct {
+	client    *http.Client
+	token     string
+	repo      string
+	releaseID int64
+	// assets are the IDs of the existing assets of the release
+	assets map[string]int64
+}
+
+// githubRelease is the part of a release in GitHub API responses used by GitHubReleaseUploader
+type githubRelease struct {
+	ID     int64 `json:"id"`
+	Assets []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+// NewGitHubReleaseUploader creates a GitHubReleaseUploader of the release of
+// the tag, creating the release if it does not exist.
+func NewGitHubReleaseUploader(repo, tag string) (*GitHubReleaseUploader, error) {
+	if repo == "" {
+		repo = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if repo == "" {
+		return nil, errors.New("publish: -repo or the GITHUB_REPOSITORY env is required for github-release")
+	}
+	u := &GitHubReleaseUploader{token: os.Getenv("GITHUB_TOKEN"), repo: repo, assets: make(map[string]int64)}
+	if u.token == "" {
+		return nil, errors.New("publish: no credentials, set the GITHUB_TOKEN env")
+	}
+	var err error
+	if u.client, err = NewHTTPClient(""); err != nil {
+		return nil, err
+	}
+
+	var release githubRelease
+	req, err := u.newRequest(http.MethodGet, "https://api.github.com/repos/"+repo+"/releases/tags/"+url.PathEscape(tag), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := doUploadRequest(u.client, req, &release); err != nil {
+		if !errors.Is(err, errUploadNotFound) {
+			return nil, fmt.Errorf("publish: get release %s: %w", tag, err)
+		}
+		body, _ := json.Marshal(map[string]string{"tag_name": tag, "name": tag})
+		if req, err = u.newRequest(http.MethodPost, "https://api.github.com/repos/"+repo+"/releases", body); err != nil {
+			return nil, err
+		}
+		if err := doUploadRequest(u.client, req, &release); err != nil {
+			return nil, fmt.Errorf("publish: create release %s: %w", tag, err)
+		}
+		ruleset.Logf(slog.LevelInfo, "Release %s has been created successfully in '%s'.", tag, repo)
+	}
+
+	u.releaseID = release.ID
+	for _, asset := range release.Assets {
+		u.assets[asset.Name] = asset.ID
+	}
+	return u, nil
+}
+
+func (u *GitHubReleaseUploader) Upload(name, contentType string, content []byte) error {
+	if id, ok := u.assets[name]; ok {
+		req, err := u.newRequest(http.MethodDelete, fmt.Sprintf("https://api.github.com/repos/%s/releases/assets/%d", u.repo, id), nil)
+		if err != nil {
+			return err
+		}
+		if err := doUploadRequest(u.client, req, nil); err != nil {
+			return fmt.Errorf("delete the existing asset: %w", err)
+		}
+		delete(u.assets, name)
+	}
+
+	endpoint := fmt.Sprintf("https://uploads.github.com/repos/%s/releases/%d/assets?name=%s", u.repo, u.releaseID, url.QueryEscape(name))
+	req, err := u.newRequest(http.MethodPost, endpoint, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return doUploadRequest(u.client, req, nil)
+}
+
+func (u *GitHubReleaseUploader) newRequest(method, endpoint string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+u.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// errUploadNotFound is returned by doUploadRequest for 404 Not Found responses
+var errUploadNotFound = errors.New("not found")
+
+// doUploadRequest sends a request, and decodes the JSON response into v if not nil
+func doUploadRequest(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errUploadNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+var verifyFlags = flag.NewFlagSet("verify", flag.ExitOnError)
+
+func init() {
+	// The verify command parses the data like the generate command, so it accepts all flags of it
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if verifyFlags.Lookup(f.Name) == nil {
+			verifyFlags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+// runVerify parses the data directories again, then loads the generated dat
+// file and the files of the exported lists in the built-in formats back, and
+// reports the rules missing from them or not in the data, besides the rules
+// the formats drop as documented, eg: the keyword rules in Surge format.
+func runVerify() error {
+	setRulesetOptions()
+	if *templatesPath != "" {
+		if err := ruleset.RegisterTemplates(*templatesPath); err != nil {
+			return err
+		}
+	}
+	if *listDats {
+		ruleset.RegisterDatExporter()
+	}
+	if err := exportFormats.Check(); err != nil {
+		return err
+	}
+	if err := formatExcludeAttrs.Check(); err != nil {
+		return err
+	}
+	if err := checkLayout(*layout); err != nil {
+		return err
+	}
+	if err := checkFileNameTemplate(*fileNameTemplate); err != nil {
+		return err
+	}
+
+	client, err := NewHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+	snapshots := ruleset.NewSnapshotStore(*snapshotPath, *offline)
+	snapshots.ReadOnly = true
+	ruleset.SetRemoteSources(client, snapshots)
+
+	sources, err := dataSources()
+	if err != nil {
+		return err
+	}
+	listInfoMap, err := ruleset.LoadListInfoMap(sources, *conflict)
+	if err != nil {
+		return &dataError{err}
+	}
+	mihomoBehaviors, err := ruleset.ParseMihomoBehaviors(*mihomoBehavior)
+	if err != nil {
+		return err
+	}
+	for filename, behavior := range mihomoBehaviors {
+		if listinfo := listInfoMap[filename]; listinfo != nil && behavior != ruleset.MihomoIPCIDR {
+			listinfo.MihomoBehavior = behavior
+		}
+	}
+	excludeAttrsInFile := ruleset.ParseExcludeAttrs(*excludeAttrs)
+	includeAttrsInFile := ruleset.ParseExcludeAttrs(*includeAttrs)
+	if listInfoMap.ToProto(excludeAttrsInFile, includeAttrsInFile) == nil {
+		return fmt.Errorf("verify: no lists in the data directories")
+	}
+
+	var issues []string
+	// The numbers of rules dropped by each format as documented, by the reason
+	dropped := make(map[string]map[string]int)
+	addResult := func(file, format string, result *ruleset.VerifyResult) {
+		for _, rule := range result.Missing {
+			issues = append(issues, fmt.Sprintf("%s: missing rule %s", file, rule))
+		}
+		for _, rule := range result.Unexpected {
+			issues = append(issues, fmt.Sprintf("%s: unexpected rule %s", file, rule))
+		}
+		if dropped[format] == nil {
+			dropped[format] = make(map[string]int)
+		}
+		for reason, count := range result.Dropped {
+			dropped[format][reason] += count
+		}
+	}
+
+	datBytes, err := os.ReadFile(filepath.Join(*outputPath, *datName))
+	if err != nil {
+		return err
+	}
+	geositeList := new(router.GeoSiteList)
+	if err := proto.Unmarshal(datBytes, geositeList); err != nil {
+		return fmt.Errorf("invalid dat file %s: %w", *datName, err)
+	}
+	inDat := make(map[ruleset.FileName]bool)
+	for _, geosite := range geositeList.GetEntry() {
+		name := ruleset.FileName(geosite.GetCountryCode())
+		inDat[name] = true
+		listinfo := listInfoMap[name]
+		if listinfo == nil && name == buildInfoEntry {
+			continue
+		}
+		if listinfo == nil {
+			issues = append(issues, fmt.Sprintf("%s: unexpected list %s", *datName, strings.ToLower(string(name))))
+			continue
+		}
+		addResult(*datName+": "+strings.ToLower(string(name)), *datName, listinfo.VerifyGeoSite(geosite, excludeAttrsInFile, includeAttrsInFile))
+	}
+	for name := range listInfoMap {
+		if !inDat[name] {
+			issues = append(issues, fmt.Sprintf("%s: missing list %s", *datName, strings.ToLower(string(name))))
+		}
+	}
+	sort.Strings(issues)
+	verified := 1
+
+	exportListsSlice := splitExportLists(*exportLists)
+	for _, subList := range listInfoMap.AttributeSubLists(ruleset.ParseExcludeAttrs(*exportAttrs)) {
+		listInfoMap[subList.Name] = subList
+		exportListsSlice = append(exportListsSlice, strings.ToLower(string(subList.Name)))
+	}
+	ranking, err := loadRanking(client, snapshots)
+	if err != nil {
+		return err
+	}
+	subLists, err := liteSubLists(listInfoMap, ranking)
+	if err != nil {
+		return err
+	}
+	for _, subList := range subLists {
+		listInfoMap[subList.Name] = subList
+		exportListsSlice = append(exportListsSlice, strings.ToLower(string(subList.Name)))
+	}
+	exportListsSlice, formatsOfList := listInfoMap.ExportPlan(exportListsSlice, exportFormats)
+
+	unverifiable := make(map[string]bool)
+	for _, filename := range exportListsSlice {
+		listinfo := listInfoMap[ruleset.FileName(strings.ToUpper(filename))]
+		if listinfo == nil {
+			continue
+		}
+		chunksOfFormat, err := exportChunks(listinfo, formatsOfList[filename], excludeAttrsInFile, includeAttrsInFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		for _, format := range formatsOfList[filename] {
+			if !ruleset.CanVerify(format.Name()) {
+				unverifiable[format.Name()] = true
+				continue
+			}
+			formatExcludeAttrsInFile := formatExcludeAttrs.For(format.Name(), excludeAttrsInFile)
+			for _, chunk := range chunksOfFormat[format.Name()] {
+				name := exportedFileName(chunkFileName(filename, chunk), format)
+				content, err := os.ReadFile(filepath.Join(*outputPath, name))
+				if os.IsNotExist(err) {
+					issues = append(issues, name+": missing file")
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				result, err := chunk.VerifyExported(format.Name(), content, formatExcludeAttrsInFile, includeAttrsInFile)
+				if err != nil {
+					issues = append(issues, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				addResult(name, format.Name(), result)
+				verified++
+			}
+		}
+	}
+
+	formats := []string{*datName}
+	for _, format := range ruleset.Exporters() {
+		formats = append(formats, format.Name())
+	}
+	for _, format := range formats {
+		if counts := dropped[format]; len(counts) > 0 {
+			reasons := make([]string, 0, len(counts))
+			for reason, count := range counts {
+				reasons = append(reasons, fmt.Sprintf("%d %s", count, reason))
+			}
+			sort.Strings(reasons)
+			ruleset.Logf(ruleset.LevelNotice, "%s: rules dropped as documented: %s.", format, strings.Join(reasons, ", "))
+		}
+		if unverifiable[format] {
+			ruleset.Logf(ruleset.LevelNotice, "%s: files of custom formats cannot be parsed back, skipped.", format)
+		}
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("verify: %d issues found in '%s'", len(issues), *outputPath)
+	}
+	ruleset.Logf(slog.LevelInfo, "All %d files in '%s' match the data.", verified, *outputPath)
+	return nil
+}
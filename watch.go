@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Loyalsoldier/domain-list-custom/pkg/ruleset"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long to wait for more changes after a change,
+// as editors usually write a file in several operations.
+const watchDebounce = 300 * time.Millisecond
+
+// watchChanged is the lists whose data files changed since the last generation
+// in watch mode, or nil to generate all lists.
+var watchChanged map[ruleset.FileName]bool
+
+// runGenerateWatch generates all the files, then keeps watching the data
+// directories and regenerates the lists affected by changed files.
+func runGenerateWatch() error {
+	if err := runGenerate(); err != nil {
+		ruleset.Logf(slog.LevelError, "%v", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// The namespaces of the watched directories, empty for the local ones
+	namespaces := make(map[string]string)
+	var addDir func(dir, namespace string) error
+	addDir = func(dir, namespace string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return err
+			}
+			namespaces[filepath.Clean(path)] = namespace
+			return watcher.Add(path)
+		})
+	}
+	for _, source := range ruleset.OverlayDataSources(GetDataDir()) {
+		if err := addDir(source.Path, ""); err != nil {
+			return err
+		}
+	}
+	if *nsDataPath != "" {
+		for _, pair := range strings.Split(*nsDataPath, ",") {
+			if kv := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(kv) == 2 {
+				if err := addDir(strings.TrimSpace(kv[1]), strings.TrimSpace(kv[0])); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	ruleset.Logf(slog.LevelInfo, "\nWatching %d data directories for changes...", len(namespaces))
+
+	changed := make(map[ruleset.FileName]bool)
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			namespace, ok := namespaces[filepath.Dir(event.Name)]
+			if !ok {
+				continue
+			}
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if event.Has(fsnotify.Create) {
+					if err := addDir(event.Name, namespace); err != nil {
+						ruleset.Logf(slog.LevelWarn, "failed to watch %s: %v", event.Name, err)
+					}
+				}
+				continue
+			}
+			name := ruleset.FileName(strings.ToUpper(filepath.Base(event.Name)))
+			changed[name] = true
+			if namespace != "" {
+				changed[ruleset.FileName(strings.ToUpper(namespace))+":"+name] = true
+			}
+			timer.Reset(watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			ruleset.Logf(slog.LevelWarn, "%v", err)
+
+		case <-timer.C:
+			names := make([]string, 0, len(changed))
+			for name := range changed {
+				names = append(names, strings.ToLower(string(name)))
+			}
+			sort.Strings(names)
+			ruleset.Logf(slog.LevelInfo, "\nChanged: %s, regenerating...", strings.Join(names, ", "))
+
+			watchChanged = changed
+			if err := runGenerate(); err != nil {
+				ruleset.Logf(slog.LevelError, "%v", err)
+			}
+			watchChanged = nil
+			changed = make(map[ruleset.FileName]bool)
+		}
+	}
+}